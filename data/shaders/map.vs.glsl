@@ -1,13 +1,30 @@
-
 uniform vec3 lightPos;
+uniform float morph, lod;
+// level and morph factor of the vertices on the left, right, top and bottom edge
+uniform float edgeMorph[4], edgeLod[4];
 varying vec3 normal, lightDir;
 varying vec3 tcoord;
 
 void main() {
+	// geomorphing: texture coordinate 0 holds the height at the next
+	// coarser level and the level of the vertex, plus 16 times its edge
+	// for vertices on an edge
+	vec4 vertex = gl_Vertex;
+	float edge = floor(gl_MultiTexCoord0.y / 16.0);
+	float level = gl_MultiTexCoord0.y - 16.0 * edge;
+	float vertexMorph = morph, vertexLod = lod;
+	if (edge > 0.5) {
+		int i = int(edge) - 1;
+		vertexMorph = edgeMorph[i];
+		vertexLod = edgeLod[i];
+	}
+	if (abs(level - vertexLod) < 0.5) {
+		vertex.z = mix(vertex.z, gl_MultiTexCoord0.x, vertexMorph);
+	}
+
 	normal = normalize(gl_NormalMatrix * gl_Normal);
-	lightDir = normalize(lightPos - vec3(gl_ModelViewMatrix * gl_Vertex));
-	tcoord = gl_Vertex.xyz;
+	lightDir = normalize(lightPos - vec3(gl_ModelViewMatrix * vertex));
+	tcoord = vertex.xyz;
 
-	gl_Position = gl_ModelViewProjectionMatrix * gl_Vertex;
+	gl_Position = gl_ModelViewProjectionMatrix * vertex;
 }
-
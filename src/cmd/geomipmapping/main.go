@@ -3,28 +3,28 @@ package main
 import (
 	"os"
 	_ "fmt"
+	"log"
 	"runtime"
 	_ "image/png"  // Only register png/jpeg decoder, but never use it directly. 
 	_ "image/jpeg" // image.Decode does all the work for us.
 	"g3"
+	"g3/camera"
 	geo "g3/geomipmapping"
 )
 
 var (
-	dirBase  = g3.Vec3{0, 1, 0}
-	upBase   = g3.Vec3{0, 0, 1}
-	leftBase = g3.Vec3{-1, 0, 0}
+	lightPos = g3.Vec3{10, 10, 10}
+	cameras  []camera.Camera
+	current  int
 )
 
-var (
-	lightPos      = g3.Vec3{10, 10, 10}
-	pos           = g3.Vec3{0, 0, 0.01}
-	alpha         = float32(g3.Pi/2)
-	beta          = float32(0)
-	speed         = float32(0)
-	dir, up, left g3.Vec3
-	projection    g3.Matrix4x4
-	modelView     g3.Matrix4x4
+const (
+	terrainSource = "../../../data/heightmaps/map1.png"
+	terrainCache  = "map1.g3gm"
+	patchSize     = 32
+	maxLOD        = 5
+	whScale       = 0.01
+	hScale        = 0.3
 )
 
 var (
@@ -37,33 +37,22 @@ var (
 	locGrass  uint
 	frustum   *g3.Frustum
 	wireframe bool
+	occlusion *g3.OcclusionBuffer
+	occlude   bool
 )
 
 func multiplexEvents(engine g3.Engine) {
 	for {
 		select {
 		case me := <-engine.MouseEventChan():
-			alpha += float32(-me.Dx) / 100
-			beta += float32(-me.Dy) / 100
-			beta = g3.Clamp(beta, -g3.Pi/2, g3.Pi/2)
-			ud := g3.MakeXRotationMatrix(beta)
-			lr := g3.MakeZRotationMatrix(alpha)
-			m := lr.Multiply(&ud)
-			dir = m.Transform(dirBase)
-			up = m.Transform(upBase)
-			left = m.Transform(leftBase)
+			cameras[current].HandleMouseEvent(&me)
 		case ke := <-engine.KeyEventChan():
 			//fmt.Println(ke)
+			for _, c := range cameras {
+				c.HandleKeyEvent(&ke)
+			}
 			if ke.Type == g3.KeyPressed {
 				switch ke.Key {
-				case g3.KeyW:
-					speed += 0.0001
-				case g3.KeyS:
-					speed -= 0.0001
-				case g3.KeyA:
-					pos.Accumulate(left.Scaled(0.01))
-				case g3.KeyD:
-					pos.Accumulate(left.Scaled(-0.01))
 				case g3.KeyF1:
 					if wireframe {
 						engine.GetGraphicsDevice().SetFillMode(g3.FillSolid)
@@ -71,10 +60,10 @@ func multiplexEvents(engine g3.Engine) {
 						engine.GetGraphicsDevice().SetFillMode(g3.FillWireFrame)
 					}
 					wireframe = !wireframe
-				case g3.KeyPageUp:
-					pos.Z += 0.01
-				case g3.KeyPageDown:
-					pos.Z -= 0.01
+				case g3.KeyF2:
+					occlude = !occlude
+				case g3.KeyF3:
+					current = (current + 1) % len(cameras)
 				}
 			}
 		case fe := <-engine.FrameEventChan():
@@ -93,12 +82,33 @@ func multiplexEvents(engine g3.Engine) {
 func initialize(engine g3.Engine) os.Error {
 	gdev := engine.GetGraphicsDevice()
 
-	// Load and create heigh map
-	hmap, err := geo.NewHeightMapFromImageFile("../../../data/heightmaps/map1.png")
+	// Load prebuilt terrain, build and cache it if there is none or it was
+	// built from another height map or with other settings
+	hmap, err := geo.NewHeightMapFromImageFile(terrainSource)
 	if err != nil {
 		return err
 	}
-	geoMipMap = geo.NewGeoMipMap(gdev, hmap, 3, 32, 32, 5, 0.01, 0.3)
+	key := geo.SourceKey(hmap, patchSize, maxLOD, whScale, hScale)
+	geoMipMap, err = geo.LoadGeoMipMap(gdev, terrainCache)
+	if err == nil && geoMipMap.SourceKey() != key {
+		geoMipMap.Release()
+		geoMipMap = nil
+	}
+	if geoMipMap == nil {
+		progress := func(done, total int) {
+			if done == total || done%16 == 0 {
+				log.Printf("building terrain: %d of %d patches", done, total)
+			}
+		}
+		geoMipMap, err = geo.BuildGeoMipMap(gdev, hmap, patchSize, maxLOD, whScale, hScale, &geo.BuildOptions{Progress: progress, SourceKey: key})
+		if err != nil {
+			return err
+		}
+		if err := geoMipMap.Save(terrainCache); err != nil {
+			log.Println("unable to cache terrain:", err)
+		}
+	}
+	occlusion = g3.NewOcclusionBuffer(160, 120)
 
 	// Load and compile shader
 	sources, err := g3.ReadStringsFromFiles("../../../data/shaders/map.vs.glsl", "../../../data/shaders/map.fs.glsl")
@@ -107,6 +117,7 @@ func initialize(engine g3.Engine) os.Error {
 	}
 	mapShader = gdev.NewShader(sources[0], sources[1])
 	gdev.SetShader(mapShader)
+	geoMipMap.SetMorphShader(mapShader)
 
 	// Setup textures
 	images, err := g3.ReadImagesFromFiles("../../../data/textures/stone.jpg", "../../../data/textures/grass.jpg")
@@ -127,9 +138,21 @@ func initialize(engine g3.Engine) os.Error {
 
 	//fmt.Println("locs:", locStone, locGrass, locLight)
 
-	// Setup projection matrix
-	projection = g3.MakePerspectiveMatrix(45.0, 640.0/480.0, 0.001, 100.0)
-	gdev.SetMatrix(g3.MatrixProjection, &projection)
+	// Setup cameras: walk, fly and orbit around the terrain
+	fovy := g3.Deg2Rad(60)
+	fps := camera.NewFPSCamera(g3.Vec3{0, 0, 0.01}, g3.Pi/2, 0)
+	fps.SetPerspective(fovy, 0.001, 100.0)
+	fps.Speed = 0.05
+	fly := camera.NewFlyCamera(g3.Vec3{0, 0, 0.5}, g3.Pi/2, 0)
+	fly.SetPerspective(fovy, 0.001, 100.0)
+	fly.Speed = 0.2
+	orbit := camera.NewOrbitCamera(g3.Vec3{2.5, 2.5, 0}, 3, 0, -g3.Pi/4)
+	orbit.SetPerspective(fovy, 0.001, 100.0)
+	cameras = []camera.Camera{fps, fly, orbit}
+	for _, c := range cameras {
+		c.Resize(640, 480)
+	}
+	geoMipMap.SetLODParams(fovy, 480, 2.0)
 
 	return nil
 }
@@ -142,29 +165,37 @@ func shutdown(engine g3.Engine) {
 }
 
 func update(engine g3.Engine, deltaTime float32) {
-	pos.Accumulate(dir.Scaled(speed))
-
-	center := pos.Add(dir)
-	lookAt := g3.MakeLookAtMatrix(&pos, &center, &up)
-
-	modelView = lookAt
-	modelViewProjection := projection.Multiply(&modelView)
-	frustum = g3.MakeFrustumFromMatrix(&modelViewProjection)
+	cam := cameras[current]
+	cam.Update(deltaTime)
+	frustum = cam.Frustum()
+
+	if occlude {
+		viewProjection := cam.Projection().Multiply(cam.View())
+		occlusion.Clear(&viewProjection)
+		geoMipMap.RasterizeOccluders(occlusion, frustum)
+	}
 }
 
 func render(engine g3.Engine) {
 	gdev := engine.GetGraphicsDevice()
 	gdev.Clear()
 
-	gdev.SetMatrix(g3.MatrixModelView, &modelView)
+	cam := cameras[current]
+	gdev.SetMatrix(g3.MatrixProjection, cam.Projection())
+	gdev.SetMatrix(g3.MatrixModelView, cam.View())
 	gdev.SetShader(mapShader)
 
-	lpos := modelView.Transform(lightPos)
+	eye := cam.Position()
+	lpos := cam.View().Transform(lightPos)
 	mapShader.SetVec3(locLight, &lpos)
 	mapShader.SetTexture(locStone, 0)
 	mapShader.SetTexture(locGrass, 1)
 
-	geoMipMap.Render(gdev, frustum)
+	if occlude {
+		geoMipMap.RenderOccluded(gdev, frustum, &eye, occlusion)
+	} else {
+		geoMipMap.Render(gdev, frustum, &eye)
+	}
 }
 
 func main() {
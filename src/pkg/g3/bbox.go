@@ -9,9 +9,19 @@ type BoundingSphere struct {
 	Radius   float32
 }
 
+// Results of BoundingVolume.ClassifyPlane and Frustum.ClassifyBoundingVolume
+const (
+	ClassifyIntersecting = -1
+	ClassifyOutside      = 0
+	ClassifyInside       = 1
+)
+
 type BoundingVolume interface {
 	ClassifyPoint(v *Vec3) bool
 	ClassifyPlane(p *Plane) int
+	// Axis aligned box enclosing the volume, used by spatial indices and
+	// tests that don't know the volume type.
+	CalculateBoundingBox() BoundingBox
 }
 
 type HasBoundingBox interface {
@@ -56,6 +66,15 @@ func MakeBoundingBoxFromPoints(points []Vec3) BoundingBox {
 	return bbox
 }
 
+// Enclosing box of any bounding volume
+func MakeBoundingBoxFromVolume(bvol BoundingVolume) BoundingBox {
+	return bvol.CalculateBoundingBox()
+}
+
+func (bbox *BoundingBox) CalculateBoundingBox() BoundingBox {
+	return *bbox
+}
+
 func (bbox *BoundingBox) ClassifyPoint(v *Vec3) bool {
 	if v.X > bbox.Min.X && v.X < bbox.Max.X &&
 		v.Y > bbox.Min.Y && v.Y < bbox.Max.Y &&
@@ -65,51 +84,199 @@ func (bbox *BoundingBox) ClassifyPoint(v *Vec3) bool {
 	return false
 }
 
+// Only the corners closest to (n-vertex) and farthest along (p-vertex)
+// the plane normal are tested.
 func (bbox *BoundingBox) ClassifyPlane(p *Plane) int {
-	inside := 0
+	pv, nv := bbox.Max, bbox.Min
+	if p.Normal.X < 0.0 {
+		pv.X, nv.X = bbox.Min.X, bbox.Max.X
+	}
+	if p.Normal.Y < 0.0 {
+		pv.Y, nv.Y = bbox.Min.Y, bbox.Max.Y
+	}
+	if p.Normal.Z < 0.0 {
+		pv.Z, nv.Z = bbox.Min.Z, bbox.Max.Z
+	}
+	if p.DistanceToPoint(&pv) < 0.0 {
+		return ClassifyOutside
+	}
+	if p.DistanceToPoint(&nv) >= 0.0 {
+		return ClassifyInside
+	}
+	return ClassifyIntersecting
+}
+
+func (bbox *BoundingBox) CalculateCenter() Vec3 {
+	return Vec3{(bbox.Min.X+bbox.Max.X)/2, (bbox.Min.Y+bbox.Max.Y)/2, (bbox.Min.Z+bbox.Max.Z)/2}
+}
+
+func (bbox *BoundingBox) ContainsBox(other *BoundingBox) bool {
+	return other.Min.X >= bbox.Min.X && other.Max.X <= bbox.Max.X &&
+		other.Min.Y >= bbox.Min.Y && other.Max.Y <= bbox.Max.Y &&
+		other.Min.Z >= bbox.Min.Z && other.Max.Z <= bbox.Max.Z
+}
+
+// Grows the box so it contains other
+func (bbox *BoundingBox) Extend(other *BoundingBox) {
+	bbox.Min = bbox.Min.Min(other.Min)
+	bbox.Max = bbox.Max.Max(other.Max)
+}
+
+func (bbox *BoundingBox) SurfaceArea() float32 {
+	d := bbox.Max.Sub(bbox.Min)
+	return 2.0 * (d.X*d.Y + d.Y*d.Z + d.Z*d.X)
+}
+
+// Enclosing axis aligned box of the box transformed by m (Arvo's method)
+func (bbox *BoundingBox) Transform(m *Matrix4x4) BoundingBox {
+	min := [3]float32{bbox.Min.X, bbox.Min.Y, bbox.Min.Z}
+	max := [3]float32{bbox.Max.X, bbox.Max.Y, bbox.Max.Z}
+	rows := [3][4]float32{
+		{m.M11, m.M12, m.M13, m.M14},
+		{m.M21, m.M22, m.M23, m.M24},
+		{m.M31, m.M32, m.M33, m.M34}}
+	var rmin, rmax [3]float32
+	for i := 0; i < 3; i++ {
+		rmin[i], rmax[i] = rows[i][3], rows[i][3]
+		for j := 0; j < 3; j++ {
+			a := rows[i][j] * min[j]
+			b := rows[i][j] * max[j]
+			a, b = MinMax(a, b)
+			rmin[i] += a
+			rmax[i] += b
+		}
+	}
+	return BoundingBox{Vec3{rmin[0], rmin[1], rmin[2]}, Vec3{rmax[0], rmax[1], rmax[2]}}
+}
+
+// Point inside or on the box that is closest to v
+func (bbox *BoundingBox) ClosestPoint(v *Vec3) Vec3 {
+	return Vec3{
+		Clamp(v.X, bbox.Min.X, bbox.Max.X),
+		Clamp(v.Y, bbox.Min.Y, bbox.Max.Y),
+		Clamp(v.Z, bbox.Min.Z, bbox.Max.Z)}
+}
+
+func (bbox *BoundingBox) IntersectBox(other *BoundingBox) bool {
+	return bbox.Min.X <= other.Max.X && bbox.Max.X >= other.Min.X &&
+		bbox.Min.Y <= other.Max.Y && bbox.Max.Y >= other.Min.Y &&
+		bbox.Min.Z <= other.Max.Z && bbox.Max.Z >= other.Min.Z
+}
+
+func (bbox *BoundingBox) IntersectSphere(sphere *BoundingSphere) bool {
+	p := bbox.ClosestPoint(&sphere.Position)
+	return p.DistanceSq(sphere.Position) <= sphere.Radius*sphere.Radius
+}
+
+// Bounding spheres
+
+// A sphere with negative radius contains nothing, merging with it yields the other sphere.
+func MakeUndefinedBoundingSphere() BoundingSphere {
+	return BoundingSphere{Vec3{0, 0, 0}, -1}
+}
 
-	v := Vec3{bbox.Min.X, bbox.Min.Y, bbox.Min.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+// Ritter's algorithm, the result is typically 5-20% larger than the minimal sphere.
+func MakeBoundingSphereFromPoints(points []Vec3) BoundingSphere {
+	if len(points) == 0 {
+		return MakeUndefinedBoundingSphere()
 	}
-	v = Vec3{bbox.Min.X, bbox.Min.Y, bbox.Max.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+	// find two points far apart
+	x := points[0]
+	y := farthestPoint(points, &x)
+	z := farthestPoint(points, &y)
+	sphere := BoundingSphere{y.Lerp(z, 0.5), y.Distance(z) / 2}
+
+	// grow the sphere until it contains all points
+	for _, p := range points {
+		d := p.Distance(sphere.Position)
+		if d > sphere.Radius {
+			r := (sphere.Radius + d) / 2
+			sphere.Position = sphere.Position.Add(p.Sub(sphere.Position).Scaled((r - sphere.Radius) / d))
+			sphere.Radius = r
+		}
 	}
-	v = Vec3{bbox.Min.X, bbox.Max.Y, bbox.Min.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+	return sphere
+}
+
+func farthestPoint(points []Vec3, from *Vec3) Vec3 {
+	best, bestDist := points[0], float32(-1)
+	for _, p := range points {
+		if d := p.DistanceSq(*from); d > bestDist {
+			best, bestDist = p, d
+		}
 	}
-	v = Vec3{bbox.Min.X, bbox.Max.Y, bbox.Max.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+	return best
+}
+
+func MakeBoundingSphereFromSpheres(spheres []BoundingSphere) BoundingSphere {
+	sphere := MakeUndefinedBoundingSphere()
+	for i := range spheres {
+		sphere = MergeBoundingSpheres(&sphere, &spheres[i])
 	}
-	v = Vec3{bbox.Max.X, bbox.Min.Y, bbox.Min.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+	return sphere
+}
+
+// Smallest sphere containing a and b
+func MergeBoundingSpheres(a, b *BoundingSphere) BoundingSphere {
+	if a.Radius < 0 {
+		return *b
 	}
-	v = Vec3{bbox.Max.X, bbox.Min.Y, bbox.Max.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+	if b.Radius < 0 {
+		return *a
 	}
-	v = Vec3{bbox.Max.X, bbox.Max.Y, bbox.Min.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+	d := b.Position.Distance(a.Position)
+	if d+b.Radius <= a.Radius {
+		return *a
 	}
-	v = Vec3{bbox.Max.X, bbox.Max.Y, bbox.Max.Z}
-	if p.DistanceToPoint(&v) >= 0.0 {
-		inside++
+	if d+a.Radius <= b.Radius {
+		return *b
 	}
+	r := (d + a.Radius + b.Radius) / 2
+	center := a.Position.Add(b.Position.Sub(a.Position).Scaled((r - a.Radius) / d))
+	return BoundingSphere{center, r}
+}
 
-	if inside == 8 {
-		return 1
-	} else if inside == 0 {
-		return 0
+func MakeBoundingSphereFromBox(bbox *BoundingBox) BoundingSphere {
+	return BoundingSphere{bbox.CalculateCenter(), bbox.Max.Distance(bbox.Min) / 2}
+}
+
+func MakeBoundingBoxFromSphere(sphere *BoundingSphere) BoundingBox {
+	r := Vec3{sphere.Radius, sphere.Radius, sphere.Radius}
+	return BoundingBox{sphere.Position.Sub(r), sphere.Position.Add(r)}
+}
+
+func (sphere *BoundingSphere) CalculateBoundingBox() BoundingBox {
+	return MakeBoundingBoxFromSphere(sphere)
+}
+
+func (sphere *BoundingSphere) ClassifyPoint(v *Vec3) bool {
+	return v.DistanceSq(sphere.Position) < sphere.Radius*sphere.Radius
+}
+
+// The plane has to be normalized.
+func (sphere *BoundingSphere) ClassifyPlane(p *Plane) int {
+	d := p.DistanceToPoint(&sphere.Position)
+	if d >= sphere.Radius {
+		return ClassifyInside
+	} else if d < -sphere.Radius {
+		return ClassifyOutside
 	}
-	return -1
+	return ClassifyIntersecting
 }
 
-func (bbox *BoundingBox) CalculateCenter() Vec3 {
-	return Vec3{(bbox.Min.X+bbox.Max.X)/2, (bbox.Min.Y+bbox.Max.Y)/2, (bbox.Min.Z+bbox.Max.Z)/2}
+func (sphere *BoundingSphere) IntersectSphere(other *BoundingSphere) bool {
+	r := sphere.Radius + other.Radius
+	return sphere.Position.DistanceSq(other.Position) <= r*r
+}
+
+func (sphere *BoundingSphere) IntersectBox(bbox *BoundingBox) bool {
+	return bbox.IntersectSphere(sphere)
 }
 
+func (bbox *BoundingBox) IntersectRay(ray *Ray3) (RayHit, bool) {
+	return ray.IntersectBoundingBox(bbox)
+}
+
+func (sphere *BoundingSphere) IntersectRay(ray *Ray3) (RayHit, bool) {
+	return ray.IntersectBoundingSphere(sphere)
+}
@@ -0,0 +1,227 @@
+package g3
+
+import (
+	"rand"
+	"testing"
+)
+
+var _ BoundingVolume = &BoundingSphere{}
+
+func TestBoundingSphereFromPoints(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	cloud := make([]Vec3, 200)
+	for i := range cloud {
+		// points in the unit ball around 5, 5, 5
+		for {
+			p := Vec3{r.Float32()*2 - 1, r.Float32()*2 - 1, r.Float32()*2 - 1}
+			if p.LengthSq() <= 1 {
+				cloud[i] = p.Add(Vec3{5, 5, 5})
+				break
+			}
+		}
+	}
+	tests := []struct {
+		name    string
+		points  []Vec3
+		minimal float32
+	}{
+		{"single", []Vec3{{1, 2, 3}}, 0},
+		{"pair", []Vec3{{-1, 0, 0}, {3, 0, 0}}, 2},
+		{"cube", []Vec3{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}, {2, 2, 0}, {0, 0, 2}, {2, 0, 2}, {0, 2, 2}, {2, 2, 2}}, Sqrt(3)},
+		{"triangle", []Vec3{{0, 0, 0}, {4, 0, 0}, {2, 3, 0}}, 13.0 / 6},
+		{"cloud", cloud, 1},
+	}
+	for _, test := range tests {
+		sphere := MakeBoundingSphereFromPoints(test.points)
+		for _, p := range test.points {
+			if d := p.Distance(sphere.Position); d > sphere.Radius*(1+1e-5)+1e-6 {
+				t.Errorf("%s: %v outside, distance %f radius %f", test.name, p, d, sphere.Radius)
+			}
+		}
+		if sphere.Radius < test.minimal*(1-1e-5) || sphere.Radius > test.minimal*1.2+1e-6 {
+			t.Errorf("%s: radius %f, minimal %f", test.name, sphere.Radius, test.minimal)
+		}
+	}
+	if sphere := MakeBoundingSphereFromPoints(nil); sphere.Radius >= 0 {
+		t.Errorf("empty set radius %f", sphere.Radius)
+	}
+}
+
+func TestMergeBoundingSpheres(t *testing.T) {
+	undefined := MakeUndefinedBoundingSphere()
+	tests := []struct {
+		name   string
+		a, b   BoundingSphere
+		merged BoundingSphere
+	}{
+		{"disjoint", BoundingSphere{Vec3{0, 0, 0}, 1}, BoundingSphere{Vec3{4, 0, 0}, 1}, BoundingSphere{Vec3{2, 0, 0}, 3}},
+		{"different sizes", BoundingSphere{Vec3{0, 0, 0}, 1}, BoundingSphere{Vec3{0, 4, 0}, 3}, BoundingSphere{Vec3{0, 3, 0}, 4}},
+		{"overlapping", BoundingSphere{Vec3{0, 0, 0}, 2}, BoundingSphere{Vec3{0, 0, 1}, 2}, BoundingSphere{Vec3{0, 0, 0.5}, 2.5}},
+		{"b inside a", BoundingSphere{Vec3{0, 0, 0}, 5}, BoundingSphere{Vec3{1, 1, 1}, 1}, BoundingSphere{Vec3{0, 0, 0}, 5}},
+		{"a inside b", BoundingSphere{Vec3{1, 1, 1}, 1}, BoundingSphere{Vec3{0, 0, 0}, 5}, BoundingSphere{Vec3{0, 0, 0}, 5}},
+		{"identical", BoundingSphere{Vec3{1, 2, 3}, 1}, BoundingSphere{Vec3{1, 2, 3}, 1}, BoundingSphere{Vec3{1, 2, 3}, 1}},
+		{"undefined a", undefined, BoundingSphere{Vec3{1, 2, 3}, 1}, BoundingSphere{Vec3{1, 2, 3}, 1}},
+		{"undefined b", BoundingSphere{Vec3{1, 2, 3}, 1}, undefined, BoundingSphere{Vec3{1, 2, 3}, 1}},
+	}
+	for _, test := range tests {
+		merged := MergeBoundingSpheres(&test.a, &test.b)
+		if !merged.Position.ApproxEqual(test.merged.Position) || !ApproxEqual(merged.Radius, test.merged.Radius) {
+			t.Errorf("%s: %v, want %v", test.name, merged, test.merged)
+		}
+	}
+
+	spheres := []BoundingSphere{{Vec3{0, 0, 0}, 1}, {Vec3{4, 0, 0}, 1}, {Vec3{2, 0, 0}, 0.5}}
+	if s := MakeBoundingSphereFromSpheres(spheres); !s.Position.ApproxEqual(Vec3{2, 0, 0}) || !ApproxEqual(s.Radius, 3) {
+		t.Errorf("from spheres %v", s)
+	}
+	if s := MakeBoundingSphereFromSpheres(nil); s.Radius >= 0 {
+		t.Errorf("from no spheres %v", s)
+	}
+}
+
+func TestBoundingSphereVolume(t *testing.T) {
+	sphere := BoundingSphere{Vec3{1, 0, 0}, 2}
+
+	points := []struct {
+		v      Vec3
+		inside bool
+	}{
+		{Vec3{1, 0, 0}, true},
+		{Vec3{2.9, 0, 0}, true},
+		{Vec3{1, 0, -3.1}, false},
+		{Vec3{2.5, 1.5, 0}, false},
+	}
+	for _, test := range points {
+		if sphere.ClassifyPoint(&test.v) != test.inside {
+			t.Errorf("point %v inside != %v", test.v, test.inside)
+		}
+	}
+
+	planes := []struct {
+		p      Plane
+		result int
+	}{
+		{Plane{Vec3{1, 0, 0}, 1}, ClassifyInside},
+		{Plane{Vec3{1, 0, 0}, 0}, ClassifyIntersecting},
+		{Plane{Vec3{1, 0, 0}, -3}, ClassifyIntersecting},
+		{Plane{Vec3{1, 0, 0}, -3.5}, ClassifyOutside},
+		{Plane{Vec3{0, -1, 0}, 2}, ClassifyInside},
+		{Plane{Vec3{0, -1, 0}, -2.5}, ClassifyOutside},
+	}
+	for i, test := range planes {
+		if result := sphere.ClassifyPlane(&test.p); result != test.result {
+			t.Errorf("plane %d: %d, want %d", i, result, test.result)
+		}
+	}
+
+	spheres := []struct {
+		other     BoundingSphere
+		intersect bool
+	}{
+		{BoundingSphere{Vec3{1, 0, 0}, 0.5}, true},
+		{BoundingSphere{Vec3{5, 0, 0}, 2}, true},
+		{BoundingSphere{Vec3{5.1, 0, 0}, 2}, false},
+		{BoundingSphere{Vec3{1, -4, 0}, 1}, false},
+	}
+	for i, test := range spheres {
+		if sphere.IntersectSphere(&test.other) != test.intersect || test.other.IntersectSphere(&sphere) != test.intersect {
+			t.Errorf("sphere %d: intersect != %v", i, test.intersect)
+		}
+	}
+
+	// conversions enclose the source
+	box := MakeBoundingBoxFromSphere(&sphere)
+	if !box.Min.ApproxEqual(Vec3{-1, -2, -2}) || !box.Max.ApproxEqual(Vec3{3, 2, 2}) {
+		t.Errorf("box of sphere %v", box)
+	}
+	cube := BoundingBox{Vec3{-1, -1, -1}, Vec3{1, 1, 1}}
+	s := MakeBoundingSphereFromBox(&cube)
+	if !s.Position.ApproxEqual(Vec3{}) || !ApproxEqual(s.Radius, Sqrt(3)) {
+		t.Errorf("sphere of box %v", s)
+	}
+}
+
+func boxCorners(bbox *BoundingBox) [8]Vec3 {
+	var corners [8]Vec3
+	for i := range corners {
+		corners[i] = bbox.Min
+		if i&1 != 0 {
+			corners[i].X = bbox.Max.X
+		}
+		if i&2 != 0 {
+			corners[i].Y = bbox.Max.Y
+		}
+		if i&4 != 0 {
+			corners[i].Z = bbox.Max.Z
+		}
+	}
+	return corners
+}
+
+func TestBoundingBoxTransform(t *testing.T) {
+	bbox := BoundingBox{Vec3{-1, 0, 2}, Vec3{3, 1, 5}}
+	tests := []struct {
+		name string
+		m    Matrix4x4
+	}{
+		{"identity", MakeIdentityMatrix()},
+		{"translation", MakeTranslationMatrix(1, -2, 3)},
+		{"mirror", MakeScaleMatrix(-1, 2, -0.5)},
+		{"rotation", MakeRotationMatrix(Vec3{0, 0, 1}, Pi/4)},
+		{"trs", composeMatrix(Vec3{4, 5, 6}, MakeQuaternionFromEuler(0.3, -1, 2), Vec3{2, 0.5, 1})},
+		{"shear", Matrix4x4{1, 0.5, 0, 0, 0, 1, -2, 1, 0.3, 0, 1, 0, 0, 0, 0, 1}},
+	}
+	for _, test := range tests {
+		// Arvo's result is exactly the box of the transformed corners
+		corners := boxCorners(&bbox)
+		for i := range corners {
+			corners[i] = test.m.Transform(corners[i])
+		}
+		want := MakeBoundingBoxFromPoints(corners[:])
+		got := bbox.Transform(&test.m)
+		if !got.Min.ApproxEqualEps(want.Min, 1e-5) || !got.Max.ApproxEqualEps(want.Max, 1e-5) {
+			t.Errorf("%s: %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestBoundingBoxIntersect(t *testing.T) {
+	bbox := BoundingBox{Vec3{0, 0, 0}, Vec3{2, 2, 2}}
+	boxes := []struct {
+		other     BoundingBox
+		intersect bool
+	}{
+		{BoundingBox{Vec3{0.5, 0.5, 0.5}, Vec3{1, 1, 1}}, true},
+		{BoundingBox{Vec3{-1, -1, -1}, Vec3{3, 3, 3}}, true},
+		{BoundingBox{Vec3{1, 1, 1}, Vec3{3, 3, 3}}, true},
+		{BoundingBox{Vec3{2, 0, 0}, Vec3{3, 1, 1}}, true},
+		{BoundingBox{Vec3{2.1, 0, 0}, Vec3{3, 1, 1}}, false},
+		{BoundingBox{Vec3{0, -3, 0}, Vec3{1, -0.1, 1}}, false},
+		{BoundingBox{Vec3{0, 0, 3}, Vec3{1, 1, 4}}, false},
+	}
+	for i, test := range boxes {
+		if bbox.IntersectBox(&test.other) != test.intersect || test.other.IntersectBox(&bbox) != test.intersect {
+			t.Errorf("box %d: intersect != %v", i, test.intersect)
+		}
+	}
+
+	spheres := []struct {
+		sphere    BoundingSphere
+		intersect bool
+	}{
+		{BoundingSphere{Vec3{1, 1, 1}, 0.1}, true},
+		{BoundingSphere{Vec3{1, 1, 1}, 10}, true},
+		{BoundingSphere{Vec3{3, 1, 1}, 1}, true},
+		{BoundingSphere{Vec3{3.1, 1, 1}, 1}, false},
+		// near a corner only the true distance counts, not the per axis one
+		{BoundingSphere{Vec3{3, 3, 1}, 1.2}, false},
+		{BoundingSphere{Vec3{3, 3, 1}, 1.5}, true},
+		{BoundingSphere{Vec3{-1, -1, -1}, 1.7}, false},
+		{BoundingSphere{Vec3{-1, -1, -1}, 1.8}, true},
+	}
+	for i, test := range spheres {
+		if bbox.IntersectSphere(&test.sphere) != test.intersect || test.sphere.IntersectBox(&bbox) != test.intersect {
+			t.Errorf("sphere %d: intersect != %v", i, test.intersect)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package g3
+
+// Bounding volume hierarchies. MeshBVH is built once over the triangles
+// of a static mesh using the surface area heuristic (SAH), DynamicBVH
+// holds moving objects and is refitted and rotated incrementally.
+// Both can be used for rendering (frustum traversal) and picking (ray casts).
+
+type bvhNode struct {
+	bbox     BoundingBox
+	parent   *bvhNode
+	children [2]*bvhNode
+	elements []SpatElement
+	data     interface{}
+}
+
+func (node *bvhNode) isLeaf() bool {
+	return node.children[0] == nil
+}
+
+func (node *bvhNode) setChildren(a, b *bvhNode) {
+	node.children[0], node.children[1] = a, b
+	node.elements = []SpatElement{a, b}
+	a.parent, b.parent = node, node
+}
+
+func (node *bvhNode) GetBoundingVolume() BoundingVolume {
+	return &node.bbox
+}
+
+func (node *bvhNode) GetParent() SpatElement {
+	if node.parent == nil {
+		return nil
+	}
+	return node.parent
+}
+
+func (node *bvhNode) GetChildren() []SpatElement {
+	return node.elements
+}
+
+// MeshBVH leaves return their triangles as []uint32 (three indices each),
+// DynamicBVH leaves return their SpatObject.
+func (node *bvhNode) GetData() interface{} {
+	if item, ok := node.data.(*BVHItem); ok {
+		return item.Object
+	}
+	return node.data
+}
+
+func (node *bvhNode) TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc) {
+	var coherency FrustumCoherency
+	node.TraverseFrustumMasked(frustum, FrustumPlanesAll, &coherency, traverseFunc)
+}
+
+func (node *bvhNode) TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc) {
+	if planeMask != FrustumPlaneNone {
+		result, mask := coherency.classify(frustum, node, &node.bbox, planeMask)
+		if result == ClassifyOutside {
+			return
+		}
+		planeMask = mask
+	}
+	if traverseFunc(node, node.isLeaf()) && !node.isLeaf() {
+		node.children[0].TraverseFrustumMasked(frustum, planeMask, coherency, traverseFunc)
+		node.children[1].TraverseFrustumMasked(frustum, planeMask, coherency, traverseFunc)
+	}
+}
+
+func (node *bvhNode) CastRay(ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool) {
+	return RayCast(node, ray, hitFunc)
+}
+
+// Static mesh BVH
+
+const bvhBins = 16
+
+type MeshBVH struct {
+	Vertices []Vec3
+	// triangles reordered so that the triangles of each leaf are contiguous
+	Indices []uint32
+	root    *bvhNode
+}
+
+type bvhBuildInfo struct {
+	bboxes    []BoundingBox
+	centroids []Vec3
+	order     []int
+	maxLeaf   int
+}
+
+// Builds the hierarchy over the triangle list given by indices. Leaves hold
+// at most maxLeafTriangles triangles. indices is not modified.
+func NewMeshBVH(vertices []Vec3, indices []uint32, maxLeafTriangles int) *MeshBVH {
+	num := len(indices) / 3
+	info := &bvhBuildInfo{make([]BoundingBox, num), make([]Vec3, num), make([]int, num), maxLeafTriangles}
+	if info.maxLeaf < 1 {
+		info.maxLeaf = 1
+	}
+	for i := 0; i < num; i++ {
+		tri := []Vec3{vertices[indices[i*3]], vertices[indices[i*3+1]], vertices[indices[i*3+2]]}
+		info.bboxes[i] = MakeBoundingBoxFromPoints(tri)
+		info.centroids[i] = info.bboxes[i].CalculateCenter()
+		info.order[i] = i
+	}
+
+	bvh := &MeshBVH{vertices, make([]uint32, len(indices)), nil}
+	bvh.root = bvh.build(info, 0, num)
+	for i, t := range info.order {
+		copy(bvh.Indices[i*3:i*3+3], indices[t*3:t*3+3])
+	}
+	bvh.setLeafData(bvh.root)
+	return bvh
+}
+
+func (bvh *MeshBVH) build(info *bvhBuildInfo, first, count int) *bvhNode {
+	node := &bvhNode{bbox: MakeUndefinedBoundingBox()}
+	centroidBox := MakeUndefinedBoundingBox()
+	for _, t := range info.order[first : first+count] {
+		node.bbox.Extend(&info.bboxes[t])
+		c := BoundingBox{info.centroids[t], info.centroids[t]}
+		centroidBox.Extend(&c)
+	}
+	// leaves temporarily store their triangle range
+	node.data = [2]int{first, count}
+	if count <= info.maxLeaf {
+		return node
+	}
+
+	axis, split := bvh.findSAHSplit(info, first, count, &centroidBox)
+	mid := first
+	if axis >= 0 {
+		// partition by bin
+		order := info.order[first : first+count]
+		min, extent := vec3Component(centroidBox.Min, axis), vec3Component(centroidBox.Max.Sub(centroidBox.Min), axis)
+		for i := range order {
+			if centroidBin(vec3Component(info.centroids[order[i]], axis), min, extent) < split {
+				order[i], order[mid-first] = order[mid-first], order[i]
+				mid++
+			}
+		}
+	}
+	if mid == first || mid == first+count {
+		// all centroids in one spot, split by count
+		mid = first + count/2
+	}
+
+	node.setChildren(bvh.build(info, first, mid-first), bvh.build(info, mid, first+count-mid))
+	node.data = nil
+	return node
+}
+
+func vec3Component(v Vec3, axis int) float32 {
+	switch axis {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	}
+	return v.Z
+}
+
+func centroidBin(c, min, extent float32) int {
+	b := int(float32(bvhBins) * (c - min) / extent)
+	if b >= bvhBins {
+		b = bvhBins - 1
+	}
+	if b < 0 {
+		b = 0
+	}
+	return b
+}
+
+// Binned SAH. Returns the axis and the first bin of the right side, axis is -1 if no split helps.
+func (bvh *MeshBVH) findSAHSplit(info *bvhBuildInfo, first, count int, centroidBox *BoundingBox) (int, int) {
+	bestAxis, bestSplit := -1, 0
+	bestCost := float32(MathMax)
+	for axis := 0; axis < 3; axis++ {
+		min := vec3Component(centroidBox.Min, axis)
+		extent := vec3Component(centroidBox.Max, axis) - min
+		if extent <= Epsilon {
+			continue
+		}
+		var boxes [bvhBins]BoundingBox
+		var counts [bvhBins]int
+		for i := range boxes {
+			boxes[i] = MakeUndefinedBoundingBox()
+		}
+		for _, t := range info.order[first : first+count] {
+			b := centroidBin(vec3Component(info.centroids[t], axis), min, extent)
+			boxes[b].Extend(&info.bboxes[t])
+			counts[b]++
+		}
+
+		// sweep from the right, then evaluate the splits from the left
+		var rightArea [bvhBins]float32
+		var rightCount [bvhBins]int
+		right := MakeUndefinedBoundingBox()
+		n := 0
+		for i := bvhBins - 1; i > 0; i-- {
+			right.Extend(&boxes[i])
+			n += counts[i]
+			rightCount[i] = n
+			if n > 0 {
+				rightArea[i] = right.SurfaceArea()
+			}
+		}
+		left := MakeUndefinedBoundingBox()
+		n = 0
+		for i := 1; i < bvhBins; i++ {
+			left.Extend(&boxes[i-1])
+			n += counts[i-1]
+			if n == 0 || rightCount[i] == 0 {
+				continue
+			}
+			cost := left.SurfaceArea()*float32(n) + rightArea[i]*float32(rightCount[i])
+			if cost < bestCost {
+				bestAxis, bestSplit, bestCost = axis, i, cost
+			}
+		}
+	}
+	return bestAxis, bestSplit
+}
+
+func (bvh *MeshBVH) setLeafData(node *bvhNode) {
+	if !node.isLeaf() {
+		bvh.setLeafData(node.children[0])
+		bvh.setLeafData(node.children[1])
+		return
+	}
+	r := node.data.([2]int)
+	node.data = bvh.Indices[r[0]*3 : (r[0]+r[1])*3]
+}
+
+func (bvh *MeshBVH) GetRoot() SpatElement {
+	return bvh.root
+}
+
+func (bvh *MeshBVH) TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc) {
+	bvh.root.TraverseFrustum(frustum, traverseFunc)
+}
+
+func (bvh *MeshBVH) TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc) {
+	bvh.root.TraverseFrustumMasked(frustum, planeMask, coherency, traverseFunc)
+}
+
+// Nearest triangle hit in a leaf
+func (bvh *MeshBVH) intersectLeaf(element SpatElement, ray *Ray3) (RayHit, bool) {
+	indices := element.GetData().([]uint32)
+	best := RayHit{Distance: MathMax}
+	found := false
+	for i := 0; i+2 < len(indices); i += 3 {
+		hit, ok := ray.IntersectTriangle(&bvh.Vertices[indices[i]], &bvh.Vertices[indices[i+1]], &bvh.Vertices[indices[i+2]])
+		if ok && hit.Distance < best.Distance {
+			best, found = hit, true
+		}
+	}
+	return best, found
+}
+
+// If hitFunc is nil the triangles of the leaves are tested.
+func (bvh *MeshBVH) CastRay(ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool) {
+	if hitFunc == nil {
+		hitFunc = func(element SpatElement, ray *Ray3) (RayHit, bool) {
+			return bvh.intersectLeaf(element, ray)
+		}
+	}
+	return RayCast(bvh.root, ray, hitFunc)
+}
+
+// Dynamic BVH
+
+// Handle of an object stored in a DynamicBVH
+type BVHItem struct {
+	Object SpatObject
+	leaf   *bvhNode
+}
+
+type DynamicBVH struct {
+	margin float32
+	root   *bvhNode
+	count  int
+}
+
+// Leaf boxes are enlarged by margin, objects moving inside of them don't change the tree.
+func NewDynamicBVH(margin float32) *DynamicBVH {
+	return &DynamicBVH{margin, nil, 0}
+}
+
+func (bvh *DynamicBVH) fatBox(object SpatObject) BoundingBox {
+	bbox := MakeBoundingBoxFromVolume(object.GetBoundingVolume())
+	m := Vec3{bvh.margin, bvh.margin, bvh.margin}
+	return BoundingBox{bbox.Min.Sub(m), bbox.Max.Add(m)}
+}
+
+// Root of the hierarchy, nil if it is empty
+func (bvh *DynamicBVH) GetRoot() SpatElement {
+	if bvh.root == nil {
+		return nil
+	}
+	return bvh.root
+}
+
+func (bvh *DynamicBVH) Len() int {
+	return bvh.count
+}
+
+func (bvh *DynamicBVH) Insert(object SpatObject) *BVHItem {
+	item := &BVHItem{object, nil}
+	item.leaf = &bvhNode{bbox: bvh.fatBox(object), data: item}
+	bvh.insertLeaf(item.leaf)
+	bvh.count++
+	return item
+}
+
+func (bvh *DynamicBVH) Remove(item *BVHItem) {
+	if item.leaf == nil {
+		return
+	}
+	bvh.removeLeaf(item.leaf)
+	item.leaf = nil
+	bvh.count--
+}
+
+// Has to be called after the bounding volume of the object changed. The leaf
+// is only refitted if the object left its enlarged box, the ancestors are
+// refitted and rotated on the way up. Returns true if the tree changed.
+func (bvh *DynamicBVH) Update(item *BVHItem) bool {
+	bbox := MakeBoundingBoxFromVolume(item.Object.GetBoundingVolume())
+	if item.leaf == nil || item.leaf.bbox.ContainsBox(&bbox) {
+		return false
+	}
+	item.leaf.bbox = bvh.fatBox(item.Object)
+	bvh.refit(item.leaf.parent)
+	return true
+}
+
+// sibling selection with the increase in surface area as cost (as in Box2D)
+func (bvh *DynamicBVH) insertLeaf(leaf *bvhNode) {
+	if bvh.root == nil {
+		bvh.root = leaf
+		leaf.parent = nil
+		return
+	}
+
+	sibling := bvh.root
+	for !sibling.isLeaf() {
+		combined := sibling.bbox
+		combined.Extend(&leaf.bbox)
+		area := sibling.bbox.SurfaceArea()
+		combinedArea := combined.SurfaceArea()
+		// cost of a new parent here, and the cost pushed down to the children
+		cost := 2.0 * combinedArea
+		inherited := 2.0 * (combinedArea - area)
+
+		childCost := func(child *bvhNode) float32 {
+			b := child.bbox
+			b.Extend(&leaf.bbox)
+			if child.isLeaf() {
+				return b.SurfaceArea() + inherited
+			}
+			return b.SurfaceArea() - child.bbox.SurfaceArea() + inherited
+		}
+		cost0, cost1 := childCost(sibling.children[0]), childCost(sibling.children[1])
+		if cost < cost0 && cost < cost1 {
+			break
+		}
+		if cost0 < cost1 {
+			sibling = sibling.children[0]
+		} else {
+			sibling = sibling.children[1]
+		}
+	}
+
+	oldParent := sibling.parent
+	parent := &bvhNode{bbox: sibling.bbox, parent: oldParent}
+	parent.bbox.Extend(&leaf.bbox)
+	if oldParent == nil {
+		bvh.root = parent
+	} else {
+		oldParent.replaceChild(sibling, parent)
+	}
+	parent.setChildren(sibling, leaf)
+	bvh.refit(parent.parent)
+}
+
+func (node *bvhNode) replaceChild(old, child *bvhNode) {
+	for i := range node.children {
+		if node.children[i] == old {
+			node.children[i] = child
+			node.elements[i] = child
+			child.parent = node
+			return
+		}
+	}
+	panic("not a child")
+}
+
+func (node *bvhNode) sibling(child *bvhNode) *bvhNode {
+	if node.children[0] == child {
+		return node.children[1]
+	}
+	return node.children[0]
+}
+
+func (bvh *DynamicBVH) removeLeaf(leaf *bvhNode) {
+	if leaf == bvh.root {
+		bvh.root = nil
+		return
+	}
+	parent := leaf.parent
+	sibling := parent.sibling(leaf)
+	grandParent := parent.parent
+	if grandParent == nil {
+		bvh.root = sibling
+		sibling.parent = nil
+	} else {
+		grandParent.replaceChild(parent, sibling)
+		bvh.refit(grandParent)
+	}
+	leaf.parent = nil
+}
+
+// Recomputes the boxes from node up to the root and rotates on the way.
+func (bvh *DynamicBVH) refit(node *bvhNode) {
+	for ; node != nil; node = node.parent {
+		node.bbox = node.children[0].bbox
+		node.bbox.Extend(&node.children[1].bbox)
+		node.rotate()
+	}
+}
+
+// Swaps a child with a grandchild on the other side if that reduces the
+// surface area of the other child (Kopta et al., "Fast, Effective BVH
+// Updates for Animated Scenes").
+func (node *bvhNode) rotate() {
+	bestArea := float32(0.0)
+	var bestChild, bestGrandChild *bvhNode
+	for i := 0; i < 2; i++ {
+		child, other := node.children[i], node.children[1-i]
+		if other.isLeaf() {
+			continue
+		}
+		area := other.bbox.SurfaceArea()
+		for j := 0; j < 2; j++ {
+			// other keeps its child 1-j and gets child instead of child j
+			b := child.bbox
+			b.Extend(&other.children[1-j].bbox)
+			if gain := area - b.SurfaceArea(); gain > bestArea {
+				bestArea, bestChild, bestGrandChild = gain, child, other.children[j]
+			}
+		}
+	}
+	if bestChild == nil {
+		return
+	}
+	other := node.sibling(bestChild)
+	node.replaceChild(bestChild, bestGrandChild)
+	other.replaceChild(bestGrandChild, bestChild)
+	other.bbox = other.children[0].bbox
+	other.bbox.Extend(&other.children[1].bbox)
+}
+
+// Refits every leaf to its object and rebuilds all inner boxes. Cheaper than
+// many single updates when most objects moved, but the tree quality degrades
+// over time since nothing is restructured.
+func (bvh *DynamicBVH) RefitAll() {
+	if bvh.root != nil {
+		bvh.refitAllRec(bvh.root)
+	}
+}
+
+func (bvh *DynamicBVH) refitAllRec(node *bvhNode) {
+	if node.isLeaf() {
+		bbox := MakeBoundingBoxFromVolume(node.data.(*BVHItem).Object.GetBoundingVolume())
+		if !node.bbox.ContainsBox(&bbox) {
+			node.bbox = bvh.fatBox(node.data.(*BVHItem).Object)
+		}
+		return
+	}
+	bvh.refitAllRec(node.children[0])
+	bvh.refitAllRec(node.children[1])
+	node.bbox = node.children[0].bbox
+	node.bbox.Extend(&node.children[1].bbox)
+}
+
+func (bvh *DynamicBVH) TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc) {
+	if bvh.root != nil {
+		bvh.root.TraverseFrustum(frustum, traverseFunc)
+	}
+}
+
+func (bvh *DynamicBVH) TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc) {
+	if bvh.root != nil {
+		bvh.root.TraverseFrustumMasked(frustum, planeMask, coherency, traverseFunc)
+	}
+}
+
+// If hitFunc is nil the bounding volumes of the objects are tested.
+func (bvh *DynamicBVH) CastRay(ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool) {
+	if bvh.root == nil {
+		return nil, RayHit{}, false
+	}
+	if hitFunc == nil {
+		hitFunc = func(element SpatElement, ray *Ray3) (RayHit, bool) {
+			object := element.GetData().(SpatObject)
+			if ri, ok := object.GetBoundingVolume().(RayIntersector); ok {
+				return ri.IntersectRay(ray)
+			}
+			return RayHit{}, false
+		}
+	}
+	return RayCast(bvh.root, ray, hitFunc)
+}
@@ -0,0 +1,105 @@
+package g3
+
+import (
+	"rand"
+	"testing"
+)
+
+func randomTriangles(r *rand.Rand, n int) ([]Vec3, []uint32) {
+	vertices := make([]Vec3, 0, n*3)
+	indices := make([]uint32, 0, n*3)
+	for i := 0; i < n; i++ {
+		c := Vec3{r.Float32() * 100, r.Float32() * 100, r.Float32() * 100}
+		for j := 0; j < 3; j++ {
+			indices = append(indices, uint32(len(vertices)))
+			vertices = append(vertices, c.Add(Vec3{r.Float32() * 4, r.Float32() * 4, r.Float32() * 4}))
+		}
+	}
+	return vertices, indices
+}
+
+func countLeafObjects(bvh *DynamicBVH, frustum *Frustum) int {
+	visible := 0
+	bvh.TraverseFrustum(frustum, func(element SpatElement, leaf bool) bool {
+		if leaf && frustum.ClipBoundingVolume(element.GetData().(SpatObject).GetBoundingVolume()) {
+			visible++
+		}
+		return true
+	})
+	return visible
+}
+
+func TestMeshBVHRayCast(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	vertices, indices := randomTriangles(r, 2000)
+	bvh := NewMeshBVH(vertices, indices, 4)
+
+	for i := 0; i < 100; i++ {
+		ray := Ray3{Vec3{-10, r.Float32() * 100, r.Float32() * 100}, Vec3{1, r.Float32() - 0.5, r.Float32() - 0.5}}
+		expected := RayHit{Distance: MathMax}
+		for j := 0; j < len(indices); j += 3 {
+			hit, ok := ray.IntersectTriangle(&vertices[indices[j]], &vertices[indices[j+1]], &vertices[indices[j+2]])
+			if ok && hit.Distance < expected.Distance {
+				expected = hit
+			}
+		}
+		_, hit, ok := bvh.CastRay(&ray, nil)
+		if ok != (expected.Distance < MathMax) || (ok && !ApproxEqualEps(hit.Distance, expected.Distance, 1e-4)) {
+			t.Errorf("ray %d: hit %v %v, expected %v", i, ok, hit, expected)
+		}
+	}
+}
+
+func TestDynamicBVH(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	bvh := NewDynamicBVH(1.0)
+	objects := randomTestObjects(r, 300)
+	items := make([]*BVHItem, len(objects))
+	for i, o := range objects {
+		items[i] = bvh.Insert(o)
+	}
+
+	eye, center, up := Vec3{-10, -10, 50}, Vec3{50, 50, 50}, Vec3{0, 0, 1}
+	projection := MakePerspectiveMatrix(Deg2Rad(40), 1.0, 1.0, 100.0)
+	view := MakeLookAtMatrix(&eye, &center, &up)
+	frustum := MakeFrustumFromCamera(&projection, &view)
+
+	check := func(name string, objects []*testObject) {
+		expected := 0
+		for _, o := range objects {
+			if frustum.ClipSphere(&o.sphere) {
+				expected++
+			}
+		}
+		if visible := countLeafObjects(bvh, frustum); visible != expected || bvh.Len() != len(objects) {
+			t.Errorf("%s: %d of %d objects visible, expected %d of %d", name, visible, bvh.Len(), expected, len(objects))
+		}
+	}
+	check("inserted", objects)
+
+	for i := range objects {
+		objects[i].sphere.Position.Accumulate(Vec3{r.Float32()*20 - 10, r.Float32()*20 - 10, 0})
+		bvh.Update(items[i])
+	}
+	check("updated", objects)
+
+	for i := 0; i < len(objects); i += 2 {
+		bvh.Remove(items[i])
+	}
+	remaining := make([]*testObject, 0)
+	for i := 1; i < len(objects); i += 2 {
+		remaining = append(remaining, objects[i])
+	}
+	check("removed", remaining)
+
+	ray := Ray3{Vec3{-10, 50, 50}, Vec3{1, 0, 0}}
+	nearestDist := float32(MathMax)
+	for _, o := range remaining {
+		if hit, ok := ray.IntersectBoundingSphere(&o.sphere); ok && hit.Distance < nearestDist {
+			nearestDist = hit.Distance
+		}
+	}
+	if _, hit, ok := bvh.CastRay(&ray, nil); ok != (nearestDist < MathMax) || (ok && !ApproxEqual(hit.Distance, nearestDist)) {
+		t.Errorf("CastRay: got %v, expected distance %f", hit, nearestDist)
+	}
+}
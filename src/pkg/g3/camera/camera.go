@@ -0,0 +1,125 @@
+package camera
+
+import (
+	"g3"
+)
+
+// Cameras provide the view and projection matrices and the frustum of a
+// view. Controllers are fed with engine events and updated once per frame.
+type Camera interface {
+	View() *g3.Matrix4x4
+	Projection() *g3.Matrix4x4
+	// Calculated from the current matrices on each call
+	Frustum() *g3.Frustum
+	Position() g3.Vec3
+	// Has to be called when the viewport changes, adapts the aspect ratio
+	Resize(width, height int)
+	HandleMouseEvent(me *g3.MouseEvent)
+	HandleKeyEvent(ke *g3.KeyEvent)
+	Update(deltaTime float32)
+}
+
+// Projection part of a camera, perspective or orthographic. The aspect
+// ratio is 1 until the first Resize.
+type Lens struct {
+	orthographic bool
+	fovy         float32
+	height       float32
+	near, far    float32
+	aspect       float32
+	projection   g3.Matrix4x4
+}
+
+func (l *Lens) update() {
+	if l.aspect <= 0 {
+		l.aspect = 1
+	}
+	if l.orthographic {
+		w := l.height * l.aspect
+		l.projection = g3.MakeOrthographicMatrix(-w/2, w/2, -l.height/2, l.height/2, l.near, l.far)
+	} else {
+		l.projection = g3.MakePerspectiveMatrix(l.fovy, l.aspect, l.near, l.far)
+	}
+}
+
+// fovy is the vertical field of view in radians
+func (l *Lens) SetPerspective(fovy, near, far float32) {
+	l.orthographic, l.fovy, l.near, l.far = false, fovy, near, far
+	l.update()
+}
+
+// height of the view volume in world units
+func (l *Lens) SetOrthographic(height, near, far float32) {
+	l.orthographic, l.height, l.near, l.far = true, height, near, far
+	l.update()
+}
+
+func (l *Lens) IsOrthographic() bool {
+	return l.orthographic
+}
+
+func (l *Lens) FieldOfView() float32 {
+	return l.fovy
+}
+
+func (l *Lens) Height() float32 {
+	return l.height
+}
+
+func (l *Lens) Aspect() float32 {
+	return l.aspect
+}
+
+func (l *Lens) Resize(width, height int) {
+	if height > 0 {
+		l.aspect = float32(width) / float32(height)
+		l.update()
+	}
+}
+
+func (l *Lens) Projection() *g3.Matrix4x4 {
+	return &l.projection
+}
+
+// Lens and view matrix shared by all cameras
+type viewer struct {
+	Lens
+	position g3.Vec3
+	view     g3.Matrix4x4
+}
+
+func (v *viewer) lookAt(eye, center, up g3.Vec3) {
+	v.position = eye
+	v.view = g3.MakeLookAtMatrix(&eye, &center, &up)
+}
+
+func (v *viewer) View() *g3.Matrix4x4 {
+	return &v.view
+}
+
+func (v *viewer) Position() g3.Vec3 {
+	return v.position
+}
+
+func (v *viewer) Frustum() *g3.Frustum {
+	return g3.MakeFrustumFromCamera(&v.projection, &v.view)
+}
+
+// Rotation of the base vectors for a z up world, yaw around z and pitch
+// around x. With zero angles the view direction is y.
+func yawPitchMatrix(yaw, pitch float32) g3.Matrix4x4 {
+	lr := g3.MakeZRotationMatrix(yaw)
+	ud := g3.MakeXRotationMatrix(pitch)
+	return lr.Multiply(&ud)
+}
+
+const maxPitch = g3.Pi/2 - 0.01
+
+// Fraction of the remaining distance covered in deltaTime. The distance
+// halves smoothing times per second, no smoothing if smoothing <= 0.
+func smoothFactor(smoothing, deltaTime float32) float32 {
+	if smoothing <= 0 {
+		return 1
+	}
+	return 1 - g3.Pow(0.5, smoothing*deltaTime)
+}
@@ -0,0 +1,129 @@
+package camera
+
+import (
+	"g3"
+	"math"
+	"testing"
+)
+
+func press(c Camera, key uint32) {
+	c.HandleKeyEvent(&g3.KeyEvent{key, g3.KeyPressed})
+}
+
+func release(c Camera, key uint32) {
+	c.HandleKeyEvent(&g3.KeyEvent{key, g3.KeyReleased})
+}
+
+// the point in front of the camera has to end up on the negative z axis
+func expectLookingAt(t *testing.T, name string, c Camera, p g3.Vec3) {
+	v := c.View().Transform(p)
+	d := c.Position().Distance(p)
+	if !v.ApproxEqualEps(g3.Vec3{0, 0, -d}, 1e-4) {
+		t.Errorf("%s: %v in view space, expected %v", name, v, g3.Vec3{0, 0, -d})
+	}
+	if !c.Frustum().ClipSphere(&g3.BoundingSphere{p, 0.01}) {
+		t.Errorf("%s: %v not in frustum", name, p)
+	}
+}
+
+func TestFPSCamera(t *testing.T) {
+	c := NewFPSCamera(g3.Vec3{0, 0, 2}, 0, 0)
+	c.Resize(640, 480)
+	expectLookingAt(t, "initial", c, g3.Vec3{0, 10, 2})
+
+	press(c, g3.KeyW)
+	c.Update(0.5)
+	c.Update(0.5)
+	release(c, g3.KeyW)
+	c.Update(1)
+	if p := c.Position(); !p.ApproxEqual(g3.Vec3{0, 1, 2}) {
+		t.Errorf("at %v after walking forward", p)
+	}
+
+	// looking up doesn't change the walking direction
+	c.HandleMouseEvent(&g3.MouseEvent{Dx: int32(-g3.Pi / 2 / c.Sensitivity), Dy: -50})
+	press(c, g3.KeyW)
+	c.Update(1)
+	if p := c.Position(); !p.ApproxEqualEps(g3.Vec3{-1, 1, 2}, 1e-2) {
+		t.Errorf("at %v after turning left", p)
+	}
+}
+
+func TestFlyCamera(t *testing.T) {
+	c := NewFlyCamera(g3.Vec3{}, 0, g3.Pi/4)
+	c.Resize(640, 480)
+	press(c, g3.KeyW)
+	for i := 0; i < 100; i++ {
+		c.Update(0.05)
+	}
+	expected := g3.Vec3{0, 1, 1}.Normalized()
+	if !c.velocity.ApproxEqualEps(expected, 1e-3) {
+		t.Errorf("velocity %v, expected %v", c.velocity, expected)
+	}
+	expectLookingAt(t, "fly", c, c.Position().Add(expected))
+}
+
+func TestOrbitCameras(t *testing.T) {
+	target := g3.Vec3{5, 5, 0}
+	orbit := NewOrbitCamera(target, 10, 0.3, -0.5)
+	orbit.Resize(640, 480)
+	orbit.HandleMouseEvent(&g3.MouseEvent{Dx: 30, Dy: 20, Button: g3.MouseButtonLeft})
+	orbit.Update(0)
+	expectLookingAt(t, "orbit", orbit, target)
+	if d := orbit.Position().Distance(target); !g3.ApproxEqualEps(d, 10, 1e-4) {
+		t.Errorf("orbit: distance %f", d)
+	}
+
+	arcball := NewArcballCamera(target, 10)
+	arcball.Resize(640, 480)
+	arcball.HandleMouseEvent(&g3.MouseEvent{X: 400, Y: 200, Dx: 80, Dy: 40, Button: g3.MouseButtonLeft})
+	press(arcball, g3.KeyW)
+	arcball.Update(1)
+	expectLookingAt(t, "arcball", arcball, target)
+	if d := arcball.Position().Distance(target); !g3.ApproxEqualEps(d, 5, 1e-4) {
+		t.Errorf("arcball: distance %f after zooming", d)
+	}
+	// dragging to the right moves the camera to the left
+	if p := arcball.Position(); p.X >= target.X {
+		t.Errorf("arcball: at %v after dragging right", p)
+	}
+}
+
+func TestOrthographicCamera(t *testing.T) {
+	c := NewOrthographicCamera(g3.Vec3{10, 10, 0}, 20, 100, 200)
+	c.Resize(400, 200)
+	expectLookingAt(t, "ortho", c, g3.Vec3{10, 10, 0})
+	if !c.Frustum().ClipSphere(&g3.BoundingSphere{g3.Vec3{29, 10, 0}, 0.1}) ||
+		c.Frustum().ClipSphere(&g3.BoundingSphere{g3.Vec3{10, 21, 0}, 0.1}) {
+		t.Error("ortho: wrong view volume")
+	}
+	c.HandleMouseEvent(&g3.MouseEvent{Dx: 10, Dy: 20, Button: g3.MouseButtonLeft})
+	c.Update(0)
+	if p := c.Center(); !p.ApproxEqual(g3.Vec3{9, 12, 0}) {
+		t.Errorf("ortho: center %v after dragging", p)
+	}
+}
+
+func TestFrustumBeforeResize(t *testing.T) {
+	cameras := []struct {
+		name string
+		c    Camera
+	}{
+		{"fps", NewFPSCamera(g3.Vec3{0, 0, 2}, 0, 0)},
+		{"fly", NewFlyCamera(g3.Vec3{0, 0, 2}, 0, 0)},
+		{"orbit", NewOrbitCamera(g3.Vec3{}, 10, 0, 0.5)},
+		{"arcball", NewArcballCamera(g3.Vec3{}, 10)},
+		{"ortho", NewOrthographicCamera(g3.Vec3{}, 20, 100, 200)},
+	}
+	for _, test := range cameras {
+		f := test.c.Frustum()
+		for i, p := range []g3.Plane{f.Left, f.Right, f.Top, f.Bottom, f.Near, f.Far} {
+			for _, x := range []float32{p.Normal.X, p.Normal.Y, p.Normal.Z, p.Distance} {
+				if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+					t.Errorf("%s: plane %d is %v before Resize", test.name, i, p)
+					break
+				}
+			}
+		}
+	}
+}
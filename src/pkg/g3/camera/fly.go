@@ -0,0 +1,58 @@
+package camera
+
+import (
+	"g3"
+)
+
+// Moves along the view direction. Velocity and rotation follow the input
+// smoothly.
+type FlyCamera struct {
+	viewer
+	input
+	pos         g3.Vec3
+	velocity    g3.Vec3
+	yaw, pitch  float32
+	targetYaw   float32
+	targetPitch float32
+	Speed       float32 // units per second
+	Sensitivity float32 // radians per pixel
+	// Smoothing of movement and rotation, see smoothFactor
+	Smoothing float32
+}
+
+func NewFlyCamera(position g3.Vec3, yaw, pitch float32) *FlyCamera {
+	c := &FlyCamera{pos: position, yaw: yaw, pitch: pitch, targetYaw: yaw, targetPitch: pitch,
+		Speed: 1, Sensitivity: 0.01, Smoothing: 8}
+	c.input = makeInput()
+	c.SetPerspective(g3.Deg2Rad(60), 0.1, 1000)
+	c.Update(0)
+	return c
+}
+
+func (c *FlyCamera) SetPosition(position g3.Vec3) {
+	c.pos = position
+	c.velocity = g3.Vec3{}
+}
+
+func (c *FlyCamera) HandleMouseEvent(me *g3.MouseEvent) {
+	c.targetYaw -= float32(me.Dx) * c.Sensitivity
+	c.targetPitch = g3.Clamp(c.targetPitch-float32(me.Dy)*c.Sensitivity, -maxPitch, maxPitch)
+}
+
+func (c *FlyCamera) Update(deltaTime float32) {
+	f := smoothFactor(c.Smoothing, deltaTime)
+	c.yaw = g3.Lerp(c.yaw, c.targetYaw, f)
+	c.pitch = g3.Lerp(c.pitch, c.targetPitch, f)
+
+	m := yawPitchMatrix(c.yaw, c.pitch)
+	dir := m.Transform(g3.Vec3{0, 1, 0})
+	up := m.Transform(g3.Vec3{0, 0, 1})
+	right := m.Transform(g3.Vec3{1, 0, 0})
+
+	move := c.direction()
+	target := dir.Scaled(move.Y).Add(right.Scaled(move.X)).Add(up.Scaled(move.Z)).Scaled(c.Speed)
+	c.velocity = c.velocity.Lerp(target, f)
+	c.pos.Accumulate(c.velocity.Scaled(deltaTime))
+
+	c.lookAt(c.pos, c.pos.Add(dir), up)
+}
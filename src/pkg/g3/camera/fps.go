@@ -0,0 +1,47 @@
+package camera
+
+import (
+	"g3"
+)
+
+// Walks in the xy plane and looks around with the mouse. Up and down keys
+// move along z.
+type FPSCamera struct {
+	viewer
+	input
+	pos         g3.Vec3
+	Yaw, Pitch  float32
+	Speed       float32 // units per second
+	Sensitivity float32 // radians per pixel
+}
+
+func NewFPSCamera(position g3.Vec3, yaw, pitch float32) *FPSCamera {
+	c := &FPSCamera{pos: position, Yaw: yaw, Pitch: pitch, Speed: 1, Sensitivity: 0.01}
+	c.input = makeInput()
+	c.SetPerspective(g3.Deg2Rad(60), 0.1, 1000)
+	c.Update(0)
+	return c
+}
+
+func (c *FPSCamera) SetPosition(position g3.Vec3) {
+	c.pos = position
+}
+
+func (c *FPSCamera) HandleMouseEvent(me *g3.MouseEvent) {
+	c.Yaw -= float32(me.Dx) * c.Sensitivity
+	c.Pitch = g3.Clamp(c.Pitch-float32(me.Dy)*c.Sensitivity, -maxPitch, maxPitch)
+}
+
+func (c *FPSCamera) Update(deltaTime float32) {
+	m := yawPitchMatrix(c.Yaw, c.Pitch)
+	dir := m.Transform(g3.Vec3{0, 1, 0})
+	up := m.Transform(g3.Vec3{0, 0, 1})
+
+	move := c.direction()
+	forward := g3.Vec3{-g3.Sin(c.Yaw), g3.Cos(c.Yaw), 0}
+	right := g3.Vec3{g3.Cos(c.Yaw), g3.Sin(c.Yaw), 0}
+	v := forward.Scaled(move.Y).Add(right.Scaled(move.X)).Add(g3.Vec3{0, 0, move.Z})
+	c.pos.Accumulate(v.Scaled(c.Speed * deltaTime))
+
+	c.lookAt(c.pos, c.pos.Add(dir), up)
+}
@@ -0,0 +1,51 @@
+package camera
+
+import (
+	"g3"
+)
+
+type MoveKeys struct {
+	Forward, Backward uint32
+	Left, Right       uint32
+	Up, Down          uint32
+}
+
+var DefaultMoveKeys = MoveKeys{g3.KeyW, g3.KeyS, g3.KeyA, g3.KeyD, g3.KeyPageUp, g3.KeyPageDown}
+
+// Tracks the movement keys that are held down.
+type input struct {
+	Keys    MoveKeys
+	pressed map[uint32]bool
+}
+
+func makeInput() input {
+	return input{DefaultMoveKeys, make(map[uint32]bool)}
+}
+
+func (in *input) HandleKeyEvent(ke *g3.KeyEvent) {
+	in.pressed[ke.Key] = ke.Type == g3.KeyPressed
+}
+
+func (in *input) axis(positive, negative uint32) float32 {
+	a := float32(0)
+	if in.pressed[positive] {
+		a += 1
+	}
+	if in.pressed[negative] {
+		a -= 1
+	}
+	return a
+}
+
+// Requested movement: x right, y forward, z up
+func (in *input) direction() g3.Vec3 {
+	return g3.Vec3{
+		in.axis(in.Keys.Right, in.Keys.Left),
+		in.axis(in.Keys.Forward, in.Keys.Backward),
+		in.axis(in.Keys.Up, in.Keys.Down)}
+}
+
+// button is a mask of g3.MouseButton values, 0 matches every event
+func buttonDown(me *g3.MouseEvent, button int32) bool {
+	return button == 0 || me.Button&button != 0
+}
@@ -0,0 +1,130 @@
+package camera
+
+import (
+	"g3"
+)
+
+// Circles around a target, z stays up. Dragging rotates, forward and
+// backward keys zoom, left and right keys rotate.
+type OrbitCamera struct {
+	viewer
+	input
+	Target      g3.Vec3
+	Distance    float32
+	MinDistance float32
+	MaxDistance float32
+	Yaw, Pitch  float32
+	Sensitivity float32 // radians per pixel
+	ZoomSpeed   float32 // relative change of the distance per second
+	TurnSpeed   float32 // radians per second
+	Button      int32   // mouse buttons that rotate, 0 for all mouse motion
+}
+
+func NewOrbitCamera(target g3.Vec3, distance, yaw, pitch float32) *OrbitCamera {
+	c := &OrbitCamera{Target: target, Distance: distance, MinDistance: 0, MaxDistance: g3.MathMax,
+		Yaw: yaw, Pitch: pitch, Sensitivity: 0.01, ZoomSpeed: 1, TurnSpeed: 1, Button: g3.MouseButtonLeft}
+	c.input = makeInput()
+	c.SetPerspective(g3.Deg2Rad(60), 0.1, 1000)
+	c.Update(0)
+	return c
+}
+
+func (c *OrbitCamera) HandleMouseEvent(me *g3.MouseEvent) {
+	if buttonDown(me, c.Button) {
+		c.Yaw -= float32(me.Dx) * c.Sensitivity
+		c.Pitch = g3.Clamp(c.Pitch-float32(me.Dy)*c.Sensitivity, -maxPitch, maxPitch)
+	}
+}
+
+func (c *OrbitCamera) Update(deltaTime float32) {
+	move := c.direction()
+	c.Distance *= g3.Pow(2, -move.Y*c.ZoomSpeed*deltaTime)
+	c.Distance = g3.Clamp(c.Distance, c.MinDistance, c.MaxDistance)
+	c.Yaw += move.X * c.TurnSpeed * deltaTime
+	c.Pitch = g3.Clamp(c.Pitch-move.Z*c.TurnSpeed*deltaTime, -maxPitch, maxPitch)
+
+	m := yawPitchMatrix(c.Yaw, c.Pitch)
+	dir := m.Transform(g3.Vec3{0, 1, 0})
+	up := m.Transform(g3.Vec3{0, 0, 1})
+	c.lookAt(c.Target.Sub(dir.Scaled(c.Distance)), c.Target, up)
+}
+
+// Rotates freely around a target like a trackball. Dragging rolls the
+// virtual ball under the mouse, forward and backward keys zoom.
+type ArcballCamera struct {
+	viewer
+	input
+	Target        g3.Vec3
+	Distance      float32
+	MinDistance   float32
+	MaxDistance   float32
+	ZoomSpeed     float32 // relative change of the distance per second
+	Button        int32   // mouse buttons that rotate, 0 for all mouse motion
+	rotation      g3.Quaternion
+	width, height int
+}
+
+// The camera starts above the target looking down the z axis.
+func NewArcballCamera(target g3.Vec3, distance float32) *ArcballCamera {
+	c := &ArcballCamera{Target: target, Distance: distance, MinDistance: 0, MaxDistance: g3.MathMax,
+		ZoomSpeed: 1, Button: g3.MouseButtonLeft, rotation: g3.MakeIdentityQuaternion()}
+	c.input = makeInput()
+	c.SetPerspective(g3.Deg2Rad(60), 0.1, 1000)
+	c.Update(0)
+	return c
+}
+
+// Rotation from camera to world space
+func (c *ArcballCamera) Rotation() g3.Quaternion {
+	return c.rotation
+}
+
+func (c *ArcballCamera) SetRotation(rotation g3.Quaternion) {
+	c.rotation = rotation.Normalized()
+}
+
+func (c *ArcballCamera) Resize(width, height int) {
+	c.width, c.height = width, height
+	c.Lens.Resize(width, height)
+}
+
+// Maps a pixel to the unit sphere in camera space, points outside of the
+// ball are moved to its rim.
+func (c *ArcballCamera) ballPoint(x, y int32) g3.Vec3 {
+	r := float32(c.width)
+	if c.height < c.width {
+		r = float32(c.height)
+	}
+	p := g3.Vec3{(2*float32(x) - float32(c.width)) / r, (float32(c.height) - 2*float32(y)) / r, 0}
+	if d := p.X*p.X + p.Y*p.Y; d < 1 {
+		p.Z = g3.Sqrt(1 - d)
+		return p
+	}
+	return p.Normalized()
+}
+
+func (c *ArcballCamera) HandleMouseEvent(me *g3.MouseEvent) {
+	if !buttonDown(me, c.Button) || c.width <= 0 || c.height <= 0 || (me.Dx == 0 && me.Dy == 0) {
+		return
+	}
+	from := c.ballPoint(me.X-me.Dx, me.Y-me.Dy)
+	to := c.ballPoint(me.X, me.Y)
+	axis := from.Cross(to)
+	if axis.LengthSq() < g3.Epsilon*g3.Epsilon {
+		return
+	}
+	angle := g3.Acos(g3.Clamp(from.Dot(to), -1, 1))
+	// the ball turns with the mouse, so the camera turns the other way
+	q := g3.MakeQuaternionFromAxisAngle(axis.Normalized(), -angle)
+	c.rotation = c.rotation.Multiply(q).Normalized()
+}
+
+func (c *ArcballCamera) Update(deltaTime float32) {
+	move := c.direction()
+	c.Distance *= g3.Pow(2, -move.Y*c.ZoomSpeed*deltaTime)
+	c.Distance = g3.Clamp(c.Distance, c.MinDistance, c.MaxDistance)
+
+	back := c.rotation.Rotate(g3.Vec3{0, 0, 1})
+	up := c.rotation.Rotate(g3.Vec3{0, 1, 0})
+	c.lookAt(c.Target.Add(back.Scaled(c.Distance)), c.Target, up)
+}
@@ -0,0 +1,62 @@
+package camera
+
+import (
+	"g3"
+)
+
+// Looks straight down the z axis with an orthographic projection, e.g. for
+// maps. Movement keys and dragging pan, up and down keys zoom.
+type OrthographicCamera struct {
+	viewer
+	input
+	center    g3.Vec3
+	Altitude  float32 // height of the eye above the center
+	PanSpeed  float32 // view heights per second
+	ZoomSpeed float32 // relative change of the view height per second
+	Button    int32   // mouse buttons that pan, 0 for all mouse motion
+	pixels    int
+}
+
+// height is the height of the view volume in world units, the eye is placed
+// at altitude above center.
+func NewOrthographicCamera(center g3.Vec3, height, altitude, depth float32) *OrthographicCamera {
+	c := &OrthographicCamera{center: center, Altitude: altitude, PanSpeed: 0.5, ZoomSpeed: 1, Button: g3.MouseButtonLeft}
+	c.input = makeInput()
+	c.SetOrthographic(height, 0, depth)
+	c.Update(0)
+	return c
+}
+
+func (c *OrthographicCamera) Center() g3.Vec3 {
+	return c.center
+}
+
+func (c *OrthographicCamera) SetCenter(center g3.Vec3) {
+	c.center = center
+}
+
+func (c *OrthographicCamera) Resize(width, height int) {
+	c.pixels = height
+	c.Lens.Resize(width, height)
+}
+
+func (c *OrthographicCamera) HandleMouseEvent(me *g3.MouseEvent) {
+	if !buttonDown(me, c.Button) || c.pixels <= 0 {
+		return
+	}
+	// the ground under the mouse stays there
+	scale := c.height / float32(c.pixels)
+	c.center.X -= float32(me.Dx) * scale
+	c.center.Y += float32(me.Dy) * scale
+}
+
+func (c *OrthographicCamera) Update(deltaTime float32) {
+	move := c.direction()
+	c.center.Accumulate(g3.Vec3{move.X, move.Y, 0}.Scaled(c.PanSpeed * c.height * deltaTime))
+	if move.Z != 0 {
+		c.SetOrthographic(c.height*g3.Pow(2, -move.Z*c.ZoomSpeed*deltaTime), c.near, c.far)
+	}
+
+	eye := c.center.Add(g3.Vec3{0, 0, c.Altitude})
+	c.lookAt(eye, c.center, g3.Vec3{0, 1, 0})
+}
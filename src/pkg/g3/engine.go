@@ -16,6 +16,13 @@ type FrameEvent struct {
 	DeltaTime float32
 }
 
+// Masks for MouseEvent.Button, the state of the buttons while the mouse moves
+const (
+	MouseButtonLeft   = int32(1 << 0)
+	MouseButtonMiddle = int32(1 << 1)
+	MouseButtonRight  = int32(1 << 2)
+)
+
 type MouseEvent struct {
 	X, Y   int32
 	Dx, Dy int32
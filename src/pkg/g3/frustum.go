@@ -6,6 +6,10 @@ type Frustum struct {
 	Near, Far   Plane
 }
 
+// Extracts the planes from a projection (or projection * view) matrix
+// (Gribb/Hartmann). Matrix4x4 transforms column vectors, so each plane is
+// the fourth row plus or minus one of the other rows. Plane normals point
+// into the frustum.
 func MakeFrustumFromMatrix(m *Matrix4x4) *Frustum {
 	left := Plane{Vec3{m.M41 + m.M11, m.M42 + m.M12, m.M43 + m.M13}, m.M44 + m.M14}
 	left.Normalize()
@@ -24,50 +28,228 @@ func MakeFrustumFromMatrix(m *Matrix4x4) *Frustum {
 
 	far := Plane{Vec3{m.M41 - m.M31, m.M42 - m.M32, m.M43 - m.M33}, m.M44 - m.M34}
 	far.Normalize()
-/*
-	left := Plane{Vec3{m.M14 + m.M11, m.M24 + m.M21, m.M34 + m.M31}, m.M44 + m.M41}
-	left.Normalize()
 
-	right := Plane{Vec3{m.M14 - m.M11, m.M24 - m.M11, m.M34 - m.M31}, m.M44 - m.M41}
-	right.Normalize()
+	return &Frustum{left, right, top, bottom, near, far}
+}
 
-	top := Plane{Vec3{m.M14 - m.M12, m.M24 - m.M22, m.M34 - m.M32}, m.M44 - m.M42}
-	top.Normalize()
+// World space frustum of a camera
+func MakeFrustumFromCamera(projection, view *Matrix4x4) *Frustum {
+	m := projection.Multiply(view)
+	return MakeFrustumFromMatrix(&m)
+}
 
-	bottom := Plane{Vec3{m.M14 + m.M12, m.M24 + m.M22, m.M34 + m.M32}, m.M44 + m.M42}
-	bottom.Normalize()
+// Indices into the array returned by Frustum.Corners
+const (
+	NearBottomLeft = iota
+	NearBottomRight
+	NearTopRight
+	NearTopLeft
+	FarBottomLeft
+	FarBottomRight
+	FarTopRight
+	FarTopLeft
+)
 
-	near := Plane{Vec3{m.M14 + m.M31, m.M24 + m.M23, m.M34 + m.M33}, m.M44 + m.M43}
-	near.Normalize()
+func (frustum *Frustum) Corners() [8]Vec3 {
+	var corners [8]Vec3
+	planes := [2]*Plane{&frustum.Near, &frustum.Far}
+	for i, p := range planes {
+		corners[i*4+0], _ = IntersectPlanes(p, &frustum.Bottom, &frustum.Left)
+		corners[i*4+1], _ = IntersectPlanes(p, &frustum.Bottom, &frustum.Right)
+		corners[i*4+2], _ = IntersectPlanes(p, &frustum.Top, &frustum.Right)
+		corners[i*4+3], _ = IntersectPlanes(p, &frustum.Top, &frustum.Left)
+	}
+	return corners
+}
 
-	far := Plane{Vec3{m.M14 - m.M13, m.M24 - m.M23, m.M34 - m.M33}, m.M44 - m.M43}
-	far.Normalize()
-*/
-	return &Frustum{left, right, top, bottom, near, far}
+func (frustum *Frustum) CalculateBoundingSphere() BoundingSphere {
+	corners := frustum.Corners()
+	return MakeBoundingSphereFromPoints(corners[:])
+}
+
+func (frustum *Frustum) CalculateBoundingBox() BoundingBox {
+	corners := frustum.Corners()
+	return MakeBoundingBoxFromPoints(corners[:])
+}
+
+// Splits the frustum into n slices along the view direction, e.g. for
+// cascaded shadow maps. lambda blends between uniform (0) and logarithmic (1)
+// split distances. Orthographic frustums are always split uniformly.
+func (frustum *Frustum) Split(n int, lambda float32) []Frustum {
+	corners := frustum.Corners()
+	depth := frustum.Near.DistanceToPoint(&corners[FarBottomLeft])
+
+	// distance of the near plane to the eye, left, right and top planes meet there
+	eyeDist := float32(0.0)
+	if eye, ok := IntersectPlanes(&frustum.Left, &frustum.Right, &frustum.Top); ok {
+		eyeDist = -frustum.Near.DistanceToPoint(&eye)
+	}
+	if eyeDist <= 0.0 {
+		lambda = 0.0
+	}
+	zNear, zFar := eyeDist, eyeDist+depth
+
+	slices := make([]Frustum, n)
+	start := float32(0.0)
+	for i := range slices {
+		end := depth
+		if i < n-1 {
+			f := float32(i+1) / float32(n)
+			uniform := zNear + (zFar-zNear)*f
+			logarithmic := uniform
+			if lambda > 0.0 {
+				logarithmic = zNear * Pow(zFar/zNear, f)
+			}
+			end = Lerp(uniform, logarithmic, lambda) - zNear
+		}
+		slice := *frustum
+		slice.Near.Distance = frustum.Near.Distance - start
+		if i < n-1 {
+			slice.Far = Plane{frustum.Near.Normal.Inverted(), end - frustum.Near.Distance}
+		}
+		slices[i] = slice
+		start = end
+	}
+	return slices
 }
 
+// Plane masks for the masked classification, bit i selects plane i (left, right, top, bottom, near, far)
+const (
+	FrustumPlaneNone = uint(0)
+	FrustumPlanesAll = uint(1<<6 - 1)
+)
+
+func (frustum *Frustum) plane(i int) *Plane {
+	switch i {
+	case 0:
+		return &frustum.Left
+	case 1:
+		return &frustum.Right
+	case 2:
+		return &frustum.Top
+	case 3:
+		return &frustum.Bottom
+	case 4:
+		return &frustum.Near
+	case 5:
+		return &frustum.Far
+	}
+	panic("invalid plane index")
+}
+
+// Returns true if bvol is at least partially inside the frustum.
 func (frustum *Frustum) ClipBoundingVolume(bvol BoundingVolume) bool {
-	if bvol.ClassifyPlane(&frustum.Left) == 0 {
+	if sphere, ok := bvol.(*BoundingSphere); ok {
+		return frustum.ClipSphere(sphere)
+	}
+	if bvol.ClassifyPlane(&frustum.Left) == ClassifyOutside {
 		return false
 	}
-	if bvol.ClassifyPlane(&frustum.Right) == 0 {
+	if bvol.ClassifyPlane(&frustum.Right) == ClassifyOutside {
 		return false
 	}
-	if bvol.ClassifyPlane(&frustum.Top) == 0 {
+	if bvol.ClassifyPlane(&frustum.Top) == ClassifyOutside {
 		return false
 	}
-	if bvol.ClassifyPlane(&frustum.Bottom) == 0 {
+	if bvol.ClassifyPlane(&frustum.Bottom) == ClassifyOutside {
 		return false
 	}
-	if bvol.ClassifyPlane(&frustum.Near) == 0 {
+	if bvol.ClassifyPlane(&frustum.Near) == ClassifyOutside {
 		return false
 	}
-	if bvol.ClassifyPlane(&frustum.Far) == 0 {
+	if bvol.ClassifyPlane(&frustum.Far) == ClassifyOutside {
 		return false
 	}
 	return true
 }
 
+// Three-state test: ClassifyInside, ClassifyOutside or ClassifyIntersecting.
+func (frustum *Frustum) ClassifyBoundingVolume(bvol BoundingVolume) int {
+	result, _ := frustum.ClassifyBoundingVolumeMasked(bvol, FrustumPlanesAll, nil)
+	return result
+}
+
+// Tests bvol only against the planes selected by planeMask. The returned mask
+// selects the planes bvol intersects; everything contained in bvol only has to be
+// tested against those. If the mask is empty bvol is completely inside.
+// coherentPlane (may be nil) is the index of the plane that is tested first. It
+// is updated when another plane rejects bvol, see FrustumCoherency.
+func (frustum *Frustum) ClassifyBoundingVolumeMasked(bvol BoundingVolume, planeMask uint, coherentPlane *int) (int, uint) {
+	first := -1
+	if coherentPlane != nil && planeMask&(1<<uint(*coherentPlane)) != 0 {
+		first = *coherentPlane
+		switch bvol.ClassifyPlane(frustum.plane(first)) {
+		case ClassifyOutside:
+			return ClassifyOutside, planeMask
+		case ClassifyInside:
+			planeMask &^= 1 << uint(first)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		bit := uint(1) << uint(i)
+		if i == first || planeMask&bit == 0 {
+			continue
+		}
+		switch bvol.ClassifyPlane(frustum.plane(i)) {
+		case ClassifyOutside:
+			if coherentPlane != nil {
+				*coherentPlane = i
+			}
+			return ClassifyOutside, planeMask
+		case ClassifyInside:
+			planeMask &^= bit
+		}
+	}
+	if planeMask == FrustumPlaneNone {
+		return ClassifyInside, planeMask
+	}
+	return ClassifyIntersecting, planeMask
+}
+
+// Plane coherency of frustum traversals, owned by the caller. Neighbouring
+// volumes, and the same volume in the next frame, are usually culled by the
+// same plane, so that plane is tested first. The zero value only carries the
+// plane over from one volume to the next, one made by NewFrustumCoherency
+// also remembers the plane that culled each node and starts with it in the
+// next frame. Not safe for concurrent use, every traversal needs its own.
+type FrustumCoherency struct {
+	// plane that culled a node, keyed by the node pointer
+	planes map[interface{}]int
+	// plane that culled the previous volume
+	last int
+}
+
+func NewFrustumCoherency() *FrustumCoherency {
+	return &FrustumCoherency{planes: make(map[interface{}]int)}
+}
+
+// Forgets the planes of all nodes, e.g. after the tree was rebuilt
+func (c *FrustumCoherency) Reset() {
+	if c.planes != nil {
+		c.planes = make(map[interface{}]int)
+	}
+}
+
+// ClassifyBoundingVolumeMasked for the volume of node, a pointer that
+// identifies it between frames. c may be nil.
+func (c *FrustumCoherency) classify(frustum *Frustum, node interface{}, bvol BoundingVolume, planeMask uint) (int, uint) {
+	if c == nil {
+		return frustum.ClassifyBoundingVolumeMasked(bvol, planeMask, nil)
+	}
+	plane, known := c.planes[node]
+	if !known {
+		plane = c.last
+	}
+	result, mask := frustum.ClassifyBoundingVolumeMasked(bvol, planeMask, &plane)
+	if result == ClassifyOutside {
+		c.last = plane
+		if c.planes != nil {
+			c.planes[node] = plane
+		}
+	}
+	return result, mask
+}
+
 func (frustum *Frustum) ClipPoint(v *Vec3) bool {
 	if frustum.Left.DistanceToPoint(v) < 0.0 {
 		return false
@@ -90,5 +272,27 @@ func (frustum *Frustum) ClipPoint(v *Vec3) bool {
 	return true
 }
 
-// TODO: ClipSphere
+// Cheaper than ClipBoundingVolume, no interface calls.
+func (frustum *Frustum) ClipSphere(sphere *BoundingSphere) bool {
+	r := -sphere.Radius
+	if frustum.Left.DistanceToPoint(&sphere.Position) < r {
+		return false
+	}
+	if frustum.Right.DistanceToPoint(&sphere.Position) < r {
+		return false
+	}
+	if frustum.Top.DistanceToPoint(&sphere.Position) < r {
+		return false
+	}
+	if frustum.Bottom.DistanceToPoint(&sphere.Position) < r {
+		return false
+	}
+	if frustum.Near.DistanceToPoint(&sphere.Position) < r {
+		return false
+	}
+	if frustum.Far.DistanceToPoint(&sphere.Position) < r {
+		return false
+	}
+	return true
+}
 
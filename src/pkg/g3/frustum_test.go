@@ -0,0 +1,134 @@
+package g3
+
+import (
+	"testing"
+)
+
+func expectPlane(t *testing.T, name string, p *Plane, normal Vec3, distance float32) {
+	if !p.Normal.ApproxEqualEps(normal, 1e-5) || !ApproxEqualEps(p.Distance, distance, 1e-4) {
+		t.Errorf("%s plane: got %v %f, expected %v %f", name, p.Normal, p.Distance, normal, distance)
+	}
+}
+
+func expectPoint(t *testing.T, name string, p, expected Vec3) {
+	if !p.ApproxEqualEps(expected, 1e-3) {
+		t.Errorf("%s: got %v, expected %v", name, p, expected)
+	}
+}
+
+func TestFrustumFromPerspectiveMatrix(t *testing.T) {
+	// 90 degrees, the side planes are at 45 degrees to the view direction
+	m := MakePerspectiveMatrix(Deg2Rad(90), 1.0, 1.0, 10.0)
+	f := MakeFrustumFromMatrix(&m)
+	s := 1 / Sqrt(2)
+	expectPlane(t, "left", &f.Left, Vec3{s, 0, -s}, 0)
+	expectPlane(t, "right", &f.Right, Vec3{-s, 0, -s}, 0)
+	expectPlane(t, "top", &f.Top, Vec3{0, -s, -s}, 0)
+	expectPlane(t, "bottom", &f.Bottom, Vec3{0, s, -s}, 0)
+	expectPlane(t, "near", &f.Near, Vec3{0, 0, -1}, -1)
+	expectPlane(t, "far", &f.Far, Vec3{0, 0, 1}, 10)
+
+	if !f.ClipPoint(&Vec3{0, 0, -5}) || f.ClipPoint(&Vec3{0, 0, 5}) || f.ClipPoint(&Vec3{6, 0, -5}) {
+		t.Error("ClipPoint")
+	}
+}
+
+func TestFrustumFromOrthographicMatrix(t *testing.T) {
+	m := MakeOrthographicMatrix(-2, 2, -1, 3, 1, 10)
+	f := MakeFrustumFromMatrix(&m)
+	expectPlane(t, "left", &f.Left, Vec3{1, 0, 0}, 2)
+	expectPlane(t, "right", &f.Right, Vec3{-1, 0, 0}, 2)
+	expectPlane(t, "top", &f.Top, Vec3{0, -1, 0}, 3)
+	expectPlane(t, "bottom", &f.Bottom, Vec3{0, 1, 0}, 1)
+	expectPlane(t, "near", &f.Near, Vec3{0, 0, -1}, -1)
+	expectPlane(t, "far", &f.Far, Vec3{0, 0, 1}, 10)
+}
+
+func TestFrustumFromCamera(t *testing.T) {
+	projection := MakePerspectiveMatrix(Deg2Rad(90), 1.0, 1.0, 10.0)
+	eye, center, up := Vec3{5, 0, 0}, Vec3{5, 1, 0}, Vec3{0, 0, 1}
+	view := MakeLookAtMatrix(&eye, &center, &up)
+	f := MakeFrustumFromCamera(&projection, &view)
+	expectPlane(t, "near", &f.Near, Vec3{0, 1, 0}, -1)
+	expectPlane(t, "far", &f.Far, Vec3{0, -1, 0}, 10)
+	corners := f.Corners()
+	expectPoint(t, "near bottom left", corners[NearBottomLeft], Vec3{4, 1, -1})
+	expectPoint(t, "far top right", corners[FarTopRight], Vec3{15, 10, 10})
+}
+
+func TestFrustumCorners(t *testing.T) {
+	m := MakePerspectiveMatrix(Deg2Rad(90), 2.0, 1.0, 10.0)
+	f := MakeFrustumFromMatrix(&m)
+	corners := f.Corners()
+	expected := [8]Vec3{
+		{-2, -1, -1}, {2, -1, -1}, {2, 1, -1}, {-2, 1, -1},
+		{-20, -10, -10}, {20, -10, -10}, {20, 10, -10}, {-20, 10, -10}}
+	for i := range corners {
+		expectPoint(t, "corner", corners[i], expected[i])
+	}
+
+	sphere := f.CalculateBoundingSphere()
+	for _, c := range corners {
+		if c.Distance(sphere.Position) > sphere.Radius*1.0001 {
+			t.Errorf("corner %v outside of bounding sphere %v", c, sphere)
+		}
+	}
+}
+
+func TestFrustumSplit(t *testing.T) {
+	m := MakePerspectiveMatrix(Deg2Rad(90), 1.0, 1.0, 10.0)
+	f := MakeFrustumFromMatrix(&m)
+
+	slices := f.Split(3, 0.0)
+	for i, z := range []float32{1, 4, 7} {
+		expectPlane(t, "uniform near", &slices[i].Near, Vec3{0, 0, -1}, -z)
+		expectPlane(t, "uniform far", &slices[i].Far, Vec3{0, 0, 1}, z+3)
+	}
+
+	slices = f.Split(2, 1.0)
+	split := Sqrt(10)
+	expectPlane(t, "logarithmic far", &slices[0].Far, Vec3{0, 0, 1}, split)
+	expectPlane(t, "logarithmic near", &slices[1].Near, Vec3{0, 0, -1}, -split)
+	expectPlane(t, "logarithmic last far", &slices[1].Far, Vec3{0, 0, 1}, 10)
+
+	o := MakeOrthographicMatrix(-1, 1, -1, 1, 2, 6)
+	f = MakeFrustumFromMatrix(&o)
+	slices = f.Split(2, 1.0)
+	expectPlane(t, "orthographic split", &slices[0].Far, Vec3{0, 0, 1}, 4)
+}
+
+func TestClipSphere(t *testing.T) {
+	// looks down -z, the side planes are at 45 degrees
+	m := MakePerspectiveMatrix(Deg2Rad(90), 1.0, 1.0, 10.0)
+	f := MakeFrustumFromMatrix(&m)
+	tests := []struct {
+		name    string
+		sphere  BoundingSphere
+		visible bool
+		result  int
+	}{
+		{"inside", BoundingSphere{Vec3{0, 0, -5}, 1}, true, ClassifyInside},
+		{"around the frustum", BoundingSphere{Vec3{0, 0, -5}, 50}, true, ClassifyIntersecting},
+		{"touching the left plane", BoundingSphere{Vec3{-6, 0, -5}, 1}, true, ClassifyIntersecting},
+		// 1.1 / sqrt(2) away from the left plane
+		{"beyond the left plane", BoundingSphere{Vec3{-6.1, 0, -5}, 0.7}, false, ClassifyOutside},
+		{"above", BoundingSphere{Vec3{0, 8, -5}, 2}, false, ClassifyOutside},
+		{"behind the near plane", BoundingSphere{Vec3{0, 0, 0}, 0.9}, false, ClassifyOutside},
+		{"cutting the near plane", BoundingSphere{Vec3{0, 0, 0}, 1.1}, true, ClassifyIntersecting},
+		{"beyond the far plane", BoundingSphere{Vec3{0, 0, -12}, 1.9}, false, ClassifyOutside},
+		{"cutting the far plane", BoundingSphere{Vec3{0, 0, -12}, 2.1}, true, ClassifyIntersecting},
+		// outside near the far corner but not behind a single plane, kept conservatively
+		{"beside a corner", BoundingSphere{Vec3{11, 11, -11}, 1.5}, true, ClassifyIntersecting},
+	}
+	for _, test := range tests {
+		if visible := f.ClipSphere(&test.sphere); visible != test.visible {
+			t.Errorf("%s: ClipSphere %v, want %v", test.name, visible, test.visible)
+		}
+		if visible := f.ClipBoundingVolume(&test.sphere); visible != test.visible {
+			t.Errorf("%s: ClipBoundingVolume %v, want %v", test.name, visible, test.visible)
+		}
+		if result := f.ClassifyBoundingVolume(&test.sphere); result != test.result {
+			t.Errorf("%s: ClassifyBoundingVolume %d, want %d", test.name, result, test.result)
+		}
+	}
+}
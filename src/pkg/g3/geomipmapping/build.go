@@ -0,0 +1,170 @@
+package geomipmapping
+
+import (
+	"g3"
+	"os"
+	"runtime"
+)
+
+var (
+	ErrBuildCanceled = os.NewError("geomipmapping: build canceled")
+	ErrPatchSize     = os.NewError("geomipmapping: patch size is not a multiple of 2^maxLOD")
+	ErrHeightMapSize = os.NewError("geomipmapping: height map is smaller than 2x2 samples")
+)
+
+type BuildOptions struct {
+	// Number of goroutines generating patches, GOMAXPROCS if < 1
+	Workers int
+	// Called by the building goroutine after each generated patch, may be nil
+	Progress func(done, total int)
+	// The build stops if something is received, may be nil
+	Cancel <-chan bool
+	// Stored with the terrain, see SourceKey. The build doesn't compute it,
+	// hashing the height map would delay the parallel patch generation.
+	SourceKey uint32
+}
+
+// Grid cell of a leaf
+type patchJob struct {
+	leaf   *g3.SpatLeaf
+	gx, gy int
+}
+
+// Creates the quadtree over the w x h grid cells at gx, gy without patch
+// data, the leaves are collected in jobs. Cells are split at the middle
+// rounded up, so nodes at the right and bottom edge may have less children.
+func buildQuadTree(gx, gy, w, h int, parent g3.SpatElement, jobs []patchJob) (g3.SpatElement, []patchJob) {
+	if w == 1 && h == 1 {
+		leaf := &g3.SpatLeaf{g3.SpatElementData{Parent: parent}}
+		return leaf, append(jobs, patchJob{leaf, gx, gy})
+	}
+	hw, hh := (w+1)/2, (h+1)/2
+	p := &g3.SpatNode{g3.SpatElementData{Parent: parent}, make([]g3.SpatElement, 0, 4)}
+	for _, c := range [4][4]int{{gx, gy, hw, hh}, {gx + hw, gy, w - hw, hh}, {gx, gy + hh, hw, h - hh}, {gx + hw, gy + hh, w - hw, h - hh}} {
+		if c[2] > 0 && c[3] > 0 {
+			var child g3.SpatElement
+			child, jobs = buildQuadTree(c[0], c[1], c[2], c[3], p, jobs)
+			p.Children = append(p.Children, child)
+		}
+	}
+	return p, jobs
+}
+
+// Generates the CPU side data of the patch in grid cell gx, gy, safe to run in parallel.
+func generatePatch(heightMap HeightMap, gx, gy, patchSize int, maxLOD uint, whScale, hScale float32) (*patch, g3.BoundingBox) {
+	vertices, normals := createPatchVertices(heightMap, gx*patchSize, gy*patchSize,
+		patchSize/int(pow2(maxLOD)), maxLOD, whScale, hScale)
+	bbox := g3.MakeBoundingBoxFromPoints(vertices)
+	p := &patch{center: bbox.CalculateCenter(), vertexData: vertices, normalData: normals, gridX: gx, gridY: gy}
+	p.occluder = createPatchOccluder(vertices, maxLOD)
+	p.errors = createPatchErrors(vertices, maxLOD)
+	p.morphData = createPatchMorphData(vertices, maxLOD)
+	return p, bbox
+}
+
+func (gm *GeoMipMap) createPatch(job *patchJob) {
+	p, bbox := generatePatch(gm.heightMap, job.gx, job.gy, gm.patchSize, gm.maxLOD, gm.whScale, gm.hScale)
+	job.leaf.BVolume = &bbox
+	job.leaf.Data = p
+}
+
+// Runs createPatch for all jobs on a pool of workers.
+func (gm *GeoMipMap) createPatches(jobs []patchJob, options *BuildOptions) os.Error {
+	workers := options.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	pending := make(chan int)
+	finished := make(chan int)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range pending {
+				gm.createPatch(&jobs[j])
+				finished <- j
+			}
+		}()
+	}
+
+	sent, done := 0, 0
+	canceled := false
+	for done < sent || (!canceled && sent < len(jobs)) {
+		if !canceled && sent < len(jobs) {
+			select {
+			case pending <- sent:
+				sent++
+				continue
+			case <-finished:
+			case <-options.Cancel:
+				canceled = true
+				continue
+			}
+		} else {
+			<-finished
+		}
+		done++
+		if options.Progress != nil {
+			options.Progress(done, len(jobs))
+		}
+	}
+	close(pending)
+	if canceled {
+		return ErrBuildCanceled
+	}
+	return nil
+}
+
+// Bounding boxes of the inner nodes from their children
+func refitQuadTree(element g3.SpatElement) *g3.BoundingBox {
+	node, ok := element.(*g3.SpatNode)
+	if !ok {
+		return element.GetBoundingVolume().(*g3.BoundingBox)
+	}
+	boxes := make([]g3.BoundingBox, len(node.Children))
+	for i, child := range node.Children {
+		boxes[i] = *refitQuadTree(child)
+	}
+	bbox := g3.MakeBoundingBoxFromBoxes(boxes)
+	node.BVolume = &bbox
+	return &bbox
+}
+
+// Builds the terrain from patches covering patchSize x patchSize sample
+// intervals of the height map, patchSize has to be a multiple of 2^maxLOD.
+// The height map may have any size, patches at the right and bottom edge
+// are clamped to the last samples. Patches are generated in parallel,
+// heightMap must be safe for concurrent use. GPU buffers are created by the
+// calling goroutine, which has to be the render thread. Returns
+// ErrBuildCanceled if the build was canceled by options.Cancel. options may
+// be nil.
+func BuildGeoMipMap(dev g3.GraphicsDevice, heightMap HeightMap, patchSize int, maxLOD uint, whScale, hScale float32, options *BuildOptions) (*GeoMipMap, os.Error) {
+	if maxLOD < 1 || patchSize < int(pow2(maxLOD)) || patchSize%int(pow2(maxLOD)) != 0 {
+		return nil, ErrPatchSize
+	}
+	w, h := heightMap.Size()
+	if w < 2 || h < 2 {
+		return nil, ErrHeightMapSize
+	}
+	if options == nil {
+		options = &BuildOptions{}
+	}
+	// w-1 sample intervals, rounded up
+	gridWidth := (w - 2 + patchSize) / patchSize
+	gridHeight := (h - 2 + patchSize) / patchSize
+	gmap := newGeoMipMap(heightMap, patchSize, maxLOD, whScale, hScale, gridWidth, gridHeight)
+	gmap.sourceKey = options.SourceKey
+
+	root, jobs := buildQuadTree(0, 0, gridWidth, gridHeight, nil, nil)
+	if err := gmap.createPatches(jobs, options); err != nil {
+		return nil, err
+	}
+	refitQuadTree(root)
+	gmap.root = root
+	gmap.buildGrid()
+
+	for _, job := range jobs {
+		job.leaf.Data.(*patch).createBuffers(dev)
+	}
+	gmap.buildLODIndices(dev)
+	gmap.occluderIndices = createOccluderIndices(maxLOD)
+	return gmap, nil
+}
@@ -0,0 +1,175 @@
+package geomipmapping
+
+import (
+	"bytes"
+	"encoding/binary"
+	"g3"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// A prebuilt terrain is stored as a settings chunk followed by the quadtree
+// chunk of the patches. Index buffers are cheap and rebuilt on load.
+
+const terrainVersion = 1
+
+var terrainMagic = [4]byte{'G', '3', 'G', 'M'}
+
+var ErrTerrainData = os.NewError("geomipmapping: invalid terrain data")
+
+type terrainSettings struct {
+	PatchSize  int32
+	GridWidth  int32
+	GridHeight int32
+	MaxLOD     uint32
+	WHScale    float32
+	HScale     float32
+	SourceKey  uint32
+}
+
+// Checksum of the height map samples and the build settings. Passed in
+// BuildOptions it is written with the terrain, so a cached terrain can be
+// rebuilt when its source has changed.
+func SourceKey(heightMap HeightMap, patchSize int, maxLOD uint, whScale, hScale float32) uint32 {
+	w, h := heightMap.Size()
+	hash := crc32.NewIEEE()
+	binary.Write(hash, binary.LittleEndian, [4]int32{int32(w), int32(h), int32(patchSize), int32(maxLOD)})
+	binary.Write(hash, binary.LittleEndian, [2]float32{whScale, hScale})
+	row := make([]float32, w)
+	for y := 0; y < h; y++ {
+		for x := range row {
+			row[x] = heightMap.Height(float32(x), float32(y))
+		}
+		binary.Write(hash, binary.LittleEndian, row)
+	}
+	return hash.Sum32()
+}
+
+// SourceKey passed in BuildOptions when the terrain was built, 0 if there
+// was none and for paged terrains.
+func (gm *GeoMipMap) SourceKey() uint32 {
+	return gm.sourceKey
+}
+
+// Patch payloads: center, grid position, vertex count, vertices, normals, occluder vertex count, occluder.
+// GPU buffers, level errors and morph data are created when decoding, dev is nil when encoding.
+type patchCodec struct {
+	dev    g3.GraphicsDevice
+	maxLOD uint
+}
+
+func (c *patchCodec) EncodePayload(w io.Writer, data interface{}) os.Error {
+	patch, ok := data.(*patch)
+	if !ok {
+		return ErrTerrainData
+	}
+	if err := binary.Write(w, binary.LittleEndian, &patch.center); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, [2]int32{int32(patch.gridX), int32(patch.gridY)}); err != nil {
+		return err
+	}
+	for _, vertices := range [][]g3.Vec3{patch.vertexData, patch.normalData, patch.occluder} {
+		if err := binary.Write(w, binary.LittleEndian, uint32(len(vertices))); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, vertices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *patchCodec) DecodePayload(r io.Reader) (interface{}, os.Error) {
+	p := new(patch)
+	if err := binary.Read(r, binary.LittleEndian, &p.center); err != nil {
+		return nil, err
+	}
+	var grid [2]int32
+	if err := binary.Read(r, binary.LittleEndian, &grid); err != nil {
+		return nil, err
+	}
+	p.gridX, p.gridY = int(grid[0]), int(grid[1])
+	for _, vertices := range []*[]g3.Vec3{&p.vertexData, &p.normalData, &p.occluder} {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		*vertices = make([]g3.Vec3, n)
+		if err := binary.Read(r, binary.LittleEndian, *vertices); err != nil {
+			return nil, err
+		}
+	}
+	size := int(pow2(c.maxLOD) + 1)
+	if len(p.vertexData) != size*size || len(p.normalData) != size*size {
+		return nil, ErrTerrainData
+	}
+	p.errors = createPatchErrors(p.vertexData, c.maxLOD)
+	p.morphData = createPatchMorphData(p.vertexData, c.maxLOD)
+	p.createBuffers(c.dev)
+	return p, nil
+}
+
+// Writes the built terrain, the height map is not stored.
+func (gm *GeoMipMap) Write(w io.Writer) os.Error {
+	settings := terrainSettings{int32(gm.patchSize), int32(gm.gridWidth), int32(gm.gridHeight),
+		uint32(gm.maxLOD), gm.whScale, gm.hScale, gm.sourceKey}
+	body := new(bytes.Buffer)
+	if err := binary.Write(body, binary.LittleEndian, &settings); err != nil {
+		return err
+	}
+	if err := g3.WriteChunk(w, terrainMagic, terrainVersion, body.Bytes()); err != nil {
+		return err
+	}
+	return g3.WriteSpatTree(w, gm.root, &patchCodec{nil, gm.maxLOD})
+}
+
+func (gm *GeoMipMap) Save(fileName string) os.Error {
+	file, err := os.Open(fileName, os.O_WRONLY|os.O_CREAT|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	err = gm.Write(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Loads a terrain written by GeoMipMap.Write and creates its GPU buffers on dev.
+// The terrain has no height map.
+func ReadGeoMipMap(dev g3.GraphicsDevice, r io.Reader) (*GeoMipMap, os.Error) {
+	_, body, err := g3.ReadChunk(r, terrainMagic, terrainVersion)
+	if err != nil {
+		return nil, err
+	}
+	var settings terrainSettings
+	if err := binary.Read(bytes.NewBuffer(body), binary.LittleEndian, &settings); err != nil {
+		return nil, ErrTerrainData
+	}
+	if settings.MaxLOD < 1 || settings.MaxLOD > 16 || settings.GridWidth < 1 || settings.GridHeight < 1 {
+		return nil, ErrTerrainData
+	}
+	gmap := newGeoMipMap(nil, int(settings.PatchSize), uint(settings.MaxLOD), settings.WHScale, settings.HScale,
+		int(settings.GridWidth), int(settings.GridHeight))
+	gmap.sourceKey = settings.SourceKey
+	if gmap.root, err = g3.ReadSpatTree(r, &patchCodec{dev, gmap.maxLOD}); err != nil {
+		return nil, err
+	}
+	if !gmap.buildGrid() {
+		return nil, ErrTerrainData
+	}
+	gmap.buildLODIndices(dev)
+	gmap.occluderIndices = createOccluderIndices(gmap.maxLOD)
+	return gmap, nil
+}
+
+func LoadGeoMipMap(dev g3.GraphicsDevice, fileName string) (*GeoMipMap, os.Error) {
+	file, err := os.Open(fileName, os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadGeoMipMap(dev, file)
+}
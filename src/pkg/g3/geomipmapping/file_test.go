@@ -0,0 +1,34 @@
+package geomipmapping
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTerrainFile(t *testing.T) {
+	hm := &waveHeightMap{70, 50}
+	key := SourceKey(hm, 16, 3, 0.5, 10)
+	gm, err := BuildGeoMipMap(testDevice{}, hm, 16, 3, 0.5, 10, &BuildOptions{SourceKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := new(bytes.Buffer)
+	if err := gm.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadGeoMipMap(testDevice{}, buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.patches) != len(gm.patches) || loaded.patches[5].vertexData[7] != gm.patches[5].vertexData[7] {
+		t.Error("loaded terrain differs")
+	}
+
+	// the key identifies the source of a cached terrain
+	if gm.SourceKey() != key || loaded.SourceKey() != key {
+		t.Errorf("source keys %x and %x, expected %x", gm.SourceKey(), loaded.SourceKey(), key)
+	}
+	if SourceKey(hm, 16, 3, 0.5, 11) == key || SourceKey(&waveHeightMap{70, 51}, 16, 3, 0.5, 10) == key {
+		t.Error("source key unchanged")
+	}
+}
@@ -2,6 +2,7 @@ package geomipmapping
 
 import (
 	"g3"
+	"strconv"
 )
 
 const (
@@ -16,8 +17,10 @@ const (
 	crackBottomRight = crackBottom | crackRight
 )
 
+// Any combination of sides can have finer neighbours, the crack mask is
+// the index of the index buffers.
 const (
-	numCrackTypes = 9
+	numCrackTypes = 16
 )
 
 type HeightMap interface {
@@ -26,21 +29,70 @@ type HeightMap interface {
 }
 
 type patch struct {
-	center   g3.Vec3
-	vertices g3.VertexBuffer
-	normals  g3.VertexBuffer
+	center     g3.Vec3
+	vertices   g3.VertexBuffer
+	normals    g3.VertexBuffer
+	vertexData []g3.Vec3
+	normalData []g3.Vec3
+	occluder   []g3.Vec3
+	// geometric error of each level in world units
+	errors []float32
+	// height at the next coarser level and level of each vertex
+	morphData    []g3.Vec2
+	morphTargets g3.VertexBuffer
+	// position in the patch grid, level and morph factor for the current view
+	gridX, gridY int
+	lod          int
+	morph        float32
+	// level and morph factor of the vertices on each edge, the same for the
+	// neighbour on the other side, in the order of neighbourOffsets
+	edgeLOD   [4]int
+	edgeMorph [4]float32
+}
+
+func (p *patch) createBuffers(dev g3.GraphicsDevice) {
+	p.vertices = dev.NewVertexBufferVec3(p.vertexData)
+	p.normals = dev.NewVertexBufferVec3(p.normalData)
+	p.morphTargets = dev.NewVertexBufferVec2(p.morphData)
+}
+
+func (p *patch) releaseBuffers() {
+	p.vertices.Release()
+	p.normals.Release()
+	p.morphTargets.Release()
 }
 
 type GeoMipMap struct {
-	heightMap      HeightMap
-	maxDepth       uint
-	maxPatchWidth  int
-	maxPatchHeight int
-	maxLOD         uint
-	whScale        float32
-	hScale         float32
-	root           g3.SpatElement
-	lodIndices     [][]g3.IndexBuffer
+	heightMap  HeightMap
+	patchSize  int
+	maxLOD     uint
+	whScale    float32
+	hScale     float32
+	root       g3.SpatElement
+	lodIndices [][]g3.IndexBuffer
+	// copies of lodIndices for queries
+	indexData       [][][]uint32
+	occluderIndices []uint32
+	// projected error of one unit at distance one in pixels
+	lodScale       float32
+	pixelTolerance float32
+	// leaves of the quadtree, row major
+	patches    []*patch
+	gridWidth  int
+	gridHeight int
+	// geomorphing is done by the vertex shader, nil if disabled
+	morphShader   g3.Shader
+	morphUniforms morphUniforms
+	// level used by queries or RenderedLOD
+	queryLOD int
+	// see SourceKey
+	sourceKey uint32
+}
+
+// Uniform locations of the morph shader
+type morphUniforms struct {
+	morph, lod         uint
+	edgeMorph, edgeLOD [4]uint
 }
 
 type generatedLODIndices struct {
@@ -54,54 +106,6 @@ type generatedPatchVertices struct {
 	normals  []g3.Vec3
 }
 
-func indexToCrack(index int) uint {
-	switch index {
-	case 0:
-		return crackNone
-	case 1:
-		return crackLeft
-	case 2:
-		return crackRight
-	case 3:
-		return crackTop
-	case 4:
-		return crackBottom
-	case 5:
-		return crackTopLeft
-	case 6:
-		return crackTopRight
-	case 7:
-		return crackBottomLeft
-	case 8:
-		return crackBottomRight
-	}
-	panic("invalid index")
-}
-
-func crackToIndex(crackFlag uint) int {
-	switch crackFlag {
-	case crackNone:
-		return 0
-	case crackLeft:
-		return 1
-	case crackRight:
-		return 2
-	case crackTop:
-		return 3
-	case crackBottom:
-		return 4
-	case crackTopLeft:
-		return 5
-	case crackTopRight:
-		return 6
-	case crackBottomLeft:
-		return 7
-	case crackBottomRight:
-		return 8
-	}
-	panic("unknown flag")
-}
-
 // test crack flag
 func isSet(mask, test uint) bool {
 	return mask&test == test
@@ -112,42 +116,204 @@ func pow2(n uint) uint {
 	return 1 << n
 }
 
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
 // calculates vertex offset in patch
 func offset(width, x, y uint) uint32 {
 	return uint32(y*width + x)
 }
 
-// generate normal and vertex buffer
-func createPatchVertices(heightMap HeightMap, x, y, width, height int, maxLod uint, scale, hscale float32) (vertices, normals []g3.Vec3) {
-	div := pow2(maxLod)
-	size := div + 1
-	xstep := float32(width) / float32(div)
-	ystep := float32(height) / float32(div)
+// generate normal and vertex buffer of the patch starting at sample x, y.
+// Vertices are stride samples apart and clamped to the last sample of the
+// height map, so patches at the edges have degenerate quads instead of
+// sampling outside. Neighbouring patches share their border samples.
+func createPatchVertices(heightMap HeightMap, x, y, stride int, maxLod uint, scale, hscale float32) (vertices, normals []g3.Vec3) {
+	w, h := heightMap.Size()
+	size := int(pow2(maxLod)) + 1
 	vertices = make([]g3.Vec3, 0, size*size)
 	normals = make([]g3.Vec3, 0, size*size)
-	for i := uint(0); i < size; i++ {
-		for j := uint(0); j < size; j++ {
-			px0, py0 := float32(x)+float32(i)*xstep, float32(y)+float32(j)*ystep
-			px1, py1 := px0+xstep, py0
-			px2, py2 := px0, py0+ystep
-
-			ph0 := heightMap.Height(px0, py0)
-			ph1 := heightMap.Height(px1, py1)
-			ph2 := heightMap.Height(px2, py2)
-
-			p0 := g3.Vec3{px0 * scale, py0 * scale, ph0 * hscale}
-			p1 := g3.Vec3{px1 * scale, py1 * scale, ph1 * hscale}
-			p2 := g3.Vec3{px2 * scale, py2 * scale, ph2 * hscale}
-			tangent, bitangent := p1.Sub(p0), p2.Sub(p0)
-			n := tangent.Cross(bitangent).Normalized()
-
-			vertices = append(vertices, p0)
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			px, py := clampInt(x+i*stride, 0, w-1), clampInt(y+j*stride, 0, h-1)
+			ph := heightMap.Height(float32(px), float32(py))
+
+			// central differences of the neighbouring samples
+			x0, x1 := clampInt(px-1, 0, w-1), clampInt(px+1, 0, w-1)
+			y0, y1 := clampInt(py-1, 0, h-1), clampInt(py+1, 0, h-1)
+			dx := (heightMap.Height(float32(x1), float32(py)) - heightMap.Height(float32(x0), float32(py))) * hscale / (float32(x1-x0) * scale)
+			dy := (heightMap.Height(float32(px), float32(y1)) - heightMap.Height(float32(px), float32(y0))) * hscale / (float32(y1-y0) * scale)
+			n := g3.Vec3{-dx, -dy, 1}.Normalized()
+
+			vertices = append(vertices, g3.Vec3{float32(px) * scale, float32(py) * scale, ph * hscale})
 			normals = append(normals, n)
 		}
 	}
 	return
 }
 
+// Vertices per side of the occluder grid, the coarsest LOD maxLod-1 has three,
+// a patch without coarser levels is its own occluder.
+func occluderSize(maxLod uint) uint {
+	if maxLod == 0 {
+		return 2
+	}
+	return 3
+}
+
+// The coarsest LOD of a patch, lowered until it lies completely below the
+// patch surface. Used as a conservative occluder.
+func createPatchOccluder(vertices []g3.Vec3, maxLod uint) []g3.Vec3 {
+	size := pow2(maxLod) + 1
+	n := occluderSize(maxLod)
+	skip := (size - 1) / (n - 1)
+	occluder := make([]g3.Vec3, 0, n*n)
+	for i := uint(0); i < size; i += skip {
+		for j := uint(0); j < size; j += skip {
+			occluder = append(occluder, vertices[i*size+j])
+		}
+	}
+	// no interpolated point of a coarse cell is higher than its highest corner,
+	// no point of the fine surface is lower than its lowest vertex in the cell
+	drop := float32(0.0)
+	for ci := uint(0); ci < n-1; ci++ {
+		for cj := uint(0); cj < n-1; cj++ {
+			maxCorner := g3.Max(
+				g3.Max(occluder[ci*n+cj].Z, occluder[ci*n+cj+1].Z),
+				g3.Max(occluder[(ci+1)*n+cj].Z, occluder[(ci+1)*n+cj+1].Z))
+			minFine := float32(g3.MathMax)
+			for i := ci * skip; i <= (ci+1)*skip; i++ {
+				for j := cj * skip; j <= (cj+1)*skip; j++ {
+					minFine = g3.Min(minFine, vertices[i*size+j].Z)
+				}
+			}
+			drop = g3.Max(drop, maxCorner-minFine)
+		}
+	}
+	for i := range occluder {
+		occluder[i].Z -= drop
+	}
+	return occluder
+}
+
+// Maximum vertical distance between the full resolution patch and the
+// surface of each level. Coarser levels are never more exact than finer ones.
+func createPatchErrors(vertices []g3.Vec3, maxLod uint) []float32 {
+	size := pow2(maxLod) + 1
+	errors := make([]float32, maxLod)
+	for lod := uint(1); lod < maxLod; lod++ {
+		skip := pow2(lod)
+		e := errors[lod-1]
+		for x := uint(0); x < size-1; x += skip {
+			for y := uint(0); y < size-1; y += skip {
+				h00 := vertices[x*size+y].Z
+				h10 := vertices[(x+skip)*size+y].Z
+				h01 := vertices[x*size+y+skip].Z
+				h11 := vertices[(x+skip)*size+y+skip].Z
+				for p := uint(0); p <= skip; p++ {
+					for q := uint(0); q <= skip; q++ {
+						// same diagonal as addQuadN
+						u, v := float32(p)/float32(skip), float32(q)/float32(skip)
+						var h float32
+						if u+v <= 1 {
+							h = h00 + u*(h10-h00) + v*(h01-h00)
+						} else {
+							h = h11 + (1-u)*(h01-h11) + (1-v)*(h10-h11)
+						}
+						e = g3.Max(e, g3.Abs(vertices[(x+p)*size+y+q].Z-h))
+					}
+				}
+			}
+		}
+		errors[lod] = e
+	}
+	return errors
+}
+
+// Levels in the morph data of vertices on a patch edge are offset by
+// morphEdgeStride times the index of the edge in neighbourOffsets plus one.
+const morphEdgeStride = 16
+
+// Level and edge of a vertex from its morph data, edge is -1 inside the patch
+func morphLevel(data g3.Vec2) (level, edge int) {
+	l := int(data.Y)
+	return l % morphEdgeStride, l/morphEdgeStride - 1
+}
+
+// Coarsest level containing the vertex and its height interpolated by the
+// level above (x: height, y: level, see morphLevel). On the patch border the
+// height only depends on the edge, so neighbours share it.
+func createPatchMorphData(vertices []g3.Vec3, maxLod uint) []g3.Vec2 {
+	size := pow2(maxLod) + 1
+	morphData := make([]g3.Vec2, len(vertices))
+	for x := uint(0); x < size; x++ {
+		for y := uint(0); y < size; y++ {
+			level := uint(0)
+			for level+1 < maxLod && x%pow2(level+1) == 0 && y%pow2(level+1) == 0 {
+				level++
+			}
+			h := vertices[x*size+y].Z
+			if level+1 < maxLod {
+				skip := pow2(level + 1)
+				x0, y0 := x/skip*skip, y/skip*skip
+				// the last row and column are the far side of a cell
+				if x0 == size-1 {
+					x0 -= skip
+				}
+				if y0 == size-1 {
+					y0 -= skip
+				}
+				h00 := vertices[x0*size+y0].Z
+				h10 := vertices[(x0+skip)*size+y0].Z
+				h01 := vertices[x0*size+y0+skip].Z
+				h11 := vertices[(x0+skip)*size+y0+skip].Z
+				u, v := float32(x-x0)/float32(skip), float32(y-y0)/float32(skip)
+				// same diagonal as addQuadN
+				if u+v <= 1 {
+					h = h00 + u*(h10-h00) + v*(h01-h00)
+				} else {
+					h = h11 + (1-u)*(h01-h11) + (1-v)*(h10-h11)
+				}
+			}
+			// x is the grid x direction, see neighbourOffsets
+			edge := -1
+			switch {
+			case level+1 >= maxLod:
+				// corners are never morphed
+			case y == 0:
+				edge = 0
+			case y == size-1:
+				edge = 1
+			case x == 0:
+				edge = 2
+			case x == size-1:
+				edge = 3
+			}
+			morphData[x*size+y] = g3.Vec2{h, float32(int(level) + (edge+1)*morphEdgeStride)}
+		}
+	}
+	return morphData
+}
+
+// triangle list for the occluder grid created by createPatchOccluder
+func createOccluderIndices(maxLod uint) []uint32 {
+	n := occluderSize(maxLod)
+	indices := make([]uint32, 0, (n-1)*(n-1)*6)
+	for i := uint(0); i < n-1; i++ {
+		for j := uint(0); j < n-1; j++ {
+			indices = addQuadN(indices, n, i, j, 1)
+		}
+	}
+	return indices
+}
+
 //
 // a---b
 // |  /|
@@ -424,7 +590,7 @@ func createAllLODIndices(maxLod uint, indicesChannel chan generatedLODIndices) u
 	for crackIndex := 0; crackIndex < numCrackTypes; crackIndex++ {
 		for lod := uint(0); lod < maxLod; lod++ {
 			go func(ci int, l uint) {
-				indices := createLODIndices(l, maxLod, indexToCrack(ci))
+				indices := createLODIndices(l, maxLod, uint(ci))
 				indicesChannel <- generatedLODIndices{l, ci, indices}
 			}(crackIndex, lod)
 		}
@@ -432,59 +598,71 @@ func createAllLODIndices(maxLod uint, indicesChannel chan generatedLODIndices) u
 	return numCrackTypes * maxLod
 }
 
-// TODO: How can this be done in parallel with goroutines?
-func (gm *GeoMipMap) buildQuadTreeRec(dev g3.GraphicsDevice, depth uint, x, y, w, h int, parent g3.SpatElement) (g3.SpatElement, int) {
-	// TODO: remove magic numbers; calc from LOD
-	if depth >= gm.maxDepth /*|| w <= gm.maxPatchWidth || h <= gm.maxPatchHeight*/ {
-		//println(w, h)
-		vertices, normals := createPatchVertices(gm.heightMap, x, y, w, h, gm.maxLOD, gm.whScale, gm.hScale)
-		bbox := g3.MakeBoundingBoxFromPoints(vertices)
-		center := bbox.CalculateCenter()
-		patch := patch{center, dev.NewVertexBufferVec3(vertices), dev.NewVertexBufferVec3(normals)}
-		return &g3.SpatLeaf{g3.SpatElementData{&bbox, parent, patch}}, 1
-	}
-	p := &g3.SpatNode{g3.SpatElementData{nil, parent, nil}, make([]g3.SpatElement, 4)}
-	c1, l1 := gm.buildQuadTreeRec(dev, depth+1, x, y, w/2, h/2, p)
-	c2, l2 := gm.buildQuadTreeRec(dev, depth+1, x+w/2, y, w/2, h/2, p)
-	c3, l3 := gm.buildQuadTreeRec(dev, depth+1, x, y+h/2, w/2, h/2, p)
-	c4, l4 := gm.buildQuadTreeRec(dev, depth+1, x+w/2, y+h/2, w/2, h/2, p)
-	bbox := g3.MakeBoundingBoxFromBoxes([]g3.BoundingBox{
-		*c1.GetBoundingVolume().(*g3.BoundingBox),
-		*c2.GetBoundingVolume().(*g3.BoundingBox),
-		*c3.GetBoundingVolume().(*g3.BoundingBox),
-		*c4.GetBoundingVolume().(*g3.BoundingBox)})
-	p.BVolume = &bbox
-	p.Children = []g3.SpatElement{c1, c2, c3, c4}
-	return p, l1 + l2 + l3 + l4
-}
-
 func (gm *GeoMipMap) buildLODIndices(dev g3.GraphicsDevice) {
 	gm.lodIndices = make([][]g3.IndexBuffer, numCrackTypes)
+	gm.indexData = make([][][]uint32, numCrackTypes)
 	for i, _ := range gm.lodIndices {
 		gm.lodIndices[i] = make([]g3.IndexBuffer, gm.maxLOD)
+		gm.indexData[i] = make([][]uint32, gm.maxLOD)
 	}
 	indicesChannel := make(chan generatedLODIndices)
 	numMipMaps := createAllLODIndices(gm.maxLOD, indicesChannel)
 	for i := uint(0); i < numMipMaps; i++ {
 		c := <-indicesChannel
 		gm.lodIndices[c.crackIndex][c.lod] = dev.NewIndexBuffer(c.indices)
+		gm.indexData[c.crackIndex][c.lod] = c.indices
 	}
 }
 
-func (gm *GeoMipMap) buildPatchVertices(dev g3.GraphicsDevice) {
-	w, h := gm.heightMap.Size()
-	root, _ := gm.buildQuadTreeRec(dev, 0, 0, 0, w, h, nil)
-	gm.root = root;
+// Places the leaves of the quadtree in the patch grid. Returns false if
+// the leaves don't cover each grid cell exactly once.
+func (gm *GeoMipMap) buildGrid() bool {
+	gm.patches = make([]*patch, gm.gridWidth*gm.gridHeight)
+	valid := true
+	g3.TraverseDepthFirst(gm.root, func(element g3.SpatElement, leaf bool) bool {
+		if !leaf {
+			return true
+		}
+		p, ok := element.GetData().(*patch)
+		if !ok || p.gridX < 0 || p.gridY < 0 || p.gridX >= gm.gridWidth || p.gridY >= gm.gridHeight ||
+			gm.patches[p.gridY*gm.gridWidth+p.gridX] != nil {
+			valid = false
+			return false
+		}
+		gm.patches[p.gridY*gm.gridWidth+p.gridX] = p
+		return true
+	})
+	for _, p := range gm.patches {
+		if p == nil {
+			return false
+		}
+	}
+	return valid
 }
 
-func NewGeoMipMap(dev g3.GraphicsDevice, heightMap HeightMap, maxDepth uint, maxPatchWidth, maxPatchHeight int, maxLOD uint, whScale, hScale float32) *GeoMipMap {
-	gmap := &GeoMipMap{heightMap, maxDepth, maxPatchWidth, maxPatchHeight, maxLOD, whScale, hScale, nil, nil}
-	gmap.buildLODIndices(dev)
-	gmap.buildPatchVertices(dev)
+// Terrain without patches and buffers, with the default LOD parameters
+func newGeoMipMap(heightMap HeightMap, patchSize int, maxLOD uint, whScale, hScale float32, gridWidth, gridHeight int) *GeoMipMap {
+	gm := &GeoMipMap{heightMap: heightMap, patchSize: patchSize, maxLOD: maxLOD, whScale: whScale, hScale: hScale,
+		gridWidth: gridWidth, gridHeight: gridHeight}
+	gm.SetLODParams(g3.Deg2Rad(60), 480, defaultPixelTolerance)
+	return gm
+}
+
+// Builds the terrain with the default options, see BuildGeoMipMap.
+// Returns nil if the parameters are invalid.
+func NewGeoMipMap(dev g3.GraphicsDevice, heightMap HeightMap, patchSize int, maxLOD uint, whScale, hScale float32) *GeoMipMap {
+	gmap, _ := BuildGeoMipMap(dev, heightMap, patchSize, maxLOD, whScale, hScale, nil)
 	return gmap
 }
 
+// Releases the buffers of all patches and the index buffers.
 func (gm *GeoMipMap) Release() {
+	for _, p := range gm.patches {
+		// paged terrains have holes
+		if p != nil {
+			p.releaseBuffers()
+		}
+	}
 	for _, lodBuffers := range gm.lodIndices {
 		for _, crackBuffer := range lodBuffers {
 			crackBuffer.Release()
@@ -492,57 +670,244 @@ func (gm *GeoMipMap) Release() {
 	}
 }
 
-func calculateLOD(frustum *g3.Frustum, center *g3.Vec3, width float32, maxLOD uint) int {
-	// TODO: Use actual position instead of near clipping plane for distance calculation?
-	d := int(g3.Clamp(frustum.Near.DistanceToPoint(center) / (width), 0.0, float32(maxLOD-1)))
-	return d
+const defaultPixelTolerance = 2.0
+
+// Sets the view used for LOD selection: the vertical field of view in
+// radians, the viewport height in pixels and the largest screen space error
+// in pixels a level may have.
+func (gm *GeoMipMap) SetLODParams(fovy float32, viewportHeight int, pixelTolerance float32) {
+	gm.lodScale = float32(viewportHeight) / (2.0 * g3.Tan(fovy/2.0))
+	gm.pixelTolerance = pixelTolerance
+}
+
+// Enables geomorphing with a vertex shader, nil disables it. The shader gets
+// the morph data of each vertex as texture coordinates of unit 0, the
+// uniforms morph (factor) and lod (level of the patch) and the arrays
+// edgeMorph[4] and edgeLod[4] for the vertices on the edges. Vertices of the
+// level are moved towards the morph height, see data/shaders/map.vs.glsl.
+func (gm *GeoMipMap) SetMorphShader(shader g3.Shader) {
+	gm.morphShader = shader
+	if shader != nil {
+		u := &gm.morphUniforms
+		u.morph = shader.GetUniformLocation("morph")
+		u.lod = shader.GetUniformLocation("lod")
+		for i := range u.edgeMorph {
+			index := "[" + strconv.Itoa(i) + "]"
+			u.edgeMorph[i] = shader.GetUniformLocation("edgeMorph" + index)
+			u.edgeLOD[i] = shader.GetUniformLocation("edgeLod" + index)
+		}
+	}
 }
 
-// TODO: Hack, use correct distance and neighbour coordinates from height map
-func  (gm *GeoMipMap) selectIndexBuffer(frustum *g3.Frustum, center *g3.Vec3, maxLOD uint) (int, int) {
-	w := float32(32.0*0.01)
-
-	n := g3.Vec3{center.X, center.Y, 0}
-	d := calculateLOD(frustum, &n, w, maxLOD)
-
-	n = g3.Vec3{center.X-w, center.Y, 0}
-	td := calculateLOD(frustum, &n, w, maxLOD)
-
-	n = g3.Vec3{center.X, center.Y-w, 0}
-	ld := calculateLOD(frustum, &n, w, maxLOD)
+// Distance from which level lod of p is used, where its error reaches the
+// tolerance. Each level is used over at least the distance range of the level
+// before it, levels of equal error would be skipped with their morph.
+func (gm *GeoMipMap) lodDistance(p *patch, lod int) float32 {
+	d := float32(0)
+	for l := 1; l <= lod; l++ {
+		d = g3.Max(p.errors[l]*gm.lodScale/gm.pixelTolerance, 2*d)
+	}
+	return d
+}
 
-	n = g3.Vec3{center.X, center.Y+w, 0}
-	rd := calculateLOD(frustum, &n, w, maxLOD)
+// Patches morph towards the next level in the second half of the distance
+// range of their level. They are fully morphed when the level switches.
+func (gm *GeoMipMap) morphFactor(p *patch, distance float32) float32 {
+	if p.lod+1 >= len(p.errors) {
+		return 0
+	}
+	start, end := gm.lodDistance(p, p.lod), gm.lodDistance(p, p.lod+1)
+	if end <= start {
+		if distance >= end {
+			return 1
+		}
+		return 0
+	}
+	return g3.Clamp(2*(distance-start)/(end-start)-1, 0, 1)
+}
 
-	n = g3.Vec3{center.X+w, center.Y, 0}
-	bd := calculateLOD(frustum, &n, w, maxLOD)
+// Coarsest level of p whose projected error seen from eye is within the tolerance.
+func (gm *GeoMipMap) selectLOD(p *patch, eye *g3.Vec3) int {
+	distance := p.center.Distance(*eye)
+	lod := 0
+	for lod+1 < len(p.errors) && gm.lodDistance(p, lod+1) <= distance {
+		lod++
+	}
+	return lod
+}
 
-	mask := crackNone
-	if td < d {
-		mask |= crackTop
+// nil outside of the grid
+func (gm *GeoMipMap) neighbour(p *patch, dx, dy int) *patch {
+	x, y := p.gridX+dx, p.gridY+dy
+	if x < 0 || y < 0 || x >= gm.gridWidth || y >= gm.gridHeight {
+		return nil
 	}
-	if ld < d {
-		mask |= crackLeft
+	return gm.patches[y*gm.gridWidth+x]
+}
+
+// Grid offsets of the neighbours sharing an edge with a patch. The index
+// buffers have y along their rows: left and right are y neighbours, top and
+// bottom are x neighbours.
+var neighbourOffsets = [4]struct {
+	dx, dy int
+	crack  uint
+}{
+	{0, -1, crackLeft},
+	{0, 1, crackRight},
+	{-1, 0, crackTop},
+	{1, 0, crackBottom},
+}
+
+// Selects the level of every patch, then refines patches until the levels
+// of neighbours differ by at most one, which the crack templates can fill.
+// Neighbours are looked up in the grid, which may have holes.
+func (gm *GeoMipMap) selectLODs(patches []*patch, eye *g3.Vec3) {
+	for _, p := range patches {
+		p.lod = gm.selectLOD(p, eye)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range patches {
+			for _, o := range neighbourOffsets {
+				if n := gm.neighbour(p, o.dx, o.dy); n != nil && p.lod > n.lod+1 {
+					p.lod = n.lod + 1
+					changed = true
+				}
+			}
+		}
 	}
-	if rd < d {
-		mask |= crackRight
+	// a patch doesn't morph further than finer neighbours, their change of
+	// level releases its clamp without a jump
+	for lod := 0; lod < int(gm.maxLOD); lod++ {
+		for _, p := range patches {
+			if p.lod != lod {
+				continue
+			}
+			p.morph = gm.morphFactor(p, p.center.Distance(*eye))
+			for _, o := range neighbourOffsets {
+				if n := gm.neighbour(p, o.dx, o.dy); n != nil && n.lod < p.lod {
+					p.morph = g3.Min(p.morph, n.morph)
+				}
+			}
+		}
 	}
-	if bd < d {
-		mask |= crackBottom
+	// vertices on an edge are drawn at the finer level of its patches
+	for _, p := range patches {
+		for i, o := range neighbourOffsets {
+			p.edgeLOD[i], p.edgeMorph[i] = p.lod, p.morph
+			if n := gm.neighbour(p, o.dx, o.dy); n != nil && n.lod < p.lod {
+				p.edgeLOD[i], p.edgeMorph[i] = n.lod, n.morph
+			} else if n != nil && n.lod == p.lod {
+				p.edgeMorph[i] = g3.Min(p.morph, n.morph)
+			}
+		}
 	}
+}
 
-	return crackToIndex(mask), d
+// Edges next to finer neighbours get the crack templates. selectLODs has to be called first.
+func (gm *GeoMipMap) selectIndexBuffer(p *patch) (int, int) {
+	mask := crackNone
+	for _, o := range neighbourOffsets {
+		if n := gm.neighbour(p, o.dx, o.dy); n != nil && n.lod < p.lod {
+			mask |= o.crack
+		}
+	}
+	return int(mask), p.lod
 }
 
-func (gm *GeoMipMap) Render(dev g3.GraphicsDevice, frustum *g3.Frustum) {
-	gm.root.TraverseFrustum(frustum, func(element g3.SpatElement, leaf bool) bool {
+func (gm *GeoMipMap) renderFunc(dev g3.GraphicsDevice) g3.TraverseFunc {
+	return func(element g3.SpatElement, leaf bool) bool {
 		if leaf {
-			patch := element.GetData().(patch)
+			patch := element.GetData().(*patch)
 			dev.SetVertices(patch.vertices)
 			dev.SetNormals(patch.normals)
-			lodIndex, distIndex := gm.selectIndexBuffer(frustum, &patch.center, gm.maxLOD)
+			lodIndex, distIndex := gm.selectIndexBuffer(patch)
+			if gm.morphShader != nil {
+				u := &gm.morphUniforms
+				dev.SetTexCoords(patch.morphTargets, 0)
+				gm.morphShader.SetFloat(u.morph, patch.morph)
+				gm.morphShader.SetFloat(u.lod, float32(distIndex))
+				for i := range u.edgeMorph {
+					gm.morphShader.SetFloat(u.edgeMorph[i], patch.edgeMorph[i])
+					gm.morphShader.SetFloat(u.edgeLOD[i], float32(patch.edgeLOD[i]))
+				}
+			}
 			dev.DrawIndexed(gm.lodIndices[lodIndex][distIndex])
 		}
 		return true
+	}
+}
+
+// Renders the patches in the frustum, eye is the camera position used for LOD selection.
+func (gm *GeoMipMap) Render(dev g3.GraphicsDevice, frustum *g3.Frustum, eye *g3.Vec3) {
+	gm.selectLODs(gm.patches, eye)
+	gm.root.TraverseFrustum(frustum, gm.renderFunc(dev))
+}
+
+// How far the occluder of p is lowered below the coarsest level
+func (p *patch) occluderDrop() float32 {
+	return p.vertexData[0].Z - p.occluder[0].Z
+}
+
+// Occluder vertex i, j of p in a grid of n x n vertices. Vertices shared with
+// neighbours are lowered as far as the lowest of their occluders, so the
+// occluders meet without gaps.
+func (gm *GeoMipMap) occluderVertex(p *patch, i, j, n int) g3.Vec3 {
+	size := int(pow2(gm.maxLOD)) + 1
+	skip := (size - 1) / (n - 1)
+	v := p.vertexData[i*skip*size+j*skip]
+	drop := p.occluderDrop()
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			if (dx < 0 && i > 0) || (dx > 0 && i < n-1) || (dy < 0 && j > 0) || (dy > 0 && j < n-1) {
+				continue
+			}
+			if q := gm.neighbour(p, dx, dy); q != nil {
+				drop = g3.Max(drop, q.occluderDrop())
+			}
+		}
+	}
+	v.Z -= drop
+	return v
+}
+
+// Rasterizes conservative occluders of all patches in the frustum as one mesh,
+// the buffer only treats shared edges as closed within a mesh. ob has to be
+// cleared with the view projection matrix of the frustum first.
+func (gm *GeoMipMap) RasterizeOccluders(ob *g3.OcclusionBuffer, frustum *g3.Frustum) {
+	n := int(occluderSize(gm.maxLOD))
+	rowLength := gm.gridWidth*(n-1) + 1
+	var vertices []g3.Vec3
+	var indices []uint32
+	shared := make(map[int]uint32)
+	local := make([]uint32, n*n)
+	gm.root.TraverseFrustum(frustum, func(element g3.SpatElement, leaf bool) bool {
+		if !leaf {
+			return true
+		}
+		p := element.GetData().(*patch)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				id := (p.gridY*(n-1)+j)*rowLength + p.gridX*(n-1) + i
+				k, ok := shared[id]
+				if !ok {
+					k = uint32(len(vertices))
+					shared[id] = k
+					vertices = append(vertices, gm.occluderVertex(p, i, j, n))
+				}
+				local[i*n+j] = k
+			}
+		}
+		for _, k := range gm.occluderIndices {
+			indices = append(indices, local[k])
+		}
+		return true
 	})
+	ob.RasterizeTriangles(vertices, indices)
+}
+
+// Same as Render, but patches hidden by the occluders in ob are skipped.
+func (gm *GeoMipMap) RenderOccluded(dev g3.GraphicsDevice, frustum *g3.Frustum, eye *g3.Vec3, ob *g3.OcclusionBuffer) {
+	gm.selectLODs(gm.patches, eye)
+	gm.root.TraverseFrustum(frustum, ob.CullFunc(gm.renderFunc(dev)))
 }
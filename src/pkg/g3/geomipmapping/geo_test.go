@@ -1,6 +1,7 @@
 package geomipmapping
 
 import (
+	"g3"
 	"testing"
 )
 
@@ -19,7 +20,612 @@ func TestPow(t *testing.T) {
 }
 
 func TestIndices(t *testing.T) {
-	NewGeoMipMap()
+	// 4x4 quads at level 0, 2x2 at level 1
+	if n := len(createLODIndices(0, 2, crackNone)); n != 4*4*6 {
+		t.Errorf("%d indices at level 0", n)
+	}
+	if n := len(createLODIndices(1, 2, crackNone)); n != 2*2*6 {
+		t.Errorf("%d indices at level 1", n)
+	}
+	// a crack fixed edge has an extra triangle in each of its quads
+	if n := len(createLODIndices(1, 2, crackLeft)); n != 2*2*6+2*3 {
+		t.Errorf("%d indices at level 1 with crack", n)
+	}
+}
+
+// creates buffers without a graphics context
+type testBuffer struct {
+	size     int
+	released int
+}
+
+func (b *testBuffer) Release() {
+	b.released++
+}
+
+type testDevice struct {
+	g3.GraphicsDevice
+}
+
+func (dev testDevice) NewVertexBufferVec2(vertices []g3.Vec2) g3.VertexBuffer {
+	return &testBuffer{size: len(vertices)}
+}
+
+func (dev testDevice) NewVertexBufferVec3(vertices []g3.Vec3) g3.VertexBuffer {
+	return &testBuffer{size: len(vertices)}
+}
+
+func (dev testDevice) NewIndexBuffer(indices []uint32) g3.IndexBuffer {
+	return &testBuffer{size: len(indices)}
+}
+
+type waveHeightMap struct {
+	width, height int
+}
+
+func (hm *waveHeightMap) Size() (width, height int) {
+	return hm.width, hm.height
+}
+
+func (hm *waveHeightMap) Height(x, y float32) float32 {
+	return 0.5 + 0.3*g3.Sin(x*0.3)*g3.Cos(y*0.2) + 0.2*g3.Sin(x*0.05)
+}
+
+func TestBuildParallel(t *testing.T) {
+	hm := &waveHeightMap{256, 256}
+	serial, err := BuildGeoMipMap(testDevice{}, hm, 32, 5, 1, 10, &BuildOptions{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress := 0
+	parallel, err := BuildGeoMipMap(testDevice{}, hm, 32, 5, 1, 10,
+		&BuildOptions{Workers: 4, Progress: func(done, total int) {
+			if done != progress+1 || total != 64 {
+				t.Errorf("progress %d of %d after %d", done, total, progress)
+			}
+			progress = done
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != 64 {
+		t.Errorf("progress stopped at %d", progress)
+	}
+	for i, p := range serial.patches {
+		q := parallel.patches[i]
+		if p.center != q.center || len(p.vertexData) != len(q.vertexData) || p.vertices.(*testBuffer).size != 33*33 {
+			t.Fatalf("patch %d differs", i)
+		}
+	}
+	if *serial.root.GetBoundingVolume().(*g3.BoundingBox) != *parallel.root.GetBoundingVolume().(*g3.BoundingBox) {
+		t.Error("bounding boxes differ")
+	}
+
+	cancel := make(chan bool, 1)
+	cancel <- true
+	if _, err := BuildGeoMipMap(testDevice{}, hm, 32, 5, 1, 10, &BuildOptions{Cancel: cancel}); err != ErrBuildCanceled {
+		t.Errorf("canceled build returned %v", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, &waveHeightMap{70, 50}, 16, 3, 0.5, 10)
+	gm.Release()
+	for i, p := range gm.patches {
+		for _, b := range []g3.VertexBuffer{p.vertices, p.normals, p.morphTargets} {
+			if n := b.(*testBuffer).released; n != 1 {
+				t.Fatalf("patch %d buffer released %d times", i, n)
+			}
+		}
+	}
+	for _, lodBuffers := range gm.lodIndices {
+		for _, b := range lodBuffers {
+			if n := b.(*testBuffer).released; n != 1 {
+				t.Fatalf("index buffer released %d times", n)
+			}
+		}
+	}
+}
+
+func TestPatchGrid(t *testing.T) {
+	if _, err := BuildGeoMipMap(testDevice{}, &waveHeightMap{64, 64}, 12, 3, 1, 1, nil); err != ErrPatchSize {
+		t.Errorf("patch size 12 with 8 quads returned %v", err)
+	}
+
+	// 99x69 sample intervals in 16x16 patches with a stride of 2
+	hm := &waveHeightMap{100, 70}
+	gm, err := BuildGeoMipMap(testDevice{}, hm, 16, 3, 1, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gm.gridWidth != 7 || gm.gridHeight != 5 || len(gm.patches) != 35 {
+		t.Fatalf("%dx%d grid with %d patches", gm.gridWidth, gm.gridHeight, len(gm.patches))
+	}
+	bbox := gm.root.GetBoundingVolume().(*g3.BoundingBox)
+	if bbox.Min.X != 0 || bbox.Min.Y != 0 || bbox.Max.X != 99 || bbox.Max.Y != 69 {
+		t.Errorf("terrain covers %v", bbox)
+	}
+
+	size := int(pow2(gm.maxLOD) + 1)
+	for _, p := range gm.patches {
+		for i, v := range p.vertexData {
+			if v.Z != hm.Height(v.X, v.Y) {
+				t.Fatalf("patch %d,%d: vertex %d isn't a sample", p.gridX, p.gridY, i)
+			}
+		}
+		// the last row of a patch is the first row of its neighbour
+		if right := gm.neighbour(p, 1, 0); right != nil {
+			for j := 0; j < size; j++ {
+				if p.vertexData[(size-1)*size+j] != right.vertexData[j] || p.normalData[(size-1)*size+j] != right.normalData[j] {
+					t.Fatalf("patch %d,%d: border vertex %d not shared", p.gridX, p.gridY, j)
+				}
+			}
+		}
+		if bottom := gm.neighbour(p, 0, 1); bottom != nil {
+			for i := 0; i < size; i++ {
+				if p.vertexData[i*size+size-1] != bottom.vertexData[i*size] || p.normalData[i*size+size-1] != bottom.normalData[i*size] {
+					t.Fatalf("patch %d,%d: border vertex %d not shared", p.gridX, p.gridY, i)
+				}
+			}
+		}
+	}
+}
+
+// edge vertices of a patch index list, side is the index into neighbourOffsets
+func edgeVertexCount(indices []uint32, size uint32, side int) int {
+	found := make(map[uint32]bool)
+	for _, k := range indices {
+		x, y := k/size, k%size
+		switch {
+		case side == 0 && y == 0, side == 1 && y == size-1, side == 2 && x == 0, side == 3 && x == size-1:
+			found[k] = true
+		}
+	}
+	return len(found)
+}
+
+// Checks that neighbouring patches use the same vertices along their edges
+func checkEdges(t *testing.T, gm *GeoMipMap) {
+	size := uint32(pow2(gm.maxLOD) + 1)
+	for _, p := range gm.patches {
+		crack, lod := gm.selectIndexBuffer(p)
+		indices := createLODIndices(uint(lod), gm.maxLOD, uint(crack))
+		for side, o := range neighbourOffsets {
+			n := gm.neighbour(p, o.dx, o.dy)
+			if n == nil {
+				continue
+			}
+			if p.lod > n.lod+1 || n.lod > p.lod+1 {
+				t.Fatalf("levels %d and %d next to each other", p.lod, n.lod)
+			}
+			ncrack, nlod := gm.selectIndexBuffer(n)
+			nindices := createLODIndices(uint(nlod), gm.maxLOD, uint(ncrack))
+			// side^1 is the opposite side
+			if a, b := edgeVertexCount(indices, size, side), edgeVertexCount(nindices, size, side^1); a != b {
+				t.Errorf("patch %d,%d: %d edge vertices, neighbour has %d", p.gridX, p.gridY, a, b)
+			}
+		}
+	}
+}
+
+func TestNoCracks(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, &waveHeightMap{256, 256}, 32, 5, 1, 0.3)
+	gm.SetLODParams(g3.Deg2Rad(60), 480, 2)
+	eye := g3.Vec3{10, 10, 5}
+	gm.selectLODs(gm.patches, &eye)
+	checkEdges(t, gm)
+
+	levels := make(map[int]bool)
+	for _, p := range gm.patches {
+		levels[p.lod] = true
+	}
+	if len(levels) < 3 {
+		t.Errorf("only %d levels selected", len(levels))
+	}
+}
+
+// Rough and flat columns of patchSize samples
+type columnHeightMap struct {
+	size, patchSize int
+}
+
+func (hm *columnHeightMap) Size() (width, height int) {
+	return hm.size, hm.size
+}
+
+func (hm *columnHeightMap) Height(x, y float32) float32 {
+	if int(x)/hm.patchSize%2 == 0 {
+		return 0.5 + 0.4*g3.Sin(x*1.3)*g3.Cos(y*0.9)
+	}
+	return 0.5
+}
+
+func TestCrackMasks(t *testing.T) {
+	// every mask fills the patch, area in quads of the finest level
+	for mask := uint(0); mask < numCrackTypes; mask++ {
+		for lod := uint(0); lod < 3; lod++ {
+			indices := createLODIndices(lod, 3, mask)
+			area := 0
+			for i := 0; i < len(indices); i += 3 {
+				ax, ay := int(indices[i]%9), int(indices[i]/9)
+				bx, by := int(indices[i+1]%9), int(indices[i+1]/9)
+				cx, cy := int(indices[i+2]%9), int(indices[i+2]/9)
+				cross := (bx-ax)*(cy-ay) - (by-ay)*(cx-ax)
+				if cross < 0 {
+					cross = -cross
+				}
+				area += cross
+			}
+			if area != 2*8*8 {
+				t.Errorf("mask %d, level %d: area %d, expected %d", mask, lod, area/2, 8*8)
+			}
+		}
+	}
+
+	// finer neighbours on opposite sides
+	gm := NewGeoMipMap(testDevice{}, &waveHeightMap{129, 129}, 32, 5, 1, 1)
+	for _, p := range gm.patches {
+		p.lod = 3
+	}
+	center := gm.patches[2*4+2]
+	for _, o := range neighbourOffsets {
+		gm.neighbour(center, o.dx, o.dy).lod = 2
+	}
+	if crack, _ := gm.selectIndexBuffer(center); uint(crack) != crackTop|crackBottom|crackLeft|crackRight {
+		t.Errorf("crack mask %b", crack)
+	}
+	gm.neighbour(center, 0, -1).lod = 3
+	if crack, _ := gm.selectIndexBuffer(center); uint(crack) != crackTop|crackBottom|crackRight {
+		t.Errorf("crack mask %b", crack)
+	}
+	gm.neighbour(center, 0, 1).lod = 3
+	if crack, _ := gm.selectIndexBuffer(center); uint(crack) != crackTop|crackBottom {
+		t.Errorf("crack mask %b", crack)
+	}
+	checkEdges(t, gm)
+
+	// rough and flat columns give finer neighbours on opposite sides
+	gm = NewGeoMipMap(testDevice{}, &columnHeightMap{256, 32}, 32, 5, 1, 10)
+	gm.SetLODParams(g3.Deg2Rad(60), 480, 2)
+	masks := make(map[int]bool)
+	for _, eye := range []g3.Vec3{{128, 128, 5}, {128, 128, 100}, {10, 10, 5}, {128, 128, 400}} {
+		gm.selectLODs(gm.patches, &eye)
+		for _, p := range gm.patches {
+			crack, _ := gm.selectIndexBuffer(p)
+			masks[crack] = true
+		}
+		checkEdges(t, gm)
+	}
+	if !masks[int(crackLeft|crackRight)] && !masks[int(crackTop|crackBottom)] {
+		t.Errorf("no opposite crack sides in %v", masks)
+	}
+}
+
+// Flat ground with a plateau of height 1 between x = 48 and x = 80
+type plateauRidgeHeightMap struct{}
+
+func (hm plateauRidgeHeightMap) Size() (width, height int) {
+	return 129, 129
+}
+
+func (hm plateauRidgeHeightMap) Height(x, y float32) float32 {
+	return g3.Clamp(g3.Min(x-40, 88-x)/8, 0, 1)
+}
+
+func TestPatchOccluders(t *testing.T) {
+	// a single level patch is its own occluder
+	flat := []g3.Vec3{{0, 0, 1}, {0, 1, 1}, {1, 0, 1}, {1, 1, 1}}
+	if occluder, indices := createPatchOccluder(flat, 0), createOccluderIndices(0); len(occluder) != 4 || len(indices) != 6 || occluder[3] != flat[3] {
+		t.Errorf("occluder %v, indices %v", occluder, indices)
+	}
+
+	gm := NewGeoMipMap(testDevice{}, &waveHeightMap{129, 129}, 16, 3, 1, 10)
+	n := 3
+	for _, p := range gm.patches {
+		occluder := make([]g3.Vec3, n*n)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				occluder[i*n+j] = gm.occluderVertex(p, i, j, n)
+			}
+		}
+		// no vertex of the patch is below the occluder
+		for _, v := range p.vertexData {
+			for k := 0; k+2 < len(gm.occluderIndices); k += 3 {
+				a, b, c := &occluder[gm.occluderIndices[k]], &occluder[gm.occluderIndices[k+1]], &occluder[gm.occluderIndices[k+2]]
+				u, v2, w, ok := barycentricXY(v.X, v.Y, a, b, c)
+				if !ok || u < -1e-4 || v2 < -1e-4 || w < -1e-4 {
+					continue
+				}
+				if h := u*a.Z + v2*b.Z + w*c.Z; h > v.Z+1e-4 {
+					t.Fatalf("patch %d,%d: occluder at %f above vertex %v", p.gridX, p.gridY, h, v)
+				}
+			}
+		}
+		// shared vertices are lowered the same way
+		if right := gm.neighbour(p, 1, 0); right != nil {
+			for j := 0; j < n; j++ {
+				if a, b := gm.occluderVertex(p, n-1, j, n), gm.occluderVertex(right, 0, j, n); a != b {
+					t.Fatalf("patch %d,%d: occluder vertex %v, neighbour has %v", p.gridX, p.gridY, a, b)
+				}
+			}
+		}
+	}
+}
+
+func TestTerrainOcclusion(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, plateauRidgeHeightMap{}, 16, 3, 1, 20)
+	eye, center, up := g3.Vec3{5, 64, 3}, g3.Vec3{100, 64, 3}, g3.Vec3{0, 0, 1}
+	projection := g3.MakePerspectiveMatrix(g3.Deg2Rad(60), 1, 0.5, 500)
+	view := g3.MakeLookAtMatrix(&eye, &center, &up)
+	viewProjection := projection.Multiply(&view)
+	frustum := g3.MakeFrustumFromMatrix(&viewProjection)
+	ob := g3.NewOcclusionBuffer(128, 128)
+	ob.Clear(&viewProjection)
+	gm.RasterizeOccluders(ob, frustum)
+
+	// patches in front of the plateau are seen, the ground behind it is hidden
+	g3.TraverseDepthFirst(gm.root, func(element g3.SpatElement, leaf bool) bool {
+		if !leaf {
+			return true
+		}
+		p := element.GetData().(*patch)
+		if p.gridY < 3 || p.gridY > 4 {
+			return true
+		}
+		visible := ob.TestBoundingVolume(element.GetBoundingVolume())
+		if p.gridX <= 2 && !visible || p.gridX >= 6 && visible {
+			t.Errorf("patch %d,%d: visible is %v", p.gridX, p.gridY, visible)
+		}
+		return true
+	})
+}
+
+func TestPatchErrors(t *testing.T) {
+	maxLod := uint(4)
+	size := pow2(maxLod) + 1
+	flat, wave, tilted := make([]g3.Vec3, size*size), make([]g3.Vec3, size*size), make([]g3.Vec3, size*size)
+	for x := uint(0); x < size; x++ {
+		for y := uint(0); y < size; y++ {
+			fx, fy := float32(x), float32(y)
+			flat[x*size+y] = g3.Vec3{fx, fy, 2}
+			wave[x*size+y] = g3.Vec3{fx, fy, g3.Sin(fx*0.7) * g3.Cos(fy*0.4)}
+			tilted[x*size+y] = g3.Vec3{fx, fy, 0.3*fx - 0.2*fy}
+		}
+	}
+	// planes are exact at every level
+	for _, vertices := range [][]g3.Vec3{flat, tilted} {
+		for lod, e := range createPatchErrors(vertices, maxLod) {
+			if !g3.ApproxEqualEps(e, 0, 1e-5) {
+				t.Errorf("plane has error %f at level %d", e, lod)
+			}
+		}
+	}
+	errors := createPatchErrors(wave, maxLod)
+	if len(errors) != int(maxLod) || errors[0] != 0 || errors[1] <= 0 {
+		t.Fatalf("errors %v", errors)
+	}
+	for lod := 1; lod < len(errors); lod++ {
+		if errors[lod] < errors[lod-1] {
+			t.Errorf("errors %v not increasing", errors)
+		}
+	}
+	// level 1 drops every other vertex, its error is their largest offset
+	var e float32
+	for x := uint(1); x < size; x += 2 {
+		for y := uint(0); y < size; y += 2 {
+			e = g3.Max(e, g3.Abs(wave[x*size+y].Z-(wave[(x-1)*size+y].Z+wave[(x+1)*size+y].Z)/2))
+		}
+	}
+	if errors[1] < e-1e-5 {
+		t.Errorf("error %f at level 1, a dropped vertex is %f off", errors[1], e)
+	}
+}
+
+func TestSelectLOD(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, &waveHeightMap{129, 129}, 32, 4, 1, 3)
+	gm.SetLODParams(g3.Deg2Rad(60), 480, 2)
+	p := gm.patches[5]
+	if p.errors[len(p.errors)-1] <= 0 {
+		t.Fatal("flat patch")
+	}
+	levels := func(tolerance float32) []int {
+		gm.SetLODParams(g3.Deg2Rad(60), 480, tolerance)
+		var lods []int
+		for d := float32(1); d < 4000; d *= 1.5 {
+			eye := p.center.Add(g3.Vec3{0, 0, d})
+			lods = append(lods, gm.selectLOD(p, &eye))
+		}
+		return lods
+	}
+	// finest up close, coarsest far away, coarser with a larger tolerance
+	fine, coarse := levels(1), levels(4)
+	if fine[0] != 0 || fine[len(fine)-1] != len(p.errors)-1 {
+		t.Errorf("levels %v", fine)
+	}
+	changed := false
+	for i := range fine {
+		if i > 0 && fine[i] < fine[i-1] {
+			t.Errorf("levels %v get finer with distance", fine)
+		}
+		if coarse[i] < fine[i] {
+			t.Errorf("levels %v finer than %v with a larger tolerance", coarse, fine)
+		}
+		changed = changed || coarse[i] != fine[i]
+	}
+	if !changed {
+		t.Errorf("levels %v don't change with the tolerance", fine)
+	}
+	// the selected level's projected error is within the tolerance
+	for d := float32(1); d < 4000; d *= 1.5 {
+		eye := p.center.Add(g3.Vec3{0, 0, d})
+		lod := gm.selectLOD(p, &eye)
+		if pixels := p.errors[lod] * gm.lodScale / d; pixels > gm.pixelTolerance*1.0001 {
+			t.Errorf("level %d at distance %f has %f pixels error", lod, d, pixels)
+		}
+	}
+}
+
+// counts nothing, geomorphing only needs a shader to be set
+type testShader struct {
+	g3.Shader
+}
+
+func (s testShader) GetUniformLocation(name string) uint { return 0 }
+func (s testShader) SetFloat(location uint, v float32)   {}
+
+func TestPatchMorphData(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, &waveHeightMap{129, 129}, 32, 4, 1, 3)
+	size := int(pow2(gm.maxLOD)) + 1
+	for _, p := range gm.patches {
+		for k, v := range p.vertexData {
+			level, edge := morphLevel(p.morphData[k])
+			// fully morphed vertices lie on the surface of the next level,
+			// on the edges that of both patches
+			if level+1 < int(gm.maxLOD) {
+				gm.SetQueryLOD(level + 1)
+				if h, ok := gm.HeightAt(v.X, v.Y); !ok || !g3.ApproxEqualEps(h, p.morphData[k].X, 1e-4) {
+					t.Fatalf("patch %d,%d vertex %v: morph height %f, level %d has %f", p.gridX, p.gridY, v, p.morphData[k].X, level+1, h)
+				}
+			}
+			x, y := k/size, k%size
+			expected := -1
+			switch {
+			case level+1 == int(gm.maxLOD):
+			case y == 0:
+				expected = 0
+			case y == size-1:
+				expected = 1
+			case x == 0:
+				expected = 2
+			case x == size-1:
+				expected = 3
+			}
+			if edge != expected {
+				t.Fatalf("vertex %d,%d on edge %d", x, y, edge)
+			}
+		}
+	}
+}
+
+func TestMorphFactor(t *testing.T) {
+	gm := &GeoMipMap{maxLOD: 4}
+	// one unit of error at distance 100 is one pixel
+	gm.SetLODParams(g3.Deg2Rad(90), 200, 1)
+	tests := []struct {
+		errors   []float32
+		lod      int
+		distance float32
+		morph    float32
+	}{
+		{[]float32{0, 1, 2, 4}, 1, 100, 0},
+		{[]float32{0, 1, 2, 4}, 1, 150, 0},
+		{[]float32{0, 1, 2, 4}, 1, 175, 0.5},
+		{[]float32{0, 1, 2, 4}, 1, 200, 1},
+		{[]float32{0, 1, 2, 4}, 1, 300, 1},
+		{[]float32{0, 1, 2, 4}, 3, 500, 0},
+		// levels of equal error get a distance range too
+		{[]float32{0, 1, 1, 4}, 1, 175, 0.5},
+		{[]float32{0, 1, 1, 4}, 2, 350, 0.5},
+		// flat patches are always fully morphed
+		{[]float32{0, 0, 0, 0}, 1, 0, 1},
+	}
+	for i, test := range tests {
+		p := &patch{errors: test.errors, lod: test.lod}
+		if f := gm.morphFactor(p, test.distance); !g3.ApproxEqual(f, test.morph) {
+			t.Errorf("%d: morph factor %f, expected %f", i, f, test.morph)
+		}
+	}
+
+	// a level is fully morphed where the next one starts unmorphed
+	p := &patch{errors: []float32{0, 0.5, 0.5, 3}}
+	for lod := 0; lod+1 < len(p.errors); lod++ {
+		d := gm.lodDistance(p, lod+1)
+		eye := g3.Vec3{d, 0, 0}
+		p.lod = lod
+		before := gm.morphFactor(p, d-0.01)
+		p.lod = lod + 1
+		if before < 0.99 || gm.morphFactor(p, d) != 0 || gm.selectLOD(p, &eye) != lod+1 {
+			t.Errorf("level %d: morph factor %f before the switch", lod, before)
+		}
+	}
+}
+
+// Rough terrain in the first patch, gentle ripples after it
+type roughEdgeHeightMap struct {
+	patchSize int
+}
+
+func (hm *roughEdgeHeightMap) Size() (width, height int) {
+	return 3*hm.patchSize + 1, hm.patchSize + 1
+}
+
+func (hm *roughEdgeHeightMap) Height(x, y float32) float32 {
+	if x < float32(hm.patchSize) {
+		return 0.5 + 0.4*g3.Sin(x*1.3)*g3.Cos(y*0.9)
+	}
+	return 0.5 + 0.02*g3.Sin(x*2.1)*g3.Cos(y*1.7)
+}
+
+func TestMorphClamp(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, &roughEdgeHeightMap{16}, 16, 4, 1, 3)
+	gm.SetLODParams(g3.Deg2Rad(60), 480, 2)
+	gm.SetMorphShader(testShader{})
+	gm.SetQueryLOD(RenderedLOD)
+	rough, gentle := gm.patches[0], gm.patches[1]
+
+	// the gentle patch would be two levels coarser than allowed next to
+	// the rough one when it switches
+	d := gm.lodDistance(rough, 1)
+	heights := func(distance float32) []float32 {
+		eye := rough.center.Sub(g3.Vec3{distance, 0, 0})
+		gm.selectLODs(gm.patches, &eye)
+		if gm.selectLOD(gentle, &eye) < gentle.lod+1 {
+			t.Fatalf("gentle patch not clamped at level %d", gentle.lod)
+		}
+		// inside the patch, the crack fixes at its edges change with the levels
+		var h []float32
+		for y := float32(5); y <= 11; y += 0.5 {
+			for x := float32(21); x <= 27; x += 0.5 {
+				z, _ := gm.HeightAt(x, y)
+				h = append(h, z)
+			}
+		}
+		return h
+	}
+	before := heights(d - 0.01)
+	lod := gentle.lod
+	after := heights(d + 0.01)
+	if gentle.lod != lod+1 {
+		t.Fatalf("gentle patch at level %d, then %d", lod, gentle.lod)
+	}
+	for i := range before {
+		if g3.Abs(before[i]-after[i]) > 1e-3 {
+			t.Fatalf("height %f, %f after the rough patch switched", before[i], after[i])
+		}
+	}
+
+	// both sides of an edge morph its vertices the same way
+	for _, p := range gm.patches {
+		for side, o := range neighbourOffsets {
+			if n := gm.neighbour(p, o.dx, o.dy); n != nil && (p.edgeLOD[side] != n.edgeLOD[side^1] || p.edgeMorph[side] != n.edgeMorph[side^1]) {
+				t.Errorf("patch %d,%d: edge at level %d, %f, neighbour has %d, %f", p.gridX, p.gridY,
+					p.edgeLOD[side], p.edgeMorph[side], n.edgeLOD[side^1], n.edgeMorph[side^1])
+			}
+		}
+	}
+}
+
+func benchmarkBuild(b *testing.B, workers int) {
+	hm := &waveHeightMap{1024, 1024}
+	for i := 0; i < b.N; i++ {
+		BuildGeoMipMap(testDevice{}, hm, 32, 5, 1, 10, &BuildOptions{Workers: workers})
+	}
+}
+
+func BenchmarkBuildSerial(b *testing.B) {
+	benchmarkBuild(b, 1)
+}
 
-	fmt.Println("", createPatchIndices(0, 2))
+func BenchmarkBuildParallel(b *testing.B) {
+	benchmarkBuild(b, 4)
 }
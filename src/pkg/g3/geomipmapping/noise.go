@@ -0,0 +1,96 @@
+package geomipmapping
+
+import (
+	"g3"
+	"rand"
+)
+
+// Gradient noise in about [-1, 1], the lattice repeats every 256 units.
+type gradientNoise struct {
+	perm [512]uint8
+}
+
+func newGradientNoise(seed int64) *gradientNoise {
+	n := new(gradientNoise)
+	p := rand.New(rand.NewSource(seed)).Perm(256)
+	for i := range n.perm {
+		n.perm[i] = uint8(p[i&255])
+	}
+	return n
+}
+
+// Dot product of one of eight gradients with x, y
+func grad(hash uint8, x, y float32) float32 {
+	switch hash & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	}
+	return -y
+}
+
+func fade(t float32) float32 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+// Improved Perlin noise, zero at integer positions
+func (n *gradientNoise) perlin(x, y float32) float32 {
+	ix, fx := floor(x)
+	iy, fy := floor(y)
+	ix, iy = ix&255, iy&255
+	p := &n.perm
+	a, b := int(p[ix])+iy, int(p[ix+1])+iy
+	u, v := fade(fx), fade(fy)
+	h0 := g3.Lerp(grad(p[a], fx, fy), grad(p[b], fx-1, fy), u)
+	h1 := g3.Lerp(grad(p[a+1], fx, fy-1), grad(p[b+1], fx-1, fy-1), u)
+	return g3.Lerp(h0, h1, v)
+}
+
+const (
+	// skews the xy plane onto the simplex grid and back
+	skew   = 0.36602540378 // (sqrt(3) - 1) / 2
+	unskew = 0.2113248654  // (3 - sqrt(3)) / 6
+)
+
+// Contribution of a simplex corner at x, y
+func (n *gradientNoise) corner(hash uint8, x, y float32) float32 {
+	t := 0.5 - x*x - y*y
+	if t < 0 {
+		return 0
+	}
+	t *= t
+	return t * t * grad(hash, x, y)
+}
+
+// Simplex noise, has less directional artifacts than Perlin noise
+func (n *gradientNoise) simplex(x, y float32) float32 {
+	s := (x + y) * skew
+	i, _ := floor(x + s)
+	j, _ := floor(y + s)
+	t := float32(i+j) * unskew
+	x0, y0 := x-(float32(i)-t), y-(float32(j)-t)
+	// middle corner of the triangle containing x, y
+	i1, j1 := 0, 1
+	if x0 > y0 {
+		i1, j1 = 1, 0
+	}
+	x1, y1 := x0-float32(i1)+unskew, y0-float32(j1)+unskew
+	x2, y2 := x0-1+2*unskew, y0-1+2*unskew
+	i, j = i&255, j&255
+	p := &n.perm
+	h := n.corner(p[i+int(p[j])], x0, y0)
+	h += n.corner(p[i+i1+int(p[j+j1])], x1, y1)
+	h += n.corner(p[i+1+int(p[j+1])], x2, y2)
+	return 70 * h
+}
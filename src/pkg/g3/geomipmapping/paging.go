@@ -0,0 +1,305 @@
+package geomipmapping
+
+import (
+	"g3"
+	"os"
+	"runtime"
+)
+
+// A paged terrain splits the height map into pages of one tile each. Pages
+// near the eye are read and generated by background goroutines, far pages
+// are evicted when the memory budget is exceeded. All resident patches are
+// placed in one patch grid, so LOD selection and crack fixing work across
+// page borders.
+
+var (
+	ErrTileSize     = os.NewError("geomipmapping: tile size is not a multiple of the patch size")
+	ErrLoadDistance = os.NewError("geomipmapping: load distance is not positive")
+)
+
+// Source of the tiles of a paged terrain, must be safe for concurrent use.
+// TiledHeightMap is a TileSource.
+type TileSource interface {
+	// samples of the height map
+	Size() (width, height int)
+	// sample intervals of a tile
+	TileSize() int
+	ReadTile(tx, ty int) (*HeightTile, os.Error)
+}
+
+type PagingOptions struct {
+	// Pages closer than LoadDistance to the eye in the xy plane are loaded, has to be > 0
+	LoadDistance float32
+	// Bytes used by resident pages, far pages are evicted to stay below it. Unlimited if < 1
+	MemoryBudget int
+	// Number of goroutines loading pages, GOMAXPROCS if < 1
+	Workers int
+}
+
+const (
+	pageUnloaded = iota
+	pageLoading
+	pageResident
+)
+
+type page struct {
+	tx, ty  int
+	root    g3.SpatElement
+	patches []*patch
+	bytes   int
+	err     os.Error
+}
+
+type PagedGeoMipMap struct {
+	// shared index buffers, LOD parameters and the patch grid
+	terrain        *GeoMipMap
+	source         TileSource
+	options        PagingOptions
+	width, height  int
+	pagesX, pagesY int
+	// patches of a page along each axis
+	pagePatches int
+	state       []int
+	resident    []*page
+	patches     []*patch
+	bytes       int
+	requests    chan *page
+	results     chan *page
+	loading     int
+}
+
+// Creates a terrain loading its pages from source, the tile size of source
+// has to be a multiple of patchSize. Index buffers are created on dev,
+// patches are loaded by Update. Release stops the loading goroutines.
+func NewPagedGeoMipMap(dev g3.GraphicsDevice, source TileSource, patchSize int, maxLOD uint, whScale, hScale float32, options PagingOptions) (*PagedGeoMipMap, os.Error) {
+	if maxLOD < 1 || patchSize < int(pow2(maxLOD)) || patchSize%int(pow2(maxLOD)) != 0 {
+		return nil, ErrPatchSize
+	}
+	tileSize := source.TileSize()
+	if tileSize%patchSize != 0 {
+		return nil, ErrTileSize
+	}
+	w, h := source.Size()
+	if w < 2 || h < 2 {
+		return nil, ErrHeightMapSize
+	}
+	if options.LoadDistance <= 0 {
+		return nil, ErrLoadDistance
+	}
+	if options.Workers < 1 {
+		options.Workers = runtime.GOMAXPROCS(0)
+	}
+	gridWidth := (w - 2 + patchSize) / patchSize
+	gridHeight := (h - 2 + patchSize) / patchSize
+	terrain := newGeoMipMap(nil, patchSize, maxLOD, whScale, hScale, gridWidth, gridHeight)
+	terrain.patches = make([]*patch, gridWidth*gridHeight)
+	terrain.buildLODIndices(dev)
+	terrain.occluderIndices = createOccluderIndices(maxLOD)
+
+	pm := &PagedGeoMipMap{terrain: terrain, source: source, options: options, width: w, height: h}
+	pm.pagesX, pm.pagesY = tileCount(w, h, tileSize)
+	pm.pagePatches = tileSize / patchSize
+	pm.state = make([]int, pm.pagesX*pm.pagesY)
+	pm.requests = make(chan *page)
+	// never more pages are loading than there are workers, so workers don't block
+	pm.results = make(chan *page, options.Workers)
+	for i := 0; i < options.Workers; i++ {
+		go func() {
+			for pg := range pm.requests {
+				pm.loadPage(pg)
+				pm.results <- pg
+			}
+		}()
+	}
+	return pm, nil
+}
+
+// Reads the tile of pg and generates its patches, runs in a loading goroutine.
+func (pm *PagedGeoMipMap) loadPage(pg *page) {
+	tile, err := pm.source.ReadTile(pg.tx, pg.ty)
+	if err != nil {
+		pg.err = err
+		return
+	}
+	gm := pm.terrain
+	gx, gy := pg.tx*pm.pagePatches, pg.ty*pm.pagePatches
+	// pages at the right and bottom edge have less patches
+	w, h := clampInt(gm.gridWidth-gx, 1, pm.pagePatches), clampInt(gm.gridHeight-gy, 1, pm.pagePatches)
+	root, jobs := buildQuadTree(gx, gy, w, h, nil, nil)
+	pg.patches = make([]*patch, len(jobs))
+	for i, job := range jobs {
+		p, bbox := generatePatch(tile, job.gx, job.gy, gm.patchSize, gm.maxLOD, gm.whScale, gm.hScale)
+		job.leaf.BVolume = &bbox
+		job.leaf.Data = p
+		pg.patches[i] = p
+		pg.bytes += p.memorySize()
+	}
+	refitQuadTree(root)
+	pg.root = root
+}
+
+// Bytes of the CPU data and the GPU buffers of a patch
+func (p *patch) memorySize() int {
+	cpu := (len(p.vertexData)+len(p.normalData)+len(p.occluder))*12 + len(p.morphData)*8 + len(p.errors)*4
+	gpu := (len(p.vertexData)+len(p.normalData))*12 + len(p.morphData)*8
+	return cpu + gpu
+}
+
+// Distance of the page to the eye in the xy plane
+func (pm *PagedGeoMipMap) pageDistance(tx, ty int, eye *g3.Vec3) float32 {
+	gm := pm.terrain
+	tileSize := float32(pm.pagePatches * gm.patchSize)
+	min := g3.Vec2{float32(tx) * tileSize, float32(ty) * tileSize}.Mul(gm.whScale)
+	max := g3.Vec2{
+		g3.Min(float32(tx+1)*tileSize, float32(pm.width-1)),
+		g3.Min(float32(ty+1)*tileSize, float32(pm.height-1))}.Mul(gm.whScale)
+	d := g3.Vec2{g3.Max(g3.Max(min.X-eye.X, eye.X-max.X), 0), g3.Max(g3.Max(min.Y-eye.Y, eye.Y-max.Y), 0)}
+	return d.Length()
+}
+
+func (pm *PagedGeoMipMap) addPage(dev g3.GraphicsDevice, pg *page) {
+	gm := pm.terrain
+	for _, p := range pg.patches {
+		p.createBuffers(dev)
+		gm.patches[p.gridY*gm.gridWidth+p.gridX] = p
+	}
+	pm.resident = append(pm.resident, pg)
+	pm.patches = append(pm.patches, pg.patches...)
+	pm.bytes += pg.bytes
+	pm.state[pg.ty*pm.pagesX+pg.tx] = pageResident
+}
+
+// Removes the resident page i
+func (pm *PagedGeoMipMap) evictPage(i int) {
+	gm := pm.terrain
+	pg := pm.resident[i]
+	for _, p := range pg.patches {
+		p.releaseBuffers()
+		gm.patches[p.gridY*gm.gridWidth+p.gridX] = nil
+	}
+	last := len(pm.resident) - 1
+	pm.resident[i] = pm.resident[last]
+	pm.resident[last] = nil
+	pm.resident = pm.resident[:last]
+	pm.bytes -= pg.bytes
+	pm.state[pg.ty*pm.pagesX+pg.tx] = pageUnloaded
+
+	pm.patches = pm.patches[:0]
+	for _, pg := range pm.resident {
+		pm.patches = append(pm.patches, pg.patches...)
+	}
+}
+
+// Evicts the farthest page outside of the load distance, false if there is none.
+func (pm *PagedGeoMipMap) evictFarthest(eye *g3.Vec3) bool {
+	far, farDist := -1, pm.options.LoadDistance
+	for i, pg := range pm.resident {
+		if d := pm.pageDistance(pg.tx, pg.ty, eye); d >= farDist {
+			far, farDist = i, d
+		}
+	}
+	if far < 0 {
+		return false
+	}
+	pm.evictPage(far)
+	return true
+}
+
+// Estimated bytes of a full page
+func (pm *PagedGeoMipMap) pageBytes() int {
+	size := int(pow2(pm.terrain.maxLOD) + 1)
+	p := &patch{vertexData: make([]g3.Vec3, size*size), normalData: make([]g3.Vec3, size*size),
+		morphData: make([]g3.Vec2, size*size), occluder: make([]g3.Vec3, 9), errors: make([]float32, pm.terrain.maxLOD)}
+	return p.memorySize() * pm.pagePatches * pm.pagePatches
+}
+
+// Adds the pages loaded in the background and requests the nearest missing
+// pages. Far pages are kept until their memory is needed for near ones. Has to be called
+// by the render thread, GPU buffers are created on dev. Returns the error of
+// a page that couldn't be loaded, the page is requested again. Does nothing
+// after Release.
+func (pm *PagedGeoMipMap) Update(dev g3.GraphicsDevice, eye *g3.Vec3) os.Error {
+	if pm.requests == nil {
+		return nil
+	}
+	var err os.Error
+	for done := false; !done; {
+		select {
+		case pg := <-pm.results:
+			pm.loading--
+			if pg.err != nil {
+				pm.state[pg.ty*pm.pagesX+pg.tx] = pageUnloaded
+				err = pg.err
+				continue
+			}
+			pm.addPage(dev, pg)
+		default:
+			done = true
+		}
+	}
+
+	// nearest missing pages, pages in flight count against the budget
+	budget := pm.options.MemoryBudget
+	for pm.loading < pm.options.Workers {
+		near, nearDist := -1, pm.options.LoadDistance
+		for i, state := range pm.state {
+			if state != pageUnloaded {
+				continue
+			}
+			if d := pm.pageDistance(i%pm.pagesX, i/pm.pagesX, eye); d < nearDist {
+				near, nearDist = i, d
+			}
+		}
+		if near < 0 {
+			break
+		}
+		for budget > 0 && pm.bytes+(pm.loading+1)*pm.pageBytes() > budget && pm.evictFarthest(eye) {
+		}
+		if budget > 0 && pm.bytes+(pm.loading+1)*pm.pageBytes() > budget {
+			break
+		}
+		pm.state[near] = pageLoading
+		pm.loading++
+		pm.requests <- &page{tx: near % pm.pagesX, ty: near / pm.pagesX}
+	}
+	return err
+}
+
+// Bytes used by the resident pages
+func (pm *PagedGeoMipMap) MemoryUsage() int {
+	return pm.bytes
+}
+
+func (pm *PagedGeoMipMap) SetLODParams(fovy float32, viewportHeight int, pixelTolerance float32) {
+	pm.terrain.SetLODParams(fovy, viewportHeight, pixelTolerance)
+}
+
+func (pm *PagedGeoMipMap) SetMorphShader(shader g3.Shader) {
+	pm.terrain.SetMorphShader(shader)
+}
+
+// Renders the resident patches in the frustum. Missing pages leave holes.
+func (pm *PagedGeoMipMap) Render(dev g3.GraphicsDevice, frustum *g3.Frustum, eye *g3.Vec3) {
+	pm.terrain.selectLODs(pm.patches, eye)
+	render := pm.terrain.renderFunc(dev)
+	for _, pg := range pm.resident {
+		pg.root.TraverseFrustum(frustum, render)
+	}
+}
+
+// Stops the loading goroutines and releases all buffers. Pages still loading
+// are discarded. Further calls do nothing.
+func (pm *PagedGeoMipMap) Release() {
+	if pm.requests == nil {
+		return
+	}
+	close(pm.requests)
+	pm.requests = nil
+	for ; pm.loading > 0; pm.loading-- {
+		<-pm.results
+	}
+	for len(pm.resident) > 0 {
+		pm.evictPage(len(pm.resident) - 1)
+	}
+	pm.terrain.Release()
+}
@@ -0,0 +1,144 @@
+package geomipmapping
+
+import (
+	"bytes"
+	"g3"
+	"os"
+	"runtime"
+	"testing"
+)
+
+type byteReaderAt []byte
+
+func (b byteReaderAt) ReadAt(p []byte, off int64) (int, os.Error) {
+	if off >= int64(len(b)) {
+		return 0, os.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, os.EOF
+	}
+	return n, nil
+}
+
+func writeTestTiles(t *testing.T, hm HeightMap, tileSize int) []byte {
+	b := new(bytes.Buffer)
+	if err := WriteTiledHeightMap(b, hm, tileSize); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestTiledHeightMap(t *testing.T) {
+	hm := &waveHeightMap{100, 70}
+	data := writeTestTiles(t, hm, 32)
+	tiles, err := OpenTiledHeightMap(byteReaderAt(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tiles.tilesX != 4 || tiles.tilesY != 3 {
+		t.Fatalf("%dx%d tiles", tiles.tilesX, tiles.tilesY)
+	}
+	tile, err := tiles.ReadTile(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last tile holds samples 95..99 and 63..69 and its border
+	for y := 63; y < 70; y++ {
+		for x := 95; x < 100; x++ {
+			if h := tile.Height(float32(x), float32(y)); h != hm.Height(float32(x), float32(y)) {
+				t.Fatalf("sample %d,%d: %f, expected %f", x, y, h, hm.Height(float32(x), float32(y)))
+			}
+		}
+	}
+	if _, err := tiles.ReadTile(4, 0); err != ErrTileData {
+		t.Errorf("tile outside of the map returned %v", err)
+	}
+
+	data[len(data)-1]++
+	if _, err := tiles.ReadTile(3, 2); err != g3.ErrChunkChecksum {
+		t.Errorf("corrupt tile returned %v", err)
+	}
+}
+
+// Calls Update until no page is loading.
+func updatePages(t *testing.T, pm *PagedGeoMipMap, eye *g3.Vec3) {
+	for i := 0; i < 10000; i++ {
+		if err := pm.Update(testDevice{}, eye); err != nil {
+			t.Fatal(err)
+		}
+		if pm.loading == 0 {
+			return
+		}
+		runtime.Gosched()
+	}
+	t.Fatal("pages still loading")
+}
+
+func TestPagedGeoMipMap(t *testing.T) {
+	hm := &waveHeightMap{100, 70}
+	tiles, err := OpenTiledHeightMap(byteReaderAt(writeTestTiles(t, hm, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPagedGeoMipMap(testDevice{}, tiles, 24, 3, 1, 1, PagingOptions{}); err != ErrTileSize {
+		t.Errorf("patch size 24 with 32 tiles returned %v", err)
+	}
+	for _, distance := range []float32{0, -5} {
+		if _, err := NewPagedGeoMipMap(testDevice{}, tiles, 16, 3, 1, 1, PagingOptions{LoadDistance: distance}); err != ErrLoadDistance {
+			t.Errorf("load distance %f returned %v", distance, err)
+		}
+	}
+
+	// all pages, the patches and levels are the same as without paging
+	gm := NewGeoMipMap(testDevice{}, hm, 16, 3, 1, 1)
+	pm, err := NewPagedGeoMipMap(testDevice{}, tiles, 16, 3, 1, 1, PagingOptions{LoadDistance: 1000, Workers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eye := g3.Vec3{0, 0, 3}
+	updatePages(t, pm, &eye)
+	if len(pm.resident) != 12 || len(pm.patches) != len(gm.patches) {
+		t.Fatalf("%d pages with %d patches resident", len(pm.resident), len(pm.patches))
+	}
+	gm.SetLODParams(g3.Deg2Rad(60), 480, 0.5)
+	pm.SetLODParams(g3.Deg2Rad(60), 480, 0.5)
+	gm.selectLODs(gm.patches, &eye)
+	pm.terrain.selectLODs(pm.patches, &eye)
+	for i, p := range gm.patches {
+		q := pm.terrain.patches[i]
+		for k := range p.vertexData {
+			if p.vertexData[k] != q.vertexData[k] || p.normalData[k] != q.normalData[k] {
+				t.Fatalf("patch %d,%d: vertex %d differs", p.gridX, p.gridY, k)
+			}
+		}
+		if p.lod != q.lod {
+			t.Errorf("patch %d,%d: level %d, expected %d", p.gridX, p.gridY, q.lod, p.lod)
+		}
+	}
+	pm.Release()
+	// a released terrain stays released
+	pm.Release()
+	if err := pm.Update(testDevice{}, &eye); err != nil || len(pm.resident) != 0 {
+		t.Errorf("update after release: %v, %d pages resident", err, len(pm.resident))
+	}
+
+	// room for three pages, far pages are evicted for near ones
+	budget := 3 * pm.pageBytes()
+	pm, err = NewPagedGeoMipMap(testDevice{}, tiles, 16, 3, 1, 1, PagingOptions{LoadDistance: 10, MemoryBudget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Release()
+	for _, eye := range []g3.Vec3{{5, 5, 0}, {50, 40, 0}, {95, 65, 0}} {
+		updatePages(t, pm, &eye)
+		updatePages(t, pm, &eye)
+		if pm.MemoryUsage() > budget {
+			t.Errorf("eye %v: %d bytes used, budget %d", eye, pm.MemoryUsage(), budget)
+		}
+		tx, ty := int(eye.X)/32, int(eye.Y)/32
+		if pm.state[ty*pm.pagesX+tx] != pageResident {
+			t.Errorf("eye %v: page %d,%d not resident", eye, tx, ty)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package geomipmapping
+
+import (
+	"g3"
+	"rand"
+)
+
+// Procedural height maps return normalized heights in [0, 1] and are the same
+// for the same seed. Operators combine and reshape any HeightMap, use
+// ScaleHeightMap to map heights to an elevation range.
+
+type NoiseType int
+
+const (
+	NoisePerlin NoiseType = iota
+	NoiseSimplex
+)
+
+type FractalParams struct {
+	Noise NoiseType
+	// Noise frequency of the first octave per sample, 1/64 if 0
+	Frequency float32
+	// Number of noise layers, 6 if < 1
+	Octaves int
+	// Frequency factor between octaves, 2 if 0
+	Lacunarity float32
+	// Amplitude factor between octaves, 0.5 if 0
+	Gain float32
+}
+
+// Sum of noise octaves, either fractal Brownian motion or a ridged multifractal
+type FractalHeightMap struct {
+	width, height int
+	noise         *gradientNoise
+	params        FractalParams
+	ridged        bool
+}
+
+func newFractalHeightMap(width, height int, seed int64, params FractalParams, ridged bool) *FractalHeightMap {
+	if params.Frequency == 0 {
+		params.Frequency = 1.0 / 64.0
+	}
+	if params.Octaves < 1 {
+		params.Octaves = 6
+	}
+	if params.Lacunarity == 0 {
+		params.Lacunarity = 2
+	}
+	if params.Gain == 0 {
+		params.Gain = 0.5
+	}
+	return &FractalHeightMap{width, height, newGradientNoise(seed), params, ridged}
+}
+
+// Fractal Brownian motion, rolling hills
+func NewFBmHeightMap(width, height int, seed int64, params FractalParams) *FractalHeightMap {
+	return newFractalHeightMap(width, height, seed, params, false)
+}
+
+// Ridged multifractal, sharp mountain ridges with smooth valleys
+func NewRidgedHeightMap(width, height int, seed int64, params FractalParams) *FractalHeightMap {
+	return newFractalHeightMap(width, height, seed, params, true)
+}
+
+func (hm *FractalHeightMap) Size() (width, height int) {
+	return hm.width, hm.height
+}
+
+func (hm *FractalHeightMap) Height(x, y float32) float32 {
+	p := &hm.params
+	freq, amp, weight := p.Frequency, float32(1), float32(1)
+	var sum, total float32
+	for i := 0; i < p.Octaves; i++ {
+		// offset octaves, so their zeros at the lattice points don't line up
+		nx, ny := x*freq+float32(i)*31.7, y*freq+float32(i)*17.3
+		var n float32
+		if p.Noise == NoiseSimplex {
+			n = hm.noise.simplex(nx, ny)
+		} else {
+			n = hm.noise.perlin(nx, ny)
+		}
+		if hm.ridged {
+			// ridges where the noise crosses zero, detail is weighted
+			// by the octaves below, so valleys stay smooth
+			n = 1 - g3.Abs(n)
+			n *= n * weight
+			weight = g3.Clamp(2*n, 0, 1)
+		} else {
+			n = 0.5*n + 0.5
+		}
+		sum += n * amp
+		total += amp
+		freq *= p.Lacunarity
+		amp *= p.Gain
+	}
+	return g3.Clamp(sum/total, 0, 1)
+}
+
+// Generates a 2^n+1 x 2^n+1 height map with the diamond-square algorithm.
+// The random displacement is multiplied by roughness each level, lower values
+// give smoother terrain. Samples are normalized to [0, 1].
+func NewDiamondSquareHeightMap(n uint, roughness float32, seed int64) *FloatHeightMap {
+	size := int(pow2(n)) + 1
+	hm := NewFloatHeightMap(size, size, nil)
+	r := rand.New(rand.NewSource(seed))
+	random := func(amp float32) float32 {
+		return (2*r.Float32() - 1) * amp
+	}
+	last := size - 1
+	for _, i := range []int{0, last, last * size, last*size + last} {
+		hm.data[i] = random(1)
+	}
+	amp := roughness
+	for step := last; step > 1; step /= 2 {
+		half := step / 2
+		// diamonds, the centers of the squares
+		for y := half; y < size; y += step {
+			for x := half; x < size; x += step {
+				h := hm.Sample(x-half, y-half) + hm.Sample(x+half, y-half) +
+					hm.Sample(x-half, y+half) + hm.Sample(x+half, y+half)
+				hm.SetSample(x, y, h/4+random(amp))
+			}
+		}
+		// squares, the edge midpoints, with 3 neighbours at the border
+		for y := 0; y < size; y += half {
+			for x := (y + half) % step; x < size; x += step {
+				var h float32
+				count := 0
+				for _, d := range [][2]int{{-half, 0}, {half, 0}, {0, -half}, {0, half}} {
+					if nx, ny := x+d[0], y+d[1]; nx >= 0 && nx < size && ny >= 0 && ny < size {
+						h += hm.Sample(nx, ny)
+						count++
+					}
+				}
+				hm.SetSample(x, y, h/float32(count)+random(amp))
+			}
+		}
+		amp *= roughness
+	}
+
+	min, max := hm.data[0], hm.data[0]
+	for _, h := range hm.data {
+		min, max = g3.Min(min, h), g3.Max(max, h)
+	}
+	if max > min {
+		for i, h := range hm.data {
+			hm.data[i] = (h - min) / (max - min)
+		}
+	}
+	return hm
+}
+
+const (
+	// distance to the nearest feature point, cone shaped cells
+	VoronoiF1 = iota
+	// distance between the nearest and second nearest feature point, ridges
+	// along the cell borders
+	VoronoiF2MinusF1
+)
+
+// Cellular noise of one random feature point per cell. Distances are
+// relative to the cell size.
+type VoronoiHeightMap struct {
+	width, height  int
+	cellSize       float32
+	mode           int
+	cellsX, cellsY int
+	// feature points, including a ring of cells around the height map
+	points []g3.Vec2
+}
+
+func NewVoronoiHeightMap(width, height int, seed int64, cellSize float32, mode int) *VoronoiHeightMap {
+	hm := &VoronoiHeightMap{width: width, height: height, cellSize: cellSize, mode: mode}
+	hm.cellsX = int(float32(width-1)/cellSize) + 1
+	hm.cellsY = int(float32(height-1)/cellSize) + 1
+	hm.points = make([]g3.Vec2, (hm.cellsX+2)*(hm.cellsY+2))
+	r := rand.New(rand.NewSource(seed))
+	for cy := -1; cy <= hm.cellsY; cy++ {
+		for cx := -1; cx <= hm.cellsX; cx++ {
+			p := g3.Vec2{float32(cx) + r.Float32(), float32(cy) + r.Float32()}
+			hm.points[(cy+1)*(hm.cellsX+2)+cx+1] = p.Mul(cellSize)
+		}
+	}
+	return hm
+}
+
+func (hm *VoronoiHeightMap) Size() (width, height int) {
+	return hm.width, hm.height
+}
+
+func (hm *VoronoiHeightMap) Height(x, y float32) float32 {
+	x = g3.Clamp(x, 0, float32(hm.width-1))
+	y = g3.Clamp(y, 0, float32(hm.height-1))
+	cx, cy := int(x/hm.cellSize), int(y/hm.cellSize)
+	f1, f2 := float32(-1), float32(-1)
+	for j := cy - 1; j <= cy+1; j++ {
+		for i := cx - 1; i <= cx+1; i++ {
+			p := hm.points[(j+1)*(hm.cellsX+2)+i+1]
+			d := p.Distance(g3.Vec2{x, y})
+			if f1 < 0 || d < f1 {
+				f1, f2 = d, f1
+			} else if f2 < 0 || d < f2 {
+				f2 = d
+			}
+		}
+	}
+	h := f1
+	if hm.mode == VoronoiF2MinusF1 {
+		h = f2 - f1
+	}
+	return g3.Clamp(h/hm.cellSize, 0, 1)
+}
+
+// Combines the heights of two maps, has the size of the first one
+type combinedHeightMap struct {
+	a, b HeightMap
+	op   func(a, b float32) float32
+}
+
+func (hm *combinedHeightMap) Size() (width, height int) {
+	return hm.a.Size()
+}
+
+func (hm *combinedHeightMap) Height(x, y float32) float32 {
+	return hm.op(hm.a.Height(x, y), hm.b.Height(x, y))
+}
+
+// Maps the heights of a height map
+type mappedHeightMap struct {
+	heightMap HeightMap
+	f         func(h float32) float32
+}
+
+func (hm *mappedHeightMap) Size() (width, height int) {
+	return hm.heightMap.Size()
+}
+
+func (hm *mappedHeightMap) Height(x, y float32) float32 {
+	return hm.f(hm.heightMap.Height(x, y))
+}
+
+func AddHeightMaps(a, b HeightMap) HeightMap {
+	return &combinedHeightMap{a, b, func(a, b float32) float32 { return a + b }}
+}
+
+func MultiplyHeightMaps(a, b HeightMap) HeightMap {
+	return &combinedHeightMap{a, b, func(a, b float32) float32 { return a * b }}
+}
+
+// h * scale + offset
+func ScaleHeightMap(heightMap HeightMap, scale, offset float32) HeightMap {
+	return &mappedHeightMap{heightMap, func(h float32) float32 { return h*scale + offset }}
+}
+
+func ClampHeightMap(heightMap HeightMap, min, max float32) HeightMap {
+	return &mappedHeightMap{heightMap, func(h float32) float32 { return g3.Clamp(h, min, max) }}
+}
+
+// Splits [0, 1] into steps terraces. Each terrace rises with f^sharpness
+// from its start, 1 keeps the heights, higher values give flat terraces with
+// steep edges.
+func TerraceHeightMap(heightMap HeightMap, steps int, sharpness float32) HeightMap {
+	return &mappedHeightMap{heightMap, func(h float32) float32 {
+		i, f := floor(h * float32(steps))
+		return (float32(i) + g3.Pow(f, sharpness)) / float32(steps)
+	}}
+}
+
+// Maps heights with a piecewise linear curve through the points (in, out),
+// sorted by in. Heights outside of the curve get the value of its end points.
+func RemapHeightMap(heightMap HeightMap, curve []g3.Vec2) HeightMap {
+	return &mappedHeightMap{heightMap, func(h float32) float32 {
+		if h <= curve[0].X {
+			return curve[0].Y
+		}
+		for i := 1; i < len(curve); i++ {
+			if a, b := curve[i-1], curve[i]; h < b.X {
+				return g3.Lerp(a.Y, b.Y, (h-a.X)/(b.X-a.X))
+			}
+		}
+		return curve[len(curve)-1].Y
+	}}
+}
+
+// Evaluates heightMap once at each sample, useful for costly procedural maps.
+func BakeHeightMap(heightMap HeightMap) *FloatHeightMap {
+	w, h := heightMap.Size()
+	hm := NewFloatHeightMap(w, h, nil)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			hm.data[y*w+x] = heightMap.Height(float32(x), float32(y))
+		}
+	}
+	return hm
+}
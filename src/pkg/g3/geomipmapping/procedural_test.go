@@ -0,0 +1,115 @@
+package geomipmapping
+
+import (
+	"g3"
+	"rand"
+	"testing"
+)
+
+func TestGradientNoise(t *testing.T) {
+	n, other := newGradientNoise(1), newGradientNoise(2)
+	r := rand.New(rand.NewSource(1))
+	differs := false
+	for i := 0; i < 1000; i++ {
+		x, y := r.Float32()*600-300, r.Float32()*600-300
+		for _, noise := range []func(n *gradientNoise, x, y float32) float32{
+			func(n *gradientNoise, x, y float32) float32 { return n.perlin(x, y) },
+			func(n *gradientNoise, x, y float32) float32 { return n.simplex(x, y) },
+		} {
+			h := noise(n, x, y)
+			if h < -1.01 || h > 1.01 {
+				t.Fatalf("noise %f at %f,%f", h, x, y)
+			}
+			// continuous
+			if d := g3.Abs(noise(n, x+0.001, y+0.001) - h); d > 0.01 {
+				t.Fatalf("noise jumps by %f at %f,%f", d, x, y)
+			}
+			if noise(newGradientNoise(1), x, y) != h {
+				t.Fatalf("noise at %f,%f differs for the same seed", x, y)
+			}
+			differs = differs || noise(other, x, y) != h
+		}
+		if h := n.perlin(float32(int(x)), float32(int(y))); h != 0 {
+			t.Fatalf("perlin noise %f at lattice point %d,%d", h, int(x), int(y))
+		}
+	}
+	if !differs {
+		t.Error("noise doesn't depend on the seed")
+	}
+}
+
+func TestProceduralHeightMaps(t *testing.T) {
+	maps := func(seed int64) []HeightMap {
+		return []HeightMap{
+			NewFBmHeightMap(65, 33, seed, FractalParams{Frequency: 1.0 / 16}),
+			NewFBmHeightMap(65, 33, seed, FractalParams{Noise: NoiseSimplex, Frequency: 1.0 / 16, Octaves: 3}),
+			NewRidgedHeightMap(65, 33, seed, FractalParams{Frequency: 1.0 / 16}),
+			NewVoronoiHeightMap(65, 33, seed, 10, VoronoiF1),
+			NewVoronoiHeightMap(65, 33, seed, 10, VoronoiF2MinusF1),
+			NewDiamondSquareHeightMap(6, 0.5, seed),
+		}
+	}
+	a, b, other := maps(7), maps(7), maps(8)
+	for i, hm := range a {
+		w, h := hm.Size()
+		min, max := float32(1), float32(0)
+		differs := false
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := hm.Height(float32(x), float32(y))
+				if v != b[i].Height(float32(x), float32(y)) {
+					t.Fatalf("map %d: height at %d,%d differs for the same seed", i, x, y)
+				}
+				differs = differs || v != other[i].Height(float32(x), float32(y))
+				min, max = g3.Min(min, v), g3.Max(max, v)
+			}
+		}
+		if min < 0 || max > 1 || max-min < 0.2 {
+			t.Errorf("map %d: heights from %f to %f", i, min, max)
+		}
+		if !differs {
+			t.Errorf("map %d doesn't depend on the seed", i)
+		}
+		if NewGeoMipMap(testDevice{}, hm, 16, 3, 1, 10) == nil {
+			t.Errorf("map %d: no terrain", i)
+		}
+	}
+
+	ds := NewDiamondSquareHeightMap(4, 0.5, 1)
+	if w, h := ds.Size(); w != 17 || h != 17 {
+		t.Errorf("diamond-square map of %dx%d samples", w, h)
+	}
+	vm := NewVoronoiHeightMap(65, 33, 1, 10, VoronoiF1)
+	p := vm.points[2*(vm.cellsX+2)+2]
+	if h := vm.Height(p.X, p.Y); h != 0 {
+		t.Errorf("height %f at a feature point", h)
+	}
+}
+
+func TestHeightMapOperators(t *testing.T) {
+	ramp := NewFloatHeightMap(5, 1, []float32{0, 0.25, 0.5, 0.75, 1})
+	half := NewFloatHeightMap(3, 3, []float32{0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5})
+	tests := []struct {
+		hm       HeightMap
+		expected []float32
+	}{
+		{AddHeightMaps(ramp, half), []float32{0.5, 0.75, 1, 1.25, 1.5}},
+		{MultiplyHeightMaps(ramp, half), []float32{0, 0.125, 0.25, 0.375, 0.5}},
+		{ScaleHeightMap(ramp, 100, -20), []float32{-20, 5, 30, 55, 80}},
+		{ClampHeightMap(ramp, 0.3, 0.6), []float32{0.3, 0.3, 0.5, 0.6, 0.6}},
+		{TerraceHeightMap(ramp, 3, 1), []float32{0, 0.25, 0.5, 0.75, 1}},
+		{TerraceHeightMap(ramp, 2, 100), []float32{0, 0, 0.5, 0.5, 1}},
+		{RemapHeightMap(ramp, []g3.Vec2{{0.25, 1}, {0.5, 0}, {1, 0.5}}), []float32{1, 1, 0, 0.25, 0.5}},
+		{BakeHeightMap(ScaleHeightMap(ramp, 2, 0)), []float32{0, 0.5, 1, 1.5, 2}},
+	}
+	for i, test := range tests {
+		if w, h := test.hm.Size(); w != 5 || h != 1 {
+			t.Errorf("operator %d: size %dx%d", i, w, h)
+		}
+		for x, expected := range test.expected {
+			if h := test.hm.Height(float32(x), 0); !g3.ApproxEqual(h, expected) {
+				t.Errorf("operator %d: height %f at %d, expected %f", i, h, x, expected)
+			}
+		}
+	}
+}
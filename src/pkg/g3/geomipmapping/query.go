@@ -0,0 +1,331 @@
+package geomipmapping
+
+import (
+	"g3"
+)
+
+// Queries are answered on the triangles of one level of the patches, all
+// positions are in world units. By default the full resolution is used,
+// SetQueryLOD selects a coarser level or the geometry of the last rendered
+// frame.
+
+// Passed to SetQueryLOD to query the levels, crack fixes and geomorphing
+// selected by the last Render.
+const RenderedLOD = -1
+
+// Penetration of an object into the terrain
+type Contact struct {
+	// point on the terrain surface
+	Point g3.Vec3
+	// direction to push the object out of the terrain
+	Normal g3.Vec3
+	Depth  float32
+}
+
+// Levels larger than the coarsest one are clamped.
+func (gm *GeoMipMap) SetQueryLOD(lod int) {
+	gm.queryLOD = lod
+}
+
+// Level and crack mask of p used by queries, morph is true if they are
+// geomorphed
+func (gm *GeoMipMap) queryLevel(p *patch) (lod int, crackMask uint, morph bool) {
+	if gm.queryLOD >= 0 {
+		if gm.queryLOD >= len(p.errors) {
+			return len(p.errors) - 1, crackNone, false
+		}
+		return gm.queryLOD, crackNone, false
+	}
+	crackIndex, lod := gm.selectIndexBuffer(p)
+	return lod, uint(crackIndex), gm.morphShader != nil
+}
+
+// Vertex k of p as rendered at level lod, see data/shaders/map.vs.glsl
+func queryVertex(p *patch, k uint32, lod int, morph bool) g3.Vec3 {
+	v := p.vertexData[k]
+	if !morph {
+		return v
+	}
+	level, edge := morphLevel(p.morphData[k])
+	factor := p.morph
+	if edge >= 0 {
+		lod, factor = p.edgeLOD[edge], p.edgeMorph[edge]
+	}
+	if factor > 0 && level == lod {
+		v.Z = g3.Lerp(v.Z, p.morphData[k].X, factor)
+	}
+	return v
+}
+
+// Cell of a level with skip containing sample s along one axis of the patch
+// starting at sample origin. Clamped to the cells of the patch.
+func (gm *GeoMipMap) cellIndex(s float32, origin int, skip uint) uint {
+	max := int(pow2(gm.maxLOD))
+	stride := float32(gm.patchSize / max)
+	c := clampInt(int(g3.Max(s-float32(origin), 0)/stride), 0, max-1)
+	return uint(c) / skip * skip
+}
+
+// Patch grid cell containing sample s along one axis
+func (gm *GeoMipMap) gridIndex(s float32, gridSize int) int {
+	return clampInt(int(g3.Max(s, 0))/gm.patchSize, 0, gridSize-1)
+}
+
+// Triangles of the cell of p containing the samples sx, sy, indices into
+// the vertices of p
+func (gm *GeoMipMap) cellTriangles(p *patch, sx, sy float32, lod int, crackMask uint) []uint32 {
+	skip := pow2(uint(lod))
+	cx := gm.cellIndex(sx, p.gridX*gm.patchSize, skip)
+	cy := gm.cellIndex(sy, p.gridY*gm.patchSize, skip)
+	// index buffer rows run along y
+	return addNewQuad(nil, pow2(gm.maxLOD)+1, cy, cx, skip, crackMask)
+}
+
+func (gm *GeoMipMap) inside(x, y float32) bool {
+	bbox := gm.root.GetBoundingVolume().(*g3.BoundingBox)
+	return x >= bbox.Min.X && y >= bbox.Min.Y && x <= bbox.Max.X && y <= bbox.Max.Y
+}
+
+// Barycentric coordinates of x, y in the projection of the triangle to the xy plane
+func barycentricXY(x, y float32, a, b, c *g3.Vec3) (u, v, w float32, ok bool) {
+	d := (b.Y-c.Y)*(a.X-c.X) + (c.X-b.X)*(a.Y-c.Y)
+	if d == 0 {
+		return 0, 0, 0, false
+	}
+	u = ((b.Y-c.Y)*(x-c.X) + (c.X-b.X)*(y-c.Y)) / d
+	v = ((c.Y-a.Y)*(x-c.X) + (a.X-c.X)*(y-c.Y)) / d
+	return u, v, 1 - u - v, true
+}
+
+// Normal of the triangle facing up
+func upNormal(a, b, c *g3.Vec3) g3.Vec3 {
+	n := b.Sub(*a).Cross(c.Sub(*a)).Normalized()
+	if n.Z < 0 {
+		return n.Inverted()
+	}
+	return n
+}
+
+// Triangle below x, y and the barycentric coordinates of x, y. Points on
+// edges may be assigned to either triangle.
+func (gm *GeoMipMap) triangleAt(x, y float32) (tri [3]g3.Vec3, bary [3]float32, ok bool) {
+	if !gm.inside(x, y) {
+		return
+	}
+	sx, sy := x/gm.whScale, y/gm.whScale
+	p := gm.patches[gm.gridIndex(sy, gm.gridHeight)*gm.gridWidth+gm.gridIndex(sx, gm.gridWidth)]
+	lod, crackMask, morph := gm.queryLevel(p)
+	indices := gm.cellTriangles(p, sx, sy, lod, crackMask)
+	// the triangle x, y is deepest in, rounding errors put it slightly outside of all
+	best := float32(-g3.MathMax)
+	for i := 0; i+2 < len(indices); i += 3 {
+		t := [3]g3.Vec3{queryVertex(p, indices[i], lod, morph), queryVertex(p, indices[i+1], lod, morph),
+			queryVertex(p, indices[i+2], lod, morph)}
+		u, v, w, valid := barycentricXY(x, y, &t[0], &t[1], &t[2])
+		if m := g3.Min(u, g3.Min(v, w)); valid && m > best {
+			tri, bary, best, ok = t, [3]float32{u, v, w}, m, true
+		}
+	}
+	return
+}
+
+// Height of the terrain surface at x, y, false outside of the terrain.
+func (gm *GeoMipMap) HeightAt(x, y float32) (float32, bool) {
+	tri, bary, ok := gm.triangleAt(x, y)
+	if !ok {
+		return 0, false
+	}
+	return bary[0]*tri[0].Z + bary[1]*tri[1].Z + bary[2]*tri[2].Z, true
+}
+
+// Normal of the terrain triangle at x, y. Unlike the smooth vertex normals
+// used for lighting, this is the normal of the surface objects stand on.
+func (gm *GeoMipMap) NormalAt(x, y float32) (g3.Vec3, bool) {
+	tri, _, ok := gm.triangleAt(x, y)
+	if !ok {
+		return g3.Vec3{}, false
+	}
+	return upNormal(&tri[0], &tri[1], &tri[2]), true
+}
+
+// Exact test of a ray against the triangles of a patch
+func (gm *GeoMipMap) intersectPatch(element g3.SpatElement, ray *g3.Ray3) (g3.RayHit, bool) {
+	p := element.GetData().(*patch)
+	lod, crackMask, morph := gm.queryLevel(p)
+	indices := gm.indexData[crackMask][lod]
+	best := g3.RayHit{Distance: g3.MathMax}
+	for i := 0; i+2 < len(indices); i += 3 {
+		a := queryVertex(p, indices[i], lod, morph)
+		b := queryVertex(p, indices[i+1], lod, morph)
+		c := queryVertex(p, indices[i+2], lod, morph)
+		if hit, ok := ray.IntersectTriangle(&a, &b, &c); ok && hit.Distance < best.Distance {
+			best = hit
+		}
+	}
+	if best.Distance == g3.MathMax {
+		return best, false
+	}
+	if best.Normal.Z < 0 {
+		best.Normal = best.Normal.Inverted()
+	}
+	return best, true
+}
+
+// Nearest intersection of ray with the terrain, the normal of the hit faces up.
+func (gm *GeoMipMap) CastRay(ray *g3.Ray3) (g3.RayHit, bool) {
+	_, hit, ok := g3.RayCast(gm.root, ray, func(element g3.SpatElement, ray *g3.Ray3) (g3.RayHit, bool) {
+		return gm.intersectPatch(element, ray)
+	})
+	return hit, ok
+}
+
+// Ericson, Real-Time Collision Detection 5.1.5
+func closestPointTriangle(p, a, b, c *g3.Vec3) g3.Vec3 {
+	ab, ac, ap := b.Sub(*a), c.Sub(*a), p.Sub(*a)
+	d1, d2 := ab.Dot(ap), ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return *a
+	}
+	bp := p.Sub(*b)
+	d3, d4 := ab.Dot(bp), ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return *b
+	}
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return a.Add(ab.Mul(d1 / (d1 - d3)))
+	}
+	cp := p.Sub(*c)
+	d5, d6 := ab.Dot(cp), ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return *c
+	}
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return a.Add(ac.Mul(d2 / (d2 - d6)))
+	}
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		return b.Add(c.Sub(*b).Mul((d4 - d3) / ((d4 - d3) + (d5 - d6))))
+	}
+	denom := 1 / (va + vb + vc)
+	return a.Add(ab.Mul(vb * denom)).Add(ac.Mul(vc * denom))
+}
+
+// Ericson, Real-Time Collision Detection 5.1.9
+func closestPointsSegments(p1, q1, p2, q2 *g3.Vec3) (g3.Vec3, g3.Vec3) {
+	d1, d2, r := q1.Sub(*p1), q2.Sub(*p2), p1.Sub(*p2)
+	a, e, f := d1.Dot(d1), d2.Dot(d2), d2.Dot(r)
+	var s, t float32
+	switch {
+	case a <= g3.Epsilon && e <= g3.Epsilon:
+		return *p1, *p2
+	case a <= g3.Epsilon:
+		t = g3.Clamp(f/e, 0, 1)
+	case e <= g3.Epsilon:
+		s = g3.Clamp(-d1.Dot(r)/a, 0, 1)
+	default:
+		b, c := d1.Dot(d2), d1.Dot(r)
+		if denom := a*e - b*b; denom != 0 {
+			s = g3.Clamp((b*f-c*e)/denom, 0, 1)
+		}
+		t = (b*s + f) / e
+		if t < 0 {
+			t, s = 0, g3.Clamp(-c/a, 0, 1)
+		} else if t > 1 {
+			t, s = 1, g3.Clamp((b-c)/a, 0, 1)
+		}
+	}
+	return p1.Add(d1.Mul(s)), p2.Add(d2.Mul(t))
+}
+
+// Closest points of the segment a, b and a triangle
+func closestSegmentTriangle(a, b *g3.Vec3, tri *[3]g3.Vec3) (onSegment, onTriangle g3.Vec3) {
+	ray := g3.Ray3{*a, b.Sub(*a)}
+	if hit, ok := ray.IntersectTriangle(&tri[0], &tri[1], &tri[2]); ok && hit.Distance <= 1 {
+		return hit.Point, hit.Point
+	}
+	// otherwise a segment end or a triangle edge is part of the closest pair
+	onSegment, onTriangle = *a, closestPointTriangle(a, &tri[0], &tri[1], &tri[2])
+	best := onSegment.DistanceSq(onTriangle)
+	if q := closestPointTriangle(b, &tri[0], &tri[1], &tri[2]); q.DistanceSq(*b) < best {
+		onSegment, onTriangle, best = *b, q, q.DistanceSq(*b)
+	}
+	for i := 0; i < 3; i++ {
+		s, t := closestPointsSegments(a, b, &tri[i], &tri[(i+1)%3])
+		if d := s.DistanceSq(t); d < best {
+			onSegment, onTriangle, best = s, t, d
+		}
+	}
+	return
+}
+
+// Tests if the projection of p to the xy plane lies in the projection of tri
+func overTriangle(p *g3.Vec3, tri *[3]g3.Vec3) bool {
+	u, v, w, ok := barycentricXY(p.X, p.Y, &tri[0], &tri[1], &tri[2])
+	return ok && g3.Min(u, g3.Min(v, w)) >= -g3.Epsilon
+}
+
+// Contact of the segment a, b inflated by radius with a triangle. Segments
+// crossing the triangle or below it are pushed out along its normal. Segments
+// beside the triangle are below another triangle of the height field, they
+// only touch the edges of this one.
+func triangleContact(a, b *g3.Vec3, radius float32, tri *[3]g3.Vec3) (Contact, bool) {
+	// edge patches have degenerate triangles
+	cross := tri[1].Sub(tri[0]).Cross(tri[2].Sub(tri[0]))
+	if cross.LengthSq() == 0 {
+		return Contact{}, false
+	}
+	n := upNormal(&tri[0], &tri[1], &tri[2])
+	s, q := closestSegmentTriangle(a, b, tri)
+	d := s.Sub(q)
+	if dist := d.Length(); dist > 0 && (d.Dot(n) > 0 || !overTriangle(&s, tri)) {
+		if dist >= radius {
+			return Contact{}, false
+		}
+		return Contact{q, d.Mul(1 / dist), radius - dist}, true
+	}
+	below := g3.Max(g3.Max(tri[0].Sub(*a).Dot(n), tri[0].Sub(*b).Dot(n)), 0)
+	return Contact{q, n, radius + below}, true
+}
+
+// Deepest contact of a sphere with the terrain.
+func (gm *GeoMipMap) SphereContact(center g3.Vec3, radius float32) (Contact, bool) {
+	return gm.CapsuleContact(center, center, radius)
+}
+
+// Deepest contact of the capsule around the segment a, b with the terrain.
+func (gm *GeoMipMap) CapsuleContact(a, b g3.Vec3, radius float32) (Contact, bool) {
+	min := a.Min(b).Sub(g3.Vec3{radius, radius, radius})
+	max := a.Max(b).Add(g3.Vec3{radius, radius, radius})
+	bbox := gm.root.GetBoundingVolume().(*g3.BoundingBox)
+	if max.X < bbox.Min.X || max.Y < bbox.Min.Y || min.X > bbox.Max.X || min.Y > bbox.Max.Y || min.Z > bbox.Max.Z {
+		return Contact{}, false
+	}
+	min.Scale(1 / gm.whScale)
+	max.Scale(1 / gm.whScale)
+
+	var best Contact
+	found := false
+	for gy := gm.gridIndex(min.Y, gm.gridHeight); gy <= gm.gridIndex(max.Y, gm.gridHeight); gy++ {
+		for gx := gm.gridIndex(min.X, gm.gridWidth); gx <= gm.gridIndex(max.X, gm.gridWidth); gx++ {
+			p := gm.patches[gy*gm.gridWidth+gx]
+			lod, crackMask, morph := gm.queryLevel(p)
+			skip := pow2(uint(lod))
+			ox, oy := p.gridX*gm.patchSize, p.gridY*gm.patchSize
+			for cy := gm.cellIndex(min.Y, oy, skip); cy <= gm.cellIndex(max.Y, oy, skip); cy += skip {
+				for cx := gm.cellIndex(min.X, ox, skip); cx <= gm.cellIndex(max.X, ox, skip); cx += skip {
+					indices := addNewQuad(nil, pow2(gm.maxLOD)+1, cy, cx, skip, crackMask)
+					for i := 0; i+2 < len(indices); i += 3 {
+						tri := [3]g3.Vec3{queryVertex(p, indices[i], lod, morph), queryVertex(p, indices[i+1], lod, morph),
+							queryVertex(p, indices[i+2], lod, morph)}
+						if c, ok := triangleContact(&a, &b, radius, &tri); ok && c.Depth > best.Depth {
+							best, found = c, true
+						}
+					}
+				}
+			}
+		}
+	}
+	return best, found
+}
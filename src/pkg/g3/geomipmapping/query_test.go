@@ -0,0 +1,116 @@
+package geomipmapping
+
+import (
+	"g3"
+	"rand"
+	"testing"
+)
+
+// z = 2 + 0.1x + 0.05y with a height scale of 10
+type planeHeightMap struct{}
+
+func (hm planeHeightMap) Size() (width, height int) {
+	return 100, 70
+}
+
+func (hm planeHeightMap) Height(x, y float32) float32 {
+	return 0.2 + 0.01*x + 0.005*y
+}
+
+func TestHeightQueries(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, planeHeightMap{}, 16, 3, 1, 10)
+	normal := g3.Vec3{-0.1, -0.05, 1}.Normalized()
+	r := rand.New(rand.NewSource(1))
+	for _, lod := range []int{0, 2, 5} {
+		gm.SetQueryLOD(lod)
+		for i := 0; i < 100; i++ {
+			x, y := r.Float32()*99, r.Float32()*69
+			expected := 2 + 0.1*x + 0.05*y
+			if h, ok := gm.HeightAt(x, y); !ok || !g3.ApproxEqualEps(h, expected, 1e-4) {
+				t.Fatalf("level %d: height %f at %f,%f, expected %f", lod, h, x, y, expected)
+			}
+			if n, ok := gm.NormalAt(x, y); !ok || !n.ApproxEqualEps(normal, 1e-4) {
+				t.Fatalf("level %d: normal %v at %f,%f", lod, n, x, y)
+			}
+			ray := g3.Ray3{g3.Vec3{x, y, 50}, g3.Vec3{0, 0, -1}}
+			if hit, ok := gm.CastRay(&ray); !ok || !g3.ApproxEqualEps(hit.Point.Z, expected, 1e-4) {
+				t.Fatalf("level %d: ray hit %v at %f,%f, expected %f", lod, hit, x, y, expected)
+			}
+		}
+	}
+	if _, ok := gm.HeightAt(99.5, 10); ok {
+		t.Error("height outside of the terrain")
+	}
+
+	// 1 unit above the plane, the distance along the normal is normal.Z
+	center := g3.Vec3{50, 30, 2 + 5 + 1.5 + 1}
+	if c, ok := gm.SphereContact(center, 1); !ok || !g3.ApproxEqualEps(c.Depth, 1-normal.Z, 1e-4) || !c.Normal.ApproxEqualEps(normal, 1e-4) {
+		t.Errorf("sphere contact %v %v", c, ok)
+	}
+	if c, ok := gm.SphereContact(center, 0.5); ok {
+		t.Errorf("sphere contact %v above the terrain", c)
+	}
+	// the lower end is 0.5 below the surface
+	if c, ok := gm.CapsuleContact(g3.Vec3{20, 20, 4.5}, g3.Vec3{20, 20, 10}, 0.2); !ok || !g3.ApproxEqualEps(c.Depth, 0.2+0.5*normal.Z, 1e-4) {
+		t.Errorf("capsule contact %v %v", c, ok)
+	}
+}
+
+// Flat ground rising to a plateau of height 5 between x = 20 and x = 21
+type plateauHeightMap struct{}
+
+func (hm plateauHeightMap) Size() (width, height int) {
+	return 64, 64
+}
+
+func (hm plateauHeightMap) Height(x, y float32) float32 {
+	return g3.Clamp(x-20, 0, 1) * 0.5
+}
+
+func TestEdgeContacts(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, plateauHeightMap{}, 16, 4, 1, 10)
+	up := g3.Vec3{0, 0, 1}
+	// the slope below the edge doesn't push spheres on the plateau sideways
+	if c, ok := gm.SphereContact(g3.Vec3{21.3, 10, 5.4}, 0.5); !ok || !g3.ApproxEqualEps(c.Depth, 0.1, 1e-4) || !c.Normal.ApproxEqualEps(up, 1e-4) {
+		t.Errorf("contact %v %v on the plateau", c, ok)
+	}
+	if c, ok := gm.SphereContact(g3.Vec3{21.3, 10, 4.9}, 0.5); !ok || !g3.ApproxEqualEps(c.Depth, 0.6, 1e-4) || !c.Normal.ApproxEqualEps(up, 1e-4) {
+		t.Errorf("contact %v %v in the plateau", c, ok)
+	}
+	if c, ok := gm.SphereContact(g3.Vec3{21.4, 10, 5.1}, 0.5); ok {
+		if c.Normal.Z < 0.5 {
+			t.Errorf("contact %v at the edge pushes sideways", c)
+		}
+	}
+	// spheres above the edge touch it along the bisector of the normals
+	edge := g3.Vec3{21, 10, 5}
+	bisector := g3.Vec3{-5, 0, 1}.Normalized().Add(up).Normalized()
+	c, ok := gm.SphereContact(edge.Add(bisector.Mul(0.4)), 0.5)
+	if !ok || !g3.ApproxEqualEps(c.Depth, 0.1, 1e-4) || !c.Point.ApproxEqualEps(edge, 1e-4) || !c.Normal.ApproxEqualEps(bisector, 1e-4) {
+		t.Errorf("edge contact %v %v", c, ok)
+	}
+	// spheres at the foot of the slope are pushed away from it
+	if c, ok := gm.SphereContact(g3.Vec3{19.8, 10, 0.6}, 0.5); !ok || c.Normal.X >= 0 {
+		t.Errorf("contact %v %v at the foot of the slope", c, ok)
+	}
+}
+
+func TestRenderedQueries(t *testing.T) {
+	gm := NewGeoMipMap(testDevice{}, &waveHeightMap{256, 256}, 32, 5, 1, 0.3)
+	gm.SetLODParams(g3.Deg2Rad(60), 480, 2)
+	eye := g3.Vec3{10, 10, 5}
+	gm.selectLODs(gm.patches, &eye)
+	gm.SetQueryLOD(RenderedLOD)
+
+	// the cell triangles of HeightAt match the index buffers used by CastRay
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		x, y := r.Float32()*255, r.Float32()*255
+		h, ok := gm.HeightAt(x, y)
+		ray := g3.Ray3{g3.Vec3{x, y, 10}, g3.Vec3{0, 0, -1}}
+		hit, hitOk := gm.CastRay(&ray)
+		if !ok || !hitOk || !g3.ApproxEqualEps(h, hit.Point.Z, 1e-4) {
+			t.Fatalf("height %f at %f,%f, ray hit %v", h, x, y, hit)
+		}
+	}
+}
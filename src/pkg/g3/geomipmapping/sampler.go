@@ -0,0 +1,127 @@
+package geomipmapping
+
+import (
+	"math"
+)
+
+// Height maps made of samples on an integer grid
+type SampleSource interface {
+	Size() (width, height int)
+	// Height of the sample x, y with 0 <= x < width and 0 <= y < height
+	SampleHeight(x, y int) float32
+}
+
+// Samples any HeightMap at integer positions
+type heightMapSamples struct {
+	HeightMap
+}
+
+func (hm heightMapSamples) SampleHeight(x, y int) float32 {
+	return hm.Height(float32(x), float32(y))
+}
+
+// Samples of heightMap, so it can be filtered by a Sampler
+func HeightMapSamples(heightMap HeightMap) SampleSource {
+	if source, ok := heightMap.(SampleSource); ok {
+		return source
+	}
+	return heightMapSamples{heightMap}
+}
+
+// Maps sample positions outside of a height map
+type EdgeMode int
+
+const (
+	// repeats the border samples
+	EdgeClamp EdgeMode = iota
+	// repeats the height map
+	EdgeWrap
+	// reflects the height map at its border samples
+	EdgeMirror
+)
+
+type FilterMode int
+
+const (
+	FilterNearest FilterMode = iota
+	FilterBilinear
+	// Catmull-Rom spline through the 4x4 samples around a position
+	FilterBicubic
+)
+
+// HeightMap filtering the samples of a SampleSource. The sampler is a
+// SampleSource itself, its samples outside of the source are mapped by the
+// edge mode.
+type Sampler struct {
+	Source SampleSource
+	Edge   EdgeMode
+	Filter FilterMode
+}
+
+func NewSampler(source SampleSource, edge EdgeMode, filter FilterMode) *Sampler {
+	return &Sampler{source, edge, filter}
+}
+
+func (s *Sampler) Size() (width, height int) {
+	return s.Source.Size()
+}
+
+// Maps the sample i to 0 <= i < n
+func (mode EdgeMode) apply(i, n int) int {
+	switch mode {
+	case EdgeWrap:
+		return (i%n + n) % n
+	case EdgeMirror:
+		if n == 1 {
+			return 0
+		}
+		period := 2 * (n - 1)
+		i = (i%period + period) % period
+		if i >= n {
+			return period - i
+		}
+		return i
+	}
+	return clampInt(i, 0, n-1)
+}
+
+// Accepts any sample position.
+func (s *Sampler) SampleHeight(x, y int) float32 {
+	w, h := s.Source.Size()
+	return s.Source.SampleHeight(s.Edge.apply(x, w), s.Edge.apply(y, h))
+}
+
+func floor(v float32) (int, float32) {
+	f := float32(math.Floor(float64(v)))
+	return int(f), v - f
+}
+
+// Catmull-Rom spline between p1 and p2
+func cubic(p0, p1, p2, p3, t float32) float32 {
+	return p1 + 0.5*t*(p2-p0+t*(2*p0-5*p1+4*p2-p3+t*(3*(p1-p2)+p3-p0)))
+}
+
+func (s *Sampler) Height(x, y float32) float32 {
+	ix, fx := floor(x)
+	iy, fy := floor(y)
+	switch s.Filter {
+	case FilterNearest:
+		if fx >= 0.5 {
+			ix++
+		}
+		if fy >= 0.5 {
+			iy++
+		}
+		return s.SampleHeight(ix, iy)
+	case FilterBicubic:
+		var rows [4]float32
+		for j := 0; j < 4; j++ {
+			y := iy - 1 + j
+			rows[j] = cubic(s.SampleHeight(ix-1, y), s.SampleHeight(ix, y), s.SampleHeight(ix+1, y), s.SampleHeight(ix+2, y), fx)
+		}
+		return cubic(rows[0], rows[1], rows[2], rows[3], fy)
+	}
+	h0 := s.SampleHeight(ix, iy)*(1-fx) + s.SampleHeight(ix+1, iy)*fx
+	h1 := s.SampleHeight(ix, iy+1)*(1-fx) + s.SampleHeight(ix+1, iy+1)*fx
+	return h0*(1-fy) + h1*fy
+}
@@ -0,0 +1,102 @@
+package geomipmapping
+
+import (
+	"g3"
+	"image"
+	"testing"
+)
+
+// Gray16 image with bounds starting at x0, y0
+type offsetImage struct {
+	*image.Gray16
+	x0, y0 int
+}
+
+func (img offsetImage) Bounds() image.Rectangle {
+	return img.Gray16.Bounds().Add(image.Point{img.x0, img.y0})
+}
+
+func (img offsetImage) At(x, y int) image.Color {
+	return img.Gray16.At(x-img.x0, y-img.y0)
+}
+
+func TestEdgeModes(t *testing.T) {
+	hm := NewFloatHeightMap(4, 1, []float32{0, 1, 2, 3})
+	expected := map[EdgeMode][]float32{
+		EdgeClamp:  {0, 0, 0, 1, 2, 3, 3, 3},
+		EdgeWrap:   {2, 3, 0, 1, 2, 3, 0, 1},
+		EdgeMirror: {2, 1, 0, 1, 2, 3, 2, 1},
+	}
+	for mode, heights := range expected {
+		s := NewSampler(hm, mode, FilterNearest)
+		for i, h := range heights {
+			if x := i - 2; s.SampleHeight(x, 0) != h || s.Height(float32(x), 0) != h {
+				t.Errorf("mode %d: sample %d is %f, expected %f", mode, x, s.SampleHeight(x, 0), h)
+			}
+		}
+	}
+	// no blending with the opposite side unless wrapped
+	if h := NewSampler(hm, EdgeClamp, FilterBilinear).Height(3.5, 0); h != 3 {
+		t.Errorf("clamped height %f past the edge", h)
+	}
+	if h := NewSampler(hm, EdgeWrap, FilterBilinear).Height(3.5, 0); h != 1.5 {
+		t.Errorf("wrapped height %f past the edge", h)
+	}
+}
+
+func TestFilterModes(t *testing.T) {
+	// linear in x, quadratic in y
+	hm := NewFloatHeightMap(5, 5, nil)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			hm.SetSample(x, y, float32(2*x+y*y))
+		}
+	}
+	nearest := NewSampler(hm, EdgeClamp, FilterNearest)
+	bilinear := NewSampler(hm, EdgeClamp, FilterBilinear)
+	bicubic := NewSampler(hm, EdgeClamp, FilterBicubic)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			h := hm.Sample(x, y)
+			for _, s := range []*Sampler{nearest, bilinear, bicubic} {
+				if s.Height(float32(x), float32(y)) != h {
+					t.Fatalf("filter %d: %f at sample %d,%d, expected %f", s.Filter, s.Height(float32(x), float32(y)), x, y, h)
+				}
+			}
+		}
+	}
+	if h := nearest.Height(1.4, 2.6); h != 11 {
+		t.Errorf("nearest height %f, expected 11", h)
+	}
+	if h := bilinear.Height(1.5, 2.5); h != 9.5 {
+		t.Errorf("bilinear height %f, expected 9.5", h)
+	}
+	// the spline is exact for linear and quadratic samples away from the edges
+	if h := bicubic.Height(1.5, 2.5); !g3.ApproxEqual(h, 9.25) {
+		t.Errorf("bicubic height %f, expected 9.25", h)
+	}
+	if h := bicubic.Height(2.25, 1.75); !g3.ApproxEqual(h, 4.5+1.75*1.75) {
+		t.Errorf("bicubic height %f, expected %f", h, 4.5+1.75*1.75)
+	}
+}
+
+func TestImageBounds(t *testing.T) {
+	gray := image.NewGray16(3, 2)
+	for x := 0; x < 3; x++ {
+		gray.Set(x, 0, image.Gray16Color{uint16(x * 1000)})
+		gray.Set(x, 1, image.Gray16Color{uint16(x*1000 + 500)})
+	}
+	hm := NewHeightMapFromImage(offsetImage{gray, 10, -5})
+	if w, h := hm.Size(); w != 3 || h != 2 {
+		t.Fatalf("size %dx%d, expected 3x2", w, h)
+	}
+	if h := hm.Height(2, 1); h*65535 != 2500 {
+		t.Errorf("height %f at the last sample", h*65535)
+	}
+
+	// HeightMaps without samples are sampled at integer positions
+	s := NewSampler(HeightMapSamples(planeHeightMap{}), EdgeClamp, FilterBilinear)
+	if h := s.Height(150, 20.5); !g3.ApproxEqual(h, planeHeightMap{}.Height(99, 20.5)) {
+		t.Errorf("height %f past the edge of the plane", h)
+	}
+}
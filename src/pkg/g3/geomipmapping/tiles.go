@@ -0,0 +1,176 @@
+package geomipmapping
+
+import (
+	"bytes"
+	"encoding/binary"
+	"g3"
+	"io"
+	"os"
+)
+
+// A tiled height map file is a header chunk followed by one chunk per tile
+// in row major order. Each tile stores the samples of tileSize x tileSize
+// sample intervals and a border of one sample, clamped to the height map,
+// so tiles can be built without their neighbours. All tile chunks have the
+// same size and are read with random access.
+
+const tiledHeightMapVersion = 1
+
+var (
+	tiledHeightMapMagic = [4]byte{'G', '3', 'H', 'T'}
+	heightTileMagic     = [4]byte{'G', '3', 'T', 'L'}
+)
+
+var ErrTileData = os.NewError("geomipmapping: invalid tiled height map data")
+
+// chunk size of the header
+const tiledHeightMapHeaderSize = g3.ChunkHeaderSize + 12
+
+type tiledHeightMapHeader struct {
+	Width    int32
+	Height   int32
+	TileSize int32
+}
+
+// Samples of one tile and its border, addressed with height map coordinates.
+// Positions are truncated to samples.
+type HeightTile struct {
+	mapWidth, mapHeight int
+	// height map position of the first sample
+	x0, y0 int
+	size   int
+	data   []float32
+}
+
+// Samples the tile tx, ty of heightMap.
+func NewHeightTile(heightMap HeightMap, tileSize, tx, ty int) *HeightTile {
+	w, h := heightMap.Size()
+	size := tileSize + 3
+	tile := &HeightTile{w, h, tx*tileSize - 1, ty*tileSize - 1, size, make([]float32, size*size)}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			sx, sy := clampInt(tile.x0+x, 0, w-1), clampInt(tile.y0+y, 0, h-1)
+			tile.data[y*size+x] = heightMap.Height(float32(sx), float32(sy))
+		}
+	}
+	return tile
+}
+
+// Size of the whole height map
+func (t *HeightTile) Size() (width, height int) {
+	return t.mapWidth, t.mapHeight
+}
+
+func (t *HeightTile) Height(x, y float32) float32 {
+	ix := clampInt(int(x)-t.x0, 0, t.size-1)
+	iy := clampInt(int(y)-t.y0, 0, t.size-1)
+	return t.data[iy*t.size+ix]
+}
+
+// Number of tiles covering the w-1 x h-1 sample intervals of a height map
+func tileCount(w, h, tileSize int) (int, int) {
+	return (w - 2 + tileSize) / tileSize, (h - 2 + tileSize) / tileSize
+}
+
+// Writes heightMap split into tiles of tileSize x tileSize sample intervals.
+func WriteTiledHeightMap(w io.Writer, heightMap HeightMap, tileSize int) os.Error {
+	width, height := heightMap.Size()
+	if tileSize < 1 || width < 2 || height < 2 {
+		return ErrTileData
+	}
+	header := tiledHeightMapHeader{int32(width), int32(height), int32(tileSize)}
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, &header)
+	if err := g3.WriteChunk(w, tiledHeightMapMagic, tiledHeightMapVersion, body.Bytes()); err != nil {
+		return err
+	}
+	tilesX, tilesY := tileCount(width, height, tileSize)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			body.Reset()
+			binary.Write(body, binary.LittleEndian, NewHeightTile(heightMap, tileSize, tx, ty).data)
+			if err := g3.WriteChunk(w, heightTileMagic, tiledHeightMapVersion, body.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Height map file read tile by tile, safe for concurrent use if the
+// underlying reader is.
+type TiledHeightMap struct {
+	reader         io.ReaderAt
+	file           *os.File
+	width, height  int
+	tileSize       int
+	tilesX, tilesY int
+}
+
+func OpenTiledHeightMap(r io.ReaderAt) (*TiledHeightMap, os.Error) {
+	_, body, err := g3.ReadChunk(io.NewSectionReader(r, 0, tiledHeightMapHeaderSize), tiledHeightMapMagic, tiledHeightMapVersion)
+	if err != nil {
+		return nil, err
+	}
+	var header tiledHeightMapHeader
+	if err := binary.Read(bytes.NewBuffer(body), binary.LittleEndian, &header); err != nil {
+		return nil, ErrTileData
+	}
+	if header.Width < 2 || header.Height < 2 || header.TileSize < 1 {
+		return nil, ErrTileData
+	}
+	t := &TiledHeightMap{reader: r, width: int(header.Width), height: int(header.Height), tileSize: int(header.TileSize)}
+	t.tilesX, t.tilesY = tileCount(t.width, t.height, t.tileSize)
+	return t, nil
+}
+
+// The file stays open until Close is called.
+func OpenTiledHeightMapFile(fileName string) (*TiledHeightMap, os.Error) {
+	file, err := os.Open(fileName, os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	t, err := OpenTiledHeightMap(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	t.file = file
+	return t, nil
+}
+
+func (t *TiledHeightMap) Close() os.Error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// Samples of the height map
+func (t *TiledHeightMap) Size() (width, height int) {
+	return t.width, t.height
+}
+
+// Sample intervals of a tile
+func (t *TiledHeightMap) TileSize() int {
+	return t.tileSize
+}
+
+func (t *TiledHeightMap) ReadTile(tx, ty int) (*HeightTile, os.Error) {
+	if tx < 0 || ty < 0 || tx >= t.tilesX || ty >= t.tilesY {
+		return nil, ErrTileData
+	}
+	size := t.tileSize + 3
+	chunkSize := int64(g3.ChunkHeaderSize + size*size*4)
+	offset := tiledHeightMapHeaderSize + int64(ty*t.tilesX+tx)*chunkSize
+	_, body, err := g3.ReadChunk(io.NewSectionReader(t.reader, offset, chunkSize), heightTileMagic, tiledHeightMapVersion)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) != size*size*4 {
+		return nil, ErrTileData
+	}
+	tile := &HeightTile{t.width, t.height, tx*t.tileSize - 1, ty*t.tileSize - 1, size, make([]float32, size*size)}
+	binary.Read(bytes.NewBuffer(body), binary.LittleEndian, tile.data)
+	return tile, nil
+}
@@ -1,13 +1,36 @@
 package geomipmapping
 
 import (
-	"os"
-	"io"
+	"encoding/binary"
 	"image"
+	"io"
+	"os"
 )
 
+// Elevation range of a height map. Samples are normalized to [0, 1] and
+// mapped to Min + sample * (Max - Min), the default range is [0, 1].
+type Elevation struct {
+	Min, Max float32
+}
+
+func (e Elevation) apply(v float32) float32 {
+	return e.Min + v*(e.Max-e.Min)
+}
+
+// Height maps are filtered bilinear and clamped to their borders, use a
+// Sampler for other modes.
 type ImageHeightMap struct {
-	img image.Image
+	img       image.Image
+	elevation Elevation
+	sampler   Sampler
+}
+
+// Samples are the luminance of the pixels, 16 bit grayscale images keep
+// their full precision.
+func NewHeightMapFromImage(img image.Image) *ImageHeightMap {
+	hm := &ImageHeightMap{img: img, elevation: Elevation{0, 1}}
+	hm.sampler = Sampler{hm, EdgeClamp, FilterBilinear}
+	return hm
 }
 
 // Generates a new HeighMap object from an image stream
@@ -16,7 +39,7 @@ func NewHeightMapFromImageStream(reader io.Reader) (*ImageHeightMap, os.Error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ImageHeightMap{img}, nil
+	return NewHeightMapFromImage(img), nil
 }
 
 // Generates a new HeighMap object from an image file
@@ -29,25 +52,109 @@ func NewHeightMapFromImageFile(fileName string) (*ImageHeightMap, os.Error) {
 	return NewHeightMapFromImageStream(file)
 }
 
+func (hm *ImageHeightMap) SetElevation(min, max float32) {
+	hm.elevation = Elevation{min, max}
+}
+
 func (hm *ImageHeightMap) Size() (width, height int) {
 	rect := hm.img.Bounds()
-	return rect.Max.X - rect.Min.Y, rect.Max.Y - rect.Min.Y
+	return rect.Dx(), rect.Dy()
+}
+
+// Luminance of a pixel, relative to the bounds of the image
+func (hm *ImageHeightMap) SampleHeight(x, y int) float32 {
+	rect := hm.img.Bounds()
+	r, g, b, _ := hm.img.At(rect.Min.X+x, rect.Min.Y+y).RGBA()
+	// same weights as the gray color models, exact for gray pixels
+	return hm.elevation.apply(float32((299*r+587*g+114*b)/1000) / 65535.0)
 }
 
 func (hm *ImageHeightMap) Height(x, y float32) float32 {
-	w, h := hm.Size()
-	color1 := hm.img.At(int(x)%w, int(y)%h)
-	color2 := hm.img.At(int(x+1)%w, int(y)%h)
-	color3 := hm.img.At(int(x)%w, int(y+1)%h)
-	color4 := hm.img.At(int(x+1)%w, int(y+1)%h)
-	fx := x - float32(int(x))
-	fy := y - float32(int(y))
-	h1, _, _, _ := color1.RGBA()
-	h2, _, _, _ := color2.RGBA()
-	h3, _, _, _ := color3.RGBA()
-	h4, _, _, _ := color4.RGBA()
-	hx1 := float32(h1)*(1.0-fx) + fx*float32(h2)
-	hx2 := float32(h3)*(1.0-fx) + fx*float32(h4)
-	he := hx1*(1.0-fy) + fy*hx2
-	return float32(he) / (255.0 * 255.0)
+	return hm.sampler.Height(x, y)
+}
+
+// In memory height map of normalized samples, row major. Filtered like
+// ImageHeightMap.
+type FloatHeightMap struct {
+	width, height int
+	data          []float32
+	elevation     Elevation
+	sampler       Sampler
+}
+
+// data is used directly, a new map is created if it is nil.
+func NewFloatHeightMap(width, height int, data []float32) *FloatHeightMap {
+	if data == nil {
+		data = make([]float32, width*height)
+	}
+	hm := &FloatHeightMap{width: width, height: height, data: data, elevation: Elevation{0, 1}}
+	hm.sampler = Sampler{hm, EdgeClamp, FilterBilinear}
+	return hm
+}
+
+func (hm *FloatHeightMap) SetElevation(min, max float32) {
+	hm.elevation = Elevation{min, max}
+}
+
+func (hm *FloatHeightMap) Size() (width, height int) {
+	return hm.width, hm.height
+}
+
+// Normalized sample
+func (hm *FloatHeightMap) Sample(x, y int) float32 {
+	return hm.data[y*hm.width+x]
+}
+
+func (hm *FloatHeightMap) SetSample(x, y int, v float32) {
+	hm.data[y*hm.width+x] = v
+}
+
+func (hm *FloatHeightMap) SampleHeight(x, y int) float32 {
+	return hm.elevation.apply(hm.data[y*hm.width+x])
+}
+
+func (hm *FloatHeightMap) Height(x, y float32) float32 {
+	return hm.sampler.Height(x, y)
+}
+
+// Sample formats of raw height map files without header
+const (
+	// unsigned 16 bit integers, .r16
+	RawUint16 = iota
+	// 32 bit floats, .r32
+	RawFloat32
+)
+
+var ErrRawFormat = os.NewError("geomipmapping: unknown raw height map format")
+
+// Reads width x height samples, row major. 16 bit samples are normalized,
+// floats are used as they are.
+func ReadRawHeightMap(r io.Reader, width, height, format int, order binary.ByteOrder) (*FloatHeightMap, os.Error) {
+	hm := NewFloatHeightMap(width, height, nil)
+	switch format {
+	case RawUint16:
+		samples := make([]uint16, width*height)
+		if err := binary.Read(r, order, samples); err != nil {
+			return nil, err
+		}
+		for i, v := range samples {
+			hm.data[i] = float32(v) / 65535.0
+		}
+	case RawFloat32:
+		if err := binary.Read(r, order, hm.data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrRawFormat
+	}
+	return hm, nil
+}
+
+func LoadRawHeightMap(fileName string, width, height, format int, order binary.ByteOrder) (*FloatHeightMap, os.Error) {
+	file, err := os.Open(fileName, os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadRawHeightMap(file, width, height, format, order)
 }
@@ -0,0 +1,64 @@
+package geomipmapping
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestImageHeightMap(t *testing.T) {
+	img := image.NewGray16(4, 2)
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, image.Gray16Color{uint16(x * 21845)})
+		img.Set(x, 1, image.Gray16Color{1})
+	}
+	b := new(bytes.Buffer)
+	if err := png.Encode(b, img); err != nil {
+		t.Fatal(err)
+	}
+	hm, err := NewHeightMapFromImageStream(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// full range and 16 bit precision
+	if h := hm.Height(3, 0); h != 1 {
+		t.Errorf("white is %f", h)
+	}
+	if h := hm.Height(0, 1); h != 1.0/65535.0 {
+		t.Errorf("lowest step is %g", h)
+	}
+	hm.SetElevation(-100, 500)
+	if h := hm.Height(1, 0); h != 100 {
+		t.Errorf("elevation %f, expected 100", h)
+	}
+}
+
+func TestRawHeightMap(t *testing.T) {
+	b := new(bytes.Buffer)
+	binary.Write(b, binary.BigEndian, []uint16{0, 65535, 32768, 1})
+	hm, err := ReadRawHeightMap(b, 2, 2, RawUint16, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm.SetElevation(10, 20)
+	if w, h := hm.Size(); w != 2 || h != 2 || hm.Height(0, 0) != 10 || hm.Height(1, 0) != 20 {
+		t.Errorf("%dx%d map, heights %f %f", w, h, hm.Height(0, 0), hm.Height(1, 0))
+	}
+
+	b.Reset()
+	binary.Write(b, binary.LittleEndian, []float32{-3.5, 2, 8, 0.25})
+	if hm, err = ReadRawHeightMap(b, 2, 2, RawFloat32, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	if hm.Height(0, 0) != -3.5 || hm.Height(1, 1) != 0.25 || hm.Height(0.5, 1) != 4.125 {
+		t.Errorf("heights %f %f %f", hm.Height(0, 0), hm.Height(1, 1), hm.Height(0.5, 1))
+	}
+
+	b.Reset()
+	binary.Write(b, binary.LittleEndian, []uint16{1, 2, 3})
+	if _, err := ReadRawHeightMap(b, 2, 2, RawUint16, binary.LittleEndian); err == nil {
+		t.Error("short file accepted")
+	}
+}
@@ -50,6 +50,7 @@ type IndexBuffer interface {
 type Shader interface {
 	GetUniformLocation(name string) uint
 	SetVec3(location uint, v *Vec3)
+	SetFloat(location uint, v float32)
 	SetTexture(location uint, unit uint)
 	Release()
 }
@@ -25,6 +25,25 @@ func Tan(x float32) float32 {
 	return float32(math.Tan(float64(x)))
 }
 
+func Pow(x, y float32) float32 {
+	return float32(math.Pow(float64(x), float64(y)))
+}
+
+func Acos(x float32) float32 {
+	return float32(math.Acos(float64(x)))
+}
+
+func Floor(x float32) float32 {
+	return float32(math.Floor(float64(x)))
+}
+
+func Abs(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
 func Deg2Rad(d float32) float32 {
 	return d * math.Pi / 180.0
 }
@@ -60,3 +79,46 @@ func Clamp(a, min, max float32) float32 {
 	return a
 }
 
+// Tolerance used by the approximate comparisons
+const Epsilon = float32(1e-6)
+
+// Absolute comparison, eps is in the units of a and b.
+func ApproxEqualEps(a, b, eps float32) bool {
+	return Abs(a-b) <= eps
+}
+
+// Epsilon is absolute up to one and relative to the larger magnitude above,
+// so large coordinates compare equal within their float precision.
+func ApproxEqual(a, b float32) bool {
+	return ApproxEqualEps(a, b, Epsilon*Max(1, Max(Abs(a), Abs(b))))
+}
+
+// True if a and b are at most ulps float32 steps apart, whatever their
+// magnitude. Zeros of both signs are equal, NaNs never are.
+func ApproxEqualUlps(a, b float32, ulps uint32) bool {
+	if a != a || b != b {
+		return false
+	}
+	ia, ib := orderedBits(a), orderedBits(b)
+	if ia < ib {
+		ia, ib = ib, ia
+	}
+	return ia-ib <= int64(ulps)
+}
+
+// Maps the bits of x to integers in the order of the floats
+func orderedBits(x float32) int64 {
+	bits := math.Float32bits(x)
+	if bits&(1<<31) != 0 {
+		return -int64(bits &^ (1 << 31))
+	}
+	return int64(bits)
+}
+
+func ApproxZero(a float32) bool {
+	return Abs(a) <= Epsilon
+}
+
+func Lerp(a, b, t float32) float32 {
+	return a + (b-a)*t
+}
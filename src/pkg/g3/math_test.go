@@ -0,0 +1,86 @@
+package g3
+
+import (
+	"math"
+	"testing"
+)
+
+func TestApproxEqual(t *testing.T) {
+	tests := []struct {
+		a, b  float32
+		equal bool
+	}{
+		{0, 0, true},
+		{0, 1e-7, true},
+		{0, 1e-5, false},
+		{1, 1 + 1e-7, true},
+		{1, 1.0001, false},
+		// relative above one, a float32 near 1e6 is only exact to 1/16
+		{1e6, 1e6 + 0.5, true},
+		{1e6, 1e6 + 2, false},
+		{-1e6, -1e6 - 0.5, true},
+		{-1e6, 1e6, false},
+	}
+	for i, test := range tests {
+		if ApproxEqual(test.a, test.b) != test.equal || ApproxEqual(test.b, test.a) != test.equal {
+			t.Errorf("%d: ApproxEqual(%g, %g) != %v", i, test.a, test.b, test.equal)
+		}
+	}
+	if !ApproxEqualEps(100, 100.5, 1) || ApproxEqualEps(100, 101.5, 1) {
+		t.Error("ApproxEqualEps is not absolute")
+	}
+}
+
+func TestApproxEqualUlps(t *testing.T) {
+	one := math.Float32bits(1)
+	nan := float32(math.NaN())
+	tests := []struct {
+		a, b  float32
+		ulps  uint32
+		equal bool
+	}{
+		{1, 1, 0, true},
+		{1, math.Float32frombits(one + 1), 0, false},
+		{1, math.Float32frombits(one + 1), 1, true},
+		{1, math.Float32frombits(one - 2), 1, false},
+		{1e30, math.Float32frombits(math.Float32bits(1e30) + 4), 4, true},
+		{0, float32(math.Copysign(0, -1)), 0, true},
+		// across zero the distance is the sum of both sides
+		{math.Float32frombits(1), -math.Float32frombits(1), 1, false},
+		{math.Float32frombits(1), -math.Float32frombits(1), 2, true},
+		{-1, 1, math.MaxUint32, true},
+		{nan, nan, math.MaxUint32, false},
+		{nan, 1, math.MaxUint32, false},
+	}
+	for i, test := range tests {
+		if ApproxEqualUlps(test.a, test.b, test.ulps) != test.equal || ApproxEqualUlps(test.b, test.a, test.ulps) != test.equal {
+			t.Errorf("%d: ApproxEqualUlps(%g, %g, %d) != %v", i, test.a, test.b, test.ulps, test.equal)
+		}
+	}
+}
+
+func TestScalarHelpers(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want float32
+	}{
+		{"Lerp 0", Lerp(2, 6, 0), 2},
+		{"Lerp 1", Lerp(2, 6, 1), 6},
+		{"Lerp half", Lerp(2, 6, 0.5), 4},
+		{"Lerp extrapolate", Lerp(2, 6, -0.5), 0},
+		{"Clamp below", Clamp(-1, 0, 1), 0},
+		{"Clamp above", Clamp(2, 0, 1), 1},
+		{"Clamp inside", Clamp(0.25, 0, 1), 0.25},
+		{"Abs", Abs(-3), 3},
+		{"Floor", Floor(-1.5), -2},
+		{"Deg2Rad", Deg2Rad(180), Pi},
+	}
+	for _, test := range tests {
+		if !ApproxEqual(test.got, test.want) {
+			t.Errorf("%s: %f, want %f", test.name, test.got, test.want)
+		}
+	}
+	if min, max := MinMax(3, -2); min != -2 || max != 3 {
+		t.Errorf("MinMax(3, -2) = %f, %f", min, max)
+	}
+}
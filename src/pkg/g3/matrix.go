@@ -84,10 +84,57 @@ func MakePerspectiveMatrix(fovy, aspect, zNear, zFar float32) Matrix4x4 {
 		0.0, 0.0, -1.0, 0.0}
 }
 
+// Perspective projection with the far plane at infinity
+func MakeInfinitePerspectiveMatrix(fovy, aspect, zNear float32) Matrix4x4 {
+	f := 1.0 / Tan(fovy/2.0)
+	return Matrix4x4{
+		f / aspect, 0.0, 0.0, 0.0,
+		0.0, f, 0.0, 0.0,
+		0.0, 0.0, -1.0, -2.0 * zNear,
+		0.0, 0.0, -1.0, 0.0}
+}
+
+// Same as glFrustum
+func MakeFrustumMatrix(left, right, bottom, top, zNear, zFar float32) Matrix4x4 {
+	w := 1.0 / (right - left)
+	h := 1.0 / (top - bottom)
+	d := 1.0 / (zNear - zFar)
+	return Matrix4x4{
+		2.0 * zNear * w, 0.0, (right + left) * w, 0.0,
+		0.0, 2.0 * zNear * h, (top + bottom) * h, 0.0,
+		0.0, 0.0, (zFar + zNear) * d, 2.0 * zFar * zNear * d,
+		0.0, 0.0, -1.0, 0.0}
+}
+
+// Same as glOrtho
+func MakeOrthographicMatrix(left, right, bottom, top, zNear, zFar float32) Matrix4x4 {
+	w := 1.0 / (right - left)
+	h := 1.0 / (top - bottom)
+	d := 1.0 / (zFar - zNear)
+	return Matrix4x4{
+		2.0 * w, 0.0, 0.0, -(right + left) * w,
+		0.0, 2.0 * h, 0.0, -(top + bottom) * h,
+		0.0, 0.0, -2.0 * d, -(zFar + zNear) * d,
+		0.0, 0.0, 0.0, 1.0}
+}
+
+// Rotation of theta radians around an arbitrary axis (need not be normalized)
+func MakeRotationMatrix(axis Vec3, theta float32) Matrix4x4 {
+	a := axis.Normalized()
+	c := Cos(theta)
+	s := Sin(theta)
+	t := 1.0 - c
+	return Matrix4x4{
+		t*a.X*a.X + c, t*a.X*a.Y - s*a.Z, t*a.X*a.Z + s*a.Y, 0.0,
+		t*a.X*a.Y + s*a.Z, t*a.Y*a.Y + c, t*a.Y*a.Z - s*a.X, 0.0,
+		t*a.X*a.Z - s*a.Y, t*a.Y*a.Z + s*a.X, t*a.Z*a.Z + c, 0.0,
+		0.0, 0.0, 0.0, 1.0}
+}
+
 func MakeLookAtMatrix(eye, center, up *Vec3) Matrix4x4 {
 	f := center.Sub(*eye).Normalized()
 	u := up.Normalized()
-	s := f.Cross(u)
+	s := f.Cross(u).Normalized()
 	u = s.Cross(f)
 	t := MakeTranslationMatrix(-eye.X, -eye.Y, -eye.Z)
 	return Matrix4x4{
@@ -135,6 +182,131 @@ func (m Matrix4x4) Transform(v Vec3) Vec3 {
 		m.M31*v.X+m.M32*v.Y+m.M33*v.Z+m.M34}
 }
 
+// Transforms v as a direction, the translation part of m is ignored
+func (m Matrix4x4) TransformDirection(v Vec3) Vec3 {
+	return Vec3{
+		m.M11*v.X + m.M12*v.Y + m.M13*v.Z,
+		m.M21*v.X + m.M22*v.Y + m.M23*v.Z,
+		m.M31*v.X + m.M32*v.Y + m.M33*v.Z}
+}
+
+func (m Matrix4x4) TransformVec4(v Vec4) Vec4 {
+	return Vec4{
+		m.M11*v.X + m.M12*v.Y + m.M13*v.Z + m.M14*v.W,
+		m.M21*v.X + m.M22*v.Y + m.M23*v.Z + m.M24*v.W,
+		m.M31*v.X + m.M32*v.Y + m.M33*v.Z + m.M34*v.W,
+		m.M41*v.X + m.M42*v.Y + m.M43*v.Z + m.M44*v.W}
+}
+
+func (m Matrix4x4) Determinant() float32 {
+	s0 := m.M11*m.M22 - m.M21*m.M12
+	s1 := m.M11*m.M23 - m.M21*m.M13
+	s2 := m.M11*m.M24 - m.M21*m.M14
+	s3 := m.M12*m.M23 - m.M22*m.M13
+	s4 := m.M12*m.M24 - m.M22*m.M14
+	s5 := m.M13*m.M24 - m.M23*m.M14
+	c5 := m.M33*m.M44 - m.M43*m.M34
+	c4 := m.M32*m.M44 - m.M42*m.M34
+	c3 := m.M32*m.M43 - m.M42*m.M33
+	c2 := m.M31*m.M44 - m.M41*m.M34
+	c1 := m.M31*m.M43 - m.M41*m.M33
+	c0 := m.M31*m.M42 - m.M41*m.M32
+	return s0*c5 - s1*c4 + s2*c3 + s3*c2 - s4*c1 + s5*c0
+}
+
+// General inverse. Returns false if m is singular.
+func (m Matrix4x4) Inverted() (Matrix4x4, bool) {
+	s0 := m.M11*m.M22 - m.M21*m.M12
+	s1 := m.M11*m.M23 - m.M21*m.M13
+	s2 := m.M11*m.M24 - m.M21*m.M14
+	s3 := m.M12*m.M23 - m.M22*m.M13
+	s4 := m.M12*m.M24 - m.M22*m.M14
+	s5 := m.M13*m.M24 - m.M23*m.M14
+	c5 := m.M33*m.M44 - m.M43*m.M34
+	c4 := m.M32*m.M44 - m.M42*m.M34
+	c3 := m.M32*m.M43 - m.M42*m.M33
+	c2 := m.M31*m.M44 - m.M41*m.M34
+	c1 := m.M31*m.M43 - m.M41*m.M33
+	c0 := m.M31*m.M42 - m.M41*m.M32
+
+	det := s0*c5 - s1*c4 + s2*c3 + s3*c2 - s4*c1 + s5*c0
+	if det == 0.0 {
+		return m, false
+	}
+	d := 1.0 / det
+
+	return Matrix4x4{
+		(m.M22*c5 - m.M23*c4 + m.M24*c3) * d,
+		(-m.M12*c5 + m.M13*c4 - m.M14*c3) * d,
+		(m.M42*s5 - m.M43*s4 + m.M44*s3) * d,
+		(-m.M32*s5 + m.M33*s4 - m.M34*s3) * d,
+
+		(-m.M21*c5 + m.M23*c2 - m.M24*c1) * d,
+		(m.M11*c5 - m.M13*c2 + m.M14*c1) * d,
+		(-m.M41*s5 + m.M43*s2 - m.M44*s1) * d,
+		(m.M31*s5 - m.M33*s2 + m.M34*s1) * d,
+
+		(m.M21*c4 - m.M22*c2 + m.M24*c0) * d,
+		(-m.M11*c4 + m.M12*c2 - m.M14*c0) * d,
+		(m.M41*s4 - m.M42*s2 + m.M44*s0) * d,
+		(-m.M31*s4 + m.M32*s2 - m.M34*s0) * d,
+
+		(-m.M21*c3 + m.M22*c1 - m.M23*c0) * d,
+		(m.M11*c3 - m.M12*c1 + m.M13*c0) * d,
+		(-m.M41*s3 + m.M42*s1 - m.M43*s0) * d,
+		(m.M31*s3 - m.M32*s1 + m.M33*s0) * d}, true
+}
+
+// Fast inverse for affine matrices (last row is 0 0 0 1).
+// Returns false if the upper 3x3 part is singular.
+func (m Matrix4x4) InvertedAffine() (Matrix4x4, bool) {
+	c11 := m.M22*m.M33 - m.M23*m.M32
+	c12 := m.M23*m.M31 - m.M21*m.M33
+	c13 := m.M21*m.M32 - m.M22*m.M31
+	det := m.M11*c11 + m.M12*c12 + m.M13*c13
+	if det == 0.0 {
+		return m, false
+	}
+	d := 1.0 / det
+
+	r := Matrix4x4{
+		c11 * d, (m.M13*m.M32 - m.M12*m.M33) * d, (m.M12*m.M23 - m.M13*m.M22) * d, 0.0,
+		c12 * d, (m.M11*m.M33 - m.M13*m.M31) * d, (m.M13*m.M21 - m.M11*m.M23) * d, 0.0,
+		c13 * d, (m.M12*m.M31 - m.M11*m.M32) * d, (m.M11*m.M22 - m.M12*m.M21) * d, 0.0,
+		0.0, 0.0, 0.0, 1.0}
+	t := r.TransformDirection(Vec3{m.M14, m.M24, m.M34})
+	r.M14, r.M24, r.M34 = -t.X, -t.Y, -t.Z
+	return r, true
+}
+
+// Splits an affine matrix into translation, rotation and scale,
+// so that m = T * R * S. A negative determinant is folded into scale.X.
+func (m Matrix4x4) Decompose() (translation Vec3, rotation Quaternion, scale Vec3) {
+	translation = Vec3{m.M14, m.M24, m.M34}
+
+	x := Vec3{m.M11, m.M21, m.M31}
+	y := Vec3{m.M12, m.M22, m.M32}
+	z := Vec3{m.M13, m.M23, m.M33}
+	scale = Vec3{x.Length(), y.Length(), z.Length()}
+	if x.Cross(y).Dot(z) < 0.0 {
+		scale.X = -scale.X
+	}
+	if scale.X == 0.0 || scale.Y == 0.0 || scale.Z == 0.0 {
+		return translation, MakeIdentityQuaternion(), scale
+	}
+
+	x.Scale(1.0 / scale.X)
+	y.Scale(1.0 / scale.Y)
+	z.Scale(1.0 / scale.Z)
+	r := Matrix4x4{
+		x.X, y.X, z.X, 0.0,
+		x.Y, y.Y, z.Y, 0.0,
+		x.Z, y.Z, z.Z, 0.0,
+		0.0, 0.0, 0.0, 1.0}
+	rotation = MakeQuaternionFromMatrix(&r)
+	return
+}
+
 func (m *Matrix4x4) String() string {
 	return fmt.Sprintf(
 		"/%f %f %f %f\\\n|%f %f %f %f|\n|%f %f %f %f|\n\\%f %f %f %f/",
@@ -0,0 +1,181 @@
+package g3
+
+import (
+	"testing"
+)
+
+func composeMatrix(translation Vec3, rotation Quaternion, scale Vec3) Matrix4x4 {
+	t := MakeTranslationMatrix(translation.X, translation.Y, translation.Z)
+	r := MakeMatrixFromQuaternion(rotation)
+	s := MakeScaleMatrix(scale.X, scale.Y, scale.Z)
+	m := t.Multiply(&r)
+	return m.Multiply(&s)
+}
+
+func TestMatrixInverse(t *testing.T) {
+	identity := MakeIdentityMatrix()
+	perspective := MakePerspectiveMatrix(Deg2Rad(60), 1.5, 0.5, 100)
+	eye, center, up := Vec3{3, -4, 2}, Vec3{0, 1, 0}, Vec3{0, 0, 1}
+	tests := []struct {
+		name   string
+		m      Matrix4x4
+		affine bool
+		det    float32
+	}{
+		{"identity", identity, true, 1},
+		{"translation", MakeTranslationMatrix(1, -2, 3), true, 1},
+		{"scale", MakeScaleMatrix(2, 3, 4), true, 24},
+		{"mirror", MakeScaleMatrix(-1, 1, 1), true, -1},
+		{"rotation", MakeRotationMatrix(Vec3{1, 2, 3}, 0.7), true, 1},
+		{"trs", composeMatrix(Vec3{5, 6, -7}, MakeQuaternionFromEuler(0.1, 0.2, 0.3), Vec3{0.5, 2, 1}), true, 1},
+		// up is not perpendicular to the view direction
+		{"look at", MakeLookAtMatrix(&eye, &center, &up), true, 1},
+		{"perspective", perspective, false, perspective.Determinant()},
+		{"general", Matrix4x4{2, 0, 1, 0, 1, 3, 0, 1, 0, 1, 4, 0, 1, 0, 0, 1}, false, 24},
+	}
+	for _, test := range tests {
+		if det := test.m.Determinant(); !ApproxEqualEps(det, test.det, 1e-4*Max(1, Abs(test.det))) {
+			t.Errorf("%s: determinant %f, want %f", test.name, det, test.det)
+		}
+		inv, ok := test.m.Inverted()
+		if !ok {
+			t.Errorf("%s: not invertible", test.name)
+			continue
+		}
+		for _, p := range []Matrix4x4{test.m.Multiply(&inv), inv.Multiply(&test.m)} {
+			if !approxEqualMatrix(&p, &identity, 1e-4) {
+				t.Errorf("%s: m * inverse\n%v", test.name, p.String())
+			}
+		}
+		if det := inv.Determinant(); !ApproxEqualEps(det*test.det, 1, 1e-4) {
+			t.Errorf("%s: inverse determinant %f", test.name, det)
+		}
+		if !test.affine {
+			continue
+		}
+		affine, ok := test.m.InvertedAffine()
+		if !ok || !approxEqualMatrix(&affine, &inv, 1e-5) {
+			t.Errorf("%s: affine inverse\n%v\nwant\n%v", test.name, affine.String(), inv.String())
+		}
+	}
+
+	singular := []Matrix4x4{
+		{},
+		MakeScaleMatrix(1, 0, 1),
+		// two equal rows
+		{1, 2, 3, 4, 1, 2, 3, 4, 0, 1, 0, 0, 0, 0, 0, 1},
+	}
+	for i, m := range singular {
+		if _, ok := m.Inverted(); ok {
+			t.Errorf("singular %d: inverted", i)
+		}
+	}
+	if _, ok := singular[1].InvertedAffine(); ok {
+		t.Error("singular affine inverted")
+	}
+}
+
+func TestMatrixDecompose(t *testing.T) {
+	tests := []struct {
+		translation Vec3
+		rotation    Quaternion
+		scale       Vec3
+	}{
+		{Vec3{}, MakeIdentityQuaternion(), Vec3{1, 1, 1}},
+		{Vec3{1, 2, 3}, MakeIdentityQuaternion(), Vec3{2, 2, 2}},
+		{Vec3{-4, 0, 8}, MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, 1), Vec3{1, 3, 0.5}},
+		{Vec3{0.5, 0.5, 0.5}, MakeQuaternionFromEuler(0.3, -0.6, 2), Vec3{4, 0.25, 1}},
+		// a mirror shows up as a negative x scale
+		{Vec3{1, 0, 0}, MakeQuaternionFromAxisAngle(Vec3{1, 1, 0}, 2), Vec3{-2, 1, 1}},
+	}
+	for i, test := range tests {
+		m := composeMatrix(test.translation, test.rotation, test.scale)
+		translation, rotation, scale := m.Decompose()
+		if !translation.ApproxEqualEps(test.translation, 1e-6) || !scale.ApproxEqualEps(test.scale, 1e-5) ||
+			!approxEqualRotation(rotation, test.rotation) {
+			t.Errorf("%d: %v %v %v, want %v %v %v", i, translation, rotation.String(), scale,
+				test.translation, test.rotation.String(), test.scale)
+		}
+		if r := composeMatrix(translation, rotation, scale); !approxEqualMatrix(&r, &m, 1e-5) {
+			t.Errorf("%d: recomposed\n%v\nwant\n%v", i, r.String(), m.String())
+		}
+	}
+
+	m := MakeScaleMatrix(1, 0, 1)
+	if _, rotation, scale := m.Decompose(); rotation != MakeIdentityQuaternion() || scale.Y != 0 {
+		t.Errorf("degenerate scale %v rotation %v", scale, rotation.String())
+	}
+}
+
+func TestProjectionMatrices(t *testing.T) {
+	perspective := MakePerspectiveMatrix(Deg2Rad(90), 2, 1, 10)
+	infinite := MakeInfinitePerspectiveMatrix(Deg2Rad(90), 2, 1)
+	frustum := MakeFrustumMatrix(-2, 2, -1, 1, 1, 10)
+	ortho := MakeOrthographicMatrix(-4, 4, 0, 2, 1, 3)
+	tests := []struct {
+		name string
+		m    *Matrix4x4
+		v    Vec3
+		ndc  Vec3
+	}{
+		{"perspective near", &perspective, Vec3{0, 0, -1}, Vec3{0, 0, -1}},
+		{"perspective far", &perspective, Vec3{0, 0, -10}, Vec3{0, 0, 1}},
+		{"perspective corner", &perspective, Vec3{2, -1, -1}, Vec3{1, -1, -1}},
+		{"infinite near", &infinite, Vec3{0, 0, -1}, Vec3{0, 0, -1}},
+		{"infinite corner", &infinite, Vec3{-20, 10, -10}, Vec3{-1, 1, 0.8}},
+		{"frustum near", &frustum, Vec3{2, 1, -1}, Vec3{1, 1, -1}},
+		{"frustum far", &frustum, Vec3{-20, -10, -10}, Vec3{-1, -1, 1}},
+		{"ortho near", &ortho, Vec3{-4, 0, -1}, Vec3{-1, -1, -1}},
+		{"ortho far", &ortho, Vec3{4, 2, -3}, Vec3{1, 1, 1}},
+		{"ortho center", &ortho, Vec3{0, 1, -2}, Vec3{0, 0, 0}},
+	}
+	for _, test := range tests {
+		if ndc := test.m.TransformVec4(test.v.Vec4(1)).Homogenized(); !ndc.ApproxEqualEps(test.ndc, 1e-5) {
+			t.Errorf("%s: %v, want %v", test.name, ndc, test.ndc)
+		}
+	}
+	// a symmetric frustum is the perspective matrix
+	if !approxEqualMatrix(&frustum, &perspective, 1e-6) {
+		t.Errorf("frustum\n%v\nwant\n%v", frustum.String(), perspective.String())
+	}
+	// the infinite far plane is never reached
+	if far := infinite.TransformVec4(Vec4{0, 0, -1e6, 1}).Homogenized(); far.Z >= 1 || far.Z < 0.99 {
+		t.Errorf("infinite far depth %f", far.Z)
+	}
+}
+
+func TestMatrixTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Matrix4x4
+	}{
+		{"x axis", MakeRotationMatrix(Vec3{2, 0, 0}, 0.4), MakeXRotationMatrix(0.4)},
+		{"y axis", MakeRotationMatrix(Vec3{0, 1, 0}, -1.1), MakeYRotationMatrix(-1.1)},
+		{"z axis", MakeRotationMatrix(Vec3{0, 0, 1}, 2.5), MakeZRotationMatrix(2.5)},
+		{"negated axis", MakeRotationMatrix(Vec3{0, 0, -1}, 2.5), MakeZRotationMatrix(-2.5)},
+		{"quaternion", MakeRotationMatrix(Vec3{1, 2, 3}, 1), MakeMatrixFromQuaternion(MakeQuaternionFromAxisAngle(Vec3{1, 2, 3}, 1))},
+		{"transpose of rotation", MakeRotationMatrix(Vec3{1, 2, 3}, 1).Transposed(), MakeRotationMatrix(Vec3{1, 2, 3}, -1)},
+	}
+	for _, test := range tests {
+		if !approxEqualMatrix(&test.a, &test.b, 1e-6) {
+			t.Errorf("%s:\n%v\nwant\n%v", test.name, test.a.String(), test.b.String())
+		}
+	}
+
+	m := composeMatrix(Vec3{1, 2, 3}, MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, Pi/2), Vec3{2, 2, 2})
+	v := Vec3{1, 0, 0}
+	if p := m.Transform(v); !p.ApproxEqualEps(Vec3{1, 4, 3}, 1e-5) {
+		t.Errorf("Transform %v", p)
+	}
+	if d := m.TransformDirection(v); !d.ApproxEqualEps(Vec3{0, 2, 0}, 1e-5) {
+		t.Errorf("TransformDirection %v", d)
+	}
+	p, d := m.TransformVec4(v.Vec4(1)), m.TransformVec4(v.Vec4(0))
+	if !p.Vec3().ApproxEqualEps(m.Transform(v), 1e-5) || p.W != 1 ||
+		!d.Vec3().ApproxEqualEps(m.TransformDirection(v), 1e-5) || d.W != 0 {
+		t.Errorf("TransformVec4 %v %v", p, d)
+	}
+	if s := MakeMatrixFromSlice([]float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}); s.M12 != 2 || s.M21 != 5 || s.M44 != 16 {
+		t.Errorf("MakeMatrixFromSlice\n%v", s.String())
+	}
+}
@@ -0,0 +1,220 @@
+package g3
+
+// Box with arbitrary orientation. Axes are orthonormal, Extents are
+// the half sizes along each axis.
+type OrientedBoundingBox struct {
+	Center  Vec3
+	Axes    [3]Vec3
+	Extents Vec3
+}
+
+// Local axis aligned box bbox placed in the world by m. Scale in m is moved into Extents.
+// The axes are made orthonormal (Gram-Schmidt) if m shears, the box then
+// encloses the transformed bbox. An axis scaled to zero is replaced by one
+// perpendicular to the others.
+func MakeOrientedBoundingBoxFromBox(bbox *BoundingBox, m *Matrix4x4) OrientedBoundingBox {
+	center := bbox.CalculateCenter()
+	half := bbox.Max.Sub(center)
+	dirs := [3]Vec3{
+		m.TransformDirection(Vec3{1, 0, 0}),
+		m.TransformDirection(Vec3{0, 1, 0}),
+		m.TransformDirection(Vec3{0, 0, 1})}
+	var axes [3]Vec3
+	axes[0] = dirs[0]
+	if axes[0].LengthSq() == 0.0 {
+		axes[0] = dirs[1].Cross(dirs[2])
+	}
+	axes[0] = normalizedOr(axes[0], Vec3{1, 0, 0})
+	axes[1] = dirs[1].Sub(axes[0].Scaled(dirs[1].Dot(axes[0])))
+	axes[1] = normalizedOr(axes[1], perpendicularAxis(axes[0]))
+	axes[2] = axes[0].Cross(axes[1])
+	if axes[2].Dot(dirs[2]) < 0.0 {
+		// m mirrors
+		axes[2] = axes[2].Inverted()
+	}
+
+	// the transformed half edges projected onto each axis
+	edges := [3]Vec3{dirs[0].Scaled(half.X), dirs[1].Scaled(half.Y), dirs[2].Scaled(half.Z)}
+	var extents [3]float32
+	for i := range axes {
+		for _, edge := range edges {
+			extents[i] += Abs(axes[i].Dot(edge))
+		}
+	}
+	return OrientedBoundingBox{m.Transform(center), axes, Vec3{extents[0], extents[1], extents[2]}}
+}
+
+// v normalized, fallback if v is too short to have a direction
+func normalizedOr(v, fallback Vec3) Vec3 {
+	l := v.Length()
+	if l == 0.0 || 1.0/l > MathMax {
+		return fallback
+	}
+	return v.Scaled(1.0 / l)
+}
+
+// Some unit vector perpendicular to the unit vector v
+func perpendicularAxis(v Vec3) Vec3 {
+	// cross with the coordinate axis that is least parallel to v
+	axis := Vec3{1, 0, 0}
+	if Abs(v.Y) < Abs(v.X) && Abs(v.Y) <= Abs(v.Z) {
+		axis = Vec3{0, 1, 0}
+	} else if Abs(v.Z) < Abs(v.X) && Abs(v.Z) < Abs(v.Y) {
+		axis = Vec3{0, 0, 1}
+	}
+	return v.Cross(axis).Normalized()
+}
+
+func (obb *OrientedBoundingBox) extent(i int) float32 {
+	switch i {
+	case 0:
+		return obb.Extents.X
+	case 1:
+		return obb.Extents.Y
+	}
+	return obb.Extents.Z
+}
+
+// Radius of the box projected onto the direction n
+func (obb *OrientedBoundingBox) projectedRadius(n *Vec3) float32 {
+	return obb.Extents.X*Abs(n.Dot(obb.Axes[0])) +
+		obb.Extents.Y*Abs(n.Dot(obb.Axes[1])) +
+		obb.Extents.Z*Abs(n.Dot(obb.Axes[2]))
+}
+
+// Transforms v into the box's local frame (origin at the center)
+func (obb *OrientedBoundingBox) toLocal(v *Vec3) Vec3 {
+	d := v.Sub(obb.Center)
+	return d.TransformToLocal(&obb.Axes[0], &obb.Axes[1], &obb.Axes[2])
+}
+
+func (obb *OrientedBoundingBox) Corners() [8]Vec3 {
+	x := obb.Axes[0].Scaled(obb.Extents.X)
+	y := obb.Axes[1].Scaled(obb.Extents.Y)
+	z := obb.Axes[2].Scaled(obb.Extents.Z)
+	var corners [8]Vec3
+	for i := range corners {
+		c := obb.Center
+		if i&1 == 0 {
+			c = c.Sub(x)
+		} else {
+			c = c.Add(x)
+		}
+		if i&2 == 0 {
+			c = c.Sub(y)
+		} else {
+			c = c.Add(y)
+		}
+		if i&4 == 0 {
+			c = c.Sub(z)
+		} else {
+			c = c.Add(z)
+		}
+		corners[i] = c
+	}
+	return corners
+}
+
+// Enclosing axis aligned box
+func (obb *OrientedBoundingBox) CalculateBoundingBox() BoundingBox {
+	r := Vec3{
+		obb.projectedRadius(&Vec3{1, 0, 0}),
+		obb.projectedRadius(&Vec3{0, 1, 0}),
+		obb.projectedRadius(&Vec3{0, 0, 1})}
+	return BoundingBox{obb.Center.Sub(r), obb.Center.Add(r)}
+}
+
+func (obb *OrientedBoundingBox) ClosestPoint(v *Vec3) Vec3 {
+	l := obb.toLocal(v)
+	l = Vec3{
+		Clamp(l.X, -obb.Extents.X, obb.Extents.X),
+		Clamp(l.Y, -obb.Extents.Y, obb.Extents.Y),
+		Clamp(l.Z, -obb.Extents.Z, obb.Extents.Z)}
+	return obb.Center.Add(l.TransformToWorld(&obb.Axes[0], &obb.Axes[1], &obb.Axes[2]))
+}
+
+func (obb *OrientedBoundingBox) ClassifyPoint(v *Vec3) bool {
+	l := obb.toLocal(v)
+	return Abs(l.X) < obb.Extents.X && Abs(l.Y) < obb.Extents.Y && Abs(l.Z) < obb.Extents.Z
+}
+
+// The plane has to be normalized.
+func (obb *OrientedBoundingBox) ClassifyPlane(p *Plane) int {
+	d := p.DistanceToPoint(&obb.Center)
+	r := obb.projectedRadius(&p.Normal)
+	if d >= r {
+		return ClassifyInside
+	} else if d < -r {
+		return ClassifyOutside
+	}
+	return ClassifyIntersecting
+}
+
+// Separating axis test with the 15 candidate axes
+func (obb *OrientedBoundingBox) IntersectOrientedBox(other *OrientedBoundingBox) bool {
+	// rotation of other expressed in obb's frame
+	var r, absR [3][3]float32
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = obb.Axes[i].Dot(other.Axes[j])
+			// epsilon avoids false separation when edges are parallel
+			absR[i][j] = Abs(r[i][j]) + Epsilon
+		}
+	}
+	d := other.Center.Sub(obb.Center)
+	t := [3]float32{d.Dot(obb.Axes[0]), d.Dot(obb.Axes[1]), d.Dot(obb.Axes[2])}
+
+	// axes of obb
+	for i := 0; i < 3; i++ {
+		ra := obb.extent(i)
+		rb := other.Extents.X*absR[i][0] + other.Extents.Y*absR[i][1] + other.Extents.Z*absR[i][2]
+		if Abs(t[i]) > ra+rb {
+			return false
+		}
+	}
+	// axes of other
+	for j := 0; j < 3; j++ {
+		ra := obb.Extents.X*absR[0][j] + obb.Extents.Y*absR[1][j] + obb.Extents.Z*absR[2][j]
+		rb := other.extent(j)
+		if Abs(t[0]*r[0][j]+t[1]*r[1][j]+t[2]*r[2][j]) > ra+rb {
+			return false
+		}
+	}
+	// cross products of both axes
+	for i := 0; i < 3; i++ {
+		i1, i2 := (i+1)%3, (i+2)%3
+		for j := 0; j < 3; j++ {
+			j1, j2 := (j+1)%3, (j+2)%3
+			ra := obb.extent(i1)*absR[i2][j] + obb.extent(i2)*absR[i1][j]
+			rb := other.extent(j1)*absR[i][j2] + other.extent(j2)*absR[i][j1]
+			if Abs(t[i2]*r[i1][j]-t[i1]*r[i2][j]) > ra+rb {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (obb *OrientedBoundingBox) IntersectBox(bbox *BoundingBox) bool {
+	identity := MakeIdentityMatrix()
+	other := MakeOrientedBoundingBoxFromBox(bbox, &identity)
+	return obb.IntersectOrientedBox(&other)
+}
+
+func (obb *OrientedBoundingBox) IntersectSphere(sphere *BoundingSphere) bool {
+	p := obb.ClosestPoint(&sphere.Position)
+	return p.DistanceSq(sphere.Position) <= sphere.Radius*sphere.Radius
+}
+
+// Slab test in the box's local frame. If the ray starts inside the box the exit point is returned.
+func (obb *OrientedBoundingBox) IntersectRay(ray *Ray3) (RayHit, bool) {
+	local := Ray3{obb.toLocal(&ray.Pos), ray.Dir.TransformToLocal(&obb.Axes[0], &obb.Axes[1], &obb.Axes[2])}
+	bbox := BoundingBox{obb.Extents.Inverted(), obb.Extents}
+	hit, ok := local.IntersectBoundingBox(&bbox)
+	if !ok {
+		return hit, false
+	}
+	hit.Point = ray.PointAt(hit.Distance)
+	hit.Normal = hit.Normal.TransformToWorld(&obb.Axes[0], &obb.Axes[1], &obb.Axes[2])
+	return hit, true
+}
@@ -0,0 +1,243 @@
+package g3
+
+import (
+	"rand"
+	"testing"
+)
+
+var _ BoundingVolume = &OrientedBoundingBox{}
+
+func makeTestOBB(center Vec3, halfSize Vec3, rotation Quaternion) OrientedBoundingBox {
+	bbox := BoundingBox{halfSize.Inverted(), halfSize}
+	m := composeMatrix(center, rotation, Vec3{1, 1, 1})
+	return MakeOrientedBoundingBoxFromBox(&bbox, &m)
+}
+
+// Reference separating axis test on the corners
+func separatedByCorners(a, b *OrientedBoundingBox) bool {
+	axes := []Vec3{}
+	for i := 0; i < 3; i++ {
+		axes = append(axes, a.Axes[i], b.Axes[i])
+		for j := 0; j < 3; j++ {
+			if c := a.Axes[i].Cross(b.Axes[j]); c.LengthSq() > 1e-6 {
+				axes = append(axes, c.Normalized())
+			}
+		}
+	}
+	ca, cb := a.Corners(), b.Corners()
+	for _, axis := range axes {
+		minA, maxA, minB, maxB := float32(MathMax), float32(-MathMax), float32(MathMax), float32(-MathMax)
+		for i := range ca {
+			pa, pb := ca[i].Dot(axis), cb[i].Dot(axis)
+			minA, maxA = Min(minA, pa), Max(maxA, pa)
+			minB, maxB = Min(minB, pb), Max(maxB, pb)
+		}
+		if maxA < minB || maxB < minA {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOrientedBoundingBoxFromBox(t *testing.T) {
+	bbox := BoundingBox{Vec3{0, 0, 0}, Vec3{2, 4, 6}}
+	m := composeMatrix(Vec3{1, 2, 3}, MakeQuaternionFromAxisAngle(Vec3{1, 1, 0}, 0.6), Vec3{2, 1, 0.5})
+	obb := MakeOrientedBoundingBoxFromBox(&bbox, &m)
+	if !obb.Extents.ApproxEqualEps(Vec3{2, 2, 1.5}, 1e-5) || !obb.Center.ApproxEqualEps(m.Transform(Vec3{1, 2, 3}), 1e-5) {
+		t.Errorf("center %v extents %v", obb.Center, obb.Extents)
+	}
+
+	// corners are the transformed corners of the box
+	corners := obb.Corners()
+	for i := range corners {
+		local := Vec3{float32(i & 1 * 2), float32(i >> 1 & 1 * 4), float32(i >> 2 & 1 * 6)}
+		if p := m.Transform(local); !corners[i].ApproxEqualEps(p, 1e-4) {
+			t.Errorf("corner %d %v, want %v", i, corners[i], p)
+		}
+	}
+	enclosing := obb.CalculateBoundingBox()
+	want := MakeBoundingBoxFromPoints(corners[:])
+	if !enclosing.Min.ApproxEqualEps(want.Min, 1e-4) || !enclosing.Max.ApproxEqualEps(want.Max, 1e-4) {
+		t.Errorf("bounding box %v, want %v", enclosing, want)
+	}
+
+	rotation := MakeQuaternionFromAxisAngle(Vec3{1, 1, 0}, 0.6)
+	tests := []struct {
+		name string
+		m    Matrix4x4
+	}{
+		{"trs", m},
+		{"mirror", composeMatrix(Vec3{1, 2, 3}, rotation, Vec3{-1, 2, 1})},
+		{"shear", Matrix4x4{1, 0.5, 0, 0, 0, 1, -2, 1, 0.3, 0, 1, 0, 0, 0, 0, 1}},
+		{"zero x scale", composeMatrix(Vec3{1, 2, 3}, rotation, Vec3{0, 1, 1})},
+		{"zero y scale", composeMatrix(Vec3{1, 2, 3}, rotation, Vec3{1, 0, 1})},
+		{"zero z scale", composeMatrix(Vec3{1, 2, 3}, rotation, Vec3{1, 1, 0})},
+		{"zero x and y scale", composeMatrix(Vec3{1, 2, 3}, rotation, Vec3{0, 0, 2})},
+		{"point", composeMatrix(Vec3{1, 2, 3}, rotation, Vec3{0, 0, 0})},
+	}
+	for _, test := range tests {
+		obb := MakeOrientedBoundingBoxFromBox(&bbox, &test.m)
+		for i, axis := range obb.Axes {
+			if !ApproxEqualEps(axis.Length(), 1, 1e-5) || !ApproxEqualEps(axis.Dot(obb.Axes[(i+1)%3]), 0, 1e-5) {
+				t.Errorf("%s: axis %d %v not orthonormal", test.name, i, axis)
+			}
+		}
+		// the box encloses the transformed corners
+		for _, corner := range boxCorners(&bbox) {
+			p := test.m.Transform(corner)
+			if closest := obb.ClosestPoint(&p); !closest.ApproxEqualEps(p, 1e-4) {
+				t.Errorf("%s: %v outside of %v", test.name, p, obb)
+			}
+		}
+	}
+}
+
+func TestOrientedBoundingBoxVolume(t *testing.T) {
+	// 2x4x2 box standing on the origin, turned 90 degrees around z
+	obb := makeTestOBB(Vec3{0, 0, 1}, Vec3{1, 2, 1}, MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, Pi/2))
+	points := []struct {
+		v      Vec3
+		inside bool
+	}{
+		{Vec3{0, 0, 1}, true},
+		{Vec3{1.9, 0.9, 0.1}, true},
+		{Vec3{0.9, 1.9, 1}, false},
+		{Vec3{0, 0, 2.1}, false},
+	}
+	for _, test := range points {
+		if obb.ClassifyPoint(&test.v) != test.inside {
+			t.Errorf("point %v inside != %v", test.v, test.inside)
+		}
+		closest := obb.ClosestPoint(&test.v)
+		if test.inside != closest.ApproxEqualEps(test.v, 1e-5) {
+			t.Errorf("closest point of %v is %v", test.v, closest)
+		}
+	}
+
+	s := 1 / Sqrt(2)
+	planes := []struct {
+		p      Plane
+		result int
+	}{
+		{Plane{Vec3{0, 0, 1}, 0.5}, ClassifyInside},
+		{Plane{Vec3{0, 0, 1}, -1}, ClassifyIntersecting},
+		{Plane{Vec3{0, 0, -1}, -0.5}, ClassifyOutside},
+		{Plane{Vec3{1, 0, 0}, 2.5}, ClassifyInside},
+		{Plane{Vec3{1, 0, 0}, 1.5}, ClassifyIntersecting},
+		{Plane{Vec3{0, 1, 0}, -1.5}, ClassifyOutside},
+		// the corner at 2, 1 is 3 / sqrt(2) along the diagonal
+		{Plane{Vec3{-s, -s, 0}, 2}, ClassifyIntersecting},
+		{Plane{Vec3{-s, -s, 0}, 2.2}, ClassifyInside},
+		{Plane{Vec3{s, s, 0}, -2.2}, ClassifyOutside},
+	}
+	for i, test := range planes {
+		if result := obb.ClassifyPlane(&test.p); result != test.result {
+			t.Errorf("plane %d: %d, want %d", i, result, test.result)
+		}
+	}
+
+	spheres := []struct {
+		sphere    BoundingSphere
+		intersect bool
+	}{
+		{BoundingSphere{Vec3{0, 0, 1}, 0.1}, true},
+		{BoundingSphere{Vec3{2.5, 0, 1}, 0.6}, true},
+		{BoundingSphere{Vec3{0, 1.5, 1}, 0.4}, false},
+		{BoundingSphere{Vec3{2.5, 1.5, 1}, 0.6}, false},
+		{BoundingSphere{Vec3{2.5, 1.5, 1}, 0.75}, true},
+	}
+	for i, test := range spheres {
+		if obb.IntersectSphere(&test.sphere) != test.intersect {
+			t.Errorf("sphere %d: intersect != %v", i, test.intersect)
+		}
+	}
+
+	rays := []struct {
+		name   string
+		ray    Ray3
+		hit    bool
+		t      float32
+		normal Vec3
+	}{
+		{"+x", Ray3{Vec3{-5, 0, 1}, Vec3{1, 0, 0}}, true, 3, Vec3{-1, 0, 0}},
+		{"-y", Ray3{Vec3{1, 5, 1}, Vec3{0, -1, 0}}, true, 4, Vec3{0, 1, 0}},
+		{"inside exits", Ray3{Vec3{0, 0, 1}, Vec3{0, 0, 1}}, true, 1, Vec3{0, 0, 1}},
+		{"miss", Ray3{Vec3{-5, 1.5, 1}, Vec3{1, 0, 0}}, false, 0, Vec3{}},
+	}
+	for _, test := range rays {
+		hit, ok := obb.IntersectRay(&test.ray)
+		if ok != test.hit {
+			t.Errorf("%s: hit %v, want %v", test.name, ok, test.hit)
+		} else if ok && (!ApproxEqual(hit.Distance, test.t) || !hit.Normal.ApproxEqual(test.normal)) {
+			t.Errorf("%s: distance %f normal %v, want %f %v", test.name, hit.Distance, hit.Normal, test.t, test.normal)
+		}
+	}
+}
+
+func TestIntersectOrientedBox(t *testing.T) {
+	identity := MakeIdentityQuaternion()
+	aroundZ := MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, Pi/4)
+	aroundY := MakeQuaternionFromAxisAngle(Vec3{0, 1, 0}, Pi/4)
+	unit := Vec3{1, 1, 1}
+	a := makeTestOBB(Vec3{}, unit, aroundZ)
+	tests := []struct {
+		name      string
+		b         OrientedBoundingBox
+		intersect bool
+	}{
+		{"same", a, true},
+		{"contained", makeTestOBB(Vec3{0.1, 0, 0}, Vec3{0.2, 0.2, 0.2}, identity), true},
+		{"overlapping", makeTestOBB(Vec3{2, 0, 0}, unit, identity), true},
+		// separated along a face axis of a
+		{"face of a", makeTestOBB(Vec3{2.5, 2.5, 0}, unit, aroundZ), false},
+		// a's corner points at b's face, separated along b's x axis
+		{"face of b", makeTestOBB(Vec3{2.5, 0, 0}, unit, identity), false},
+		{"above", makeTestOBB(Vec3{0, 0, 2.01}, unit, identity), false},
+		{"touching", makeTestOBB(Vec3{0, 0, 2}, unit, aroundZ), true},
+		// only the cross product of a's z edge and b's y edge separates
+		{"edge edge separated", makeTestOBB(Vec3{3.2, 0, 0}, unit, aroundY), false},
+		{"edge edge crossing", makeTestOBB(Vec3{2.6, 0, 0}, unit, aroundY), true},
+	}
+	for _, test := range tests {
+		if got := a.IntersectOrientedBox(&test.b); got != test.intersect {
+			t.Errorf("%s: intersect %v, want %v", test.name, got, test.intersect)
+		}
+		if got := test.b.IntersectOrientedBox(&a); got != test.intersect {
+			t.Errorf("%s: reversed intersect %v, want %v", test.name, got, test.intersect)
+		}
+		if separatedByCorners(&a, &test.b) == test.intersect {
+			t.Errorf("%s: reference disagrees", test.name)
+		}
+	}
+
+	bbox := BoundingBox{Vec3{1.2, -0.5, -0.5}, Vec3{2, 0.5, 0.5}}
+	if !a.IntersectBox(&bbox) {
+		t.Error("box at the corner not intersecting")
+	}
+	bbox = BoundingBox{Vec3{1.5, 1, -0.5}, Vec3{2, 2, 0.5}}
+	if a.IntersectBox(&bbox) {
+		t.Error("box beside the corner intersecting")
+	}
+
+	r := rand.New(rand.NewSource(7))
+	random := func() OrientedBoundingBox {
+		axis := Vec3{r.Float32() - 0.5, r.Float32() - 0.5, r.Float32() - 0.5}
+		center := Vec3{r.Float32() * 4, r.Float32() * 4, r.Float32() * 4}
+		half := Vec3{r.Float32() + 0.1, r.Float32() + 0.1, r.Float32() + 0.1}
+		return makeTestOBB(center, half, MakeQuaternionFromAxisAngle(axis, r.Float32()*2*Pi))
+	}
+	hits := 0
+	for i := 0; i < 500; i++ {
+		b, c := random(), random()
+		got := b.IntersectOrientedBox(&c)
+		if got == separatedByCorners(&b, &c) {
+			t.Fatalf("%d: intersect %v disagrees with the reference\n%v\n%v", i, got, b, c)
+		}
+		if got {
+			hits++
+		}
+	}
+	if hits == 0 || hits == 500 {
+		t.Errorf("%d of 500 random pairs intersect", hits)
+	}
+}
@@ -0,0 +1,327 @@
+package g3
+
+// Software depth buffer for occlusion culling. Occluders are rasterized
+// on the CPU at low resolution, bounding volumes are then tested against
+// the stored depths. Depth is the normalized device depth mapped to [0, 1].
+// Rasterization is conservative, a pixel is only occluded if it is covered
+// completely, so boxes are never culled by a wrong fraction of a pixel.
+type OcclusionBuffer struct {
+	width, height  int
+	depth          []float32
+	viewProjection Matrix4x4
+	// scratch buffers of RasterizeTriangles
+	projected  []Vec3
+	visible    []bool
+	triangles  []uint32
+	neighbours []int
+	surface    []int
+	first      []int
+	entries    []occlusionEntry
+	stack      []int
+}
+
+// Triangle touching a pixel, next is the following entry of the pixel or -1
+type occlusionEntry struct {
+	triangle, next int
+}
+
+// A few hundred pixels per side are enough, occluders should be coarse too.
+func NewOcclusionBuffer(width, height int) *OcclusionBuffer {
+	ob := &OcclusionBuffer{width: width, height: height, depth: make([]float32, width*height)}
+	ob.Clear(&ob.viewProjection)
+	return ob
+}
+
+func (ob *OcclusionBuffer) Size() (width, height int) {
+	return ob.width, ob.height
+}
+
+// Resets all depths to the far plane. viewProjection is used for all
+// following rasterization and tests.
+func (ob *OcclusionBuffer) Clear(viewProjection *Matrix4x4) {
+	ob.viewProjection = *viewProjection
+	for i := range ob.depth {
+		ob.depth[i] = 1.0
+	}
+}
+
+// Depth at pixel (x, y)
+func (ob *OcclusionBuffer) Depth(x, y int) float32 {
+	return ob.depth[y*ob.width+x]
+}
+
+// returns screen x, y and depth, false if v is behind the eye
+func (ob *OcclusionBuffer) project(v *Vec3) (Vec3, bool) {
+	c := ob.viewProjection.TransformVec4(Vec4{v.X, v.Y, v.Z, 1.0})
+	if c.W <= Epsilon {
+		return Vec3{}, false
+	}
+	n := c.Homogenized()
+	return Vec3{
+		(n.X*0.5 + 0.5) * float32(ob.width),
+		(n.Y*0.5 + 0.5) * float32(ob.height),
+		n.Z*0.5 + 0.5}, true
+}
+
+func edgeFunction(a, b *Vec3, x, y float32) float32 {
+	return (b.X-a.X)*(y-a.Y) - (b.Y-a.Y)*(x-a.X)
+}
+
+// Largest value of edgeFunction in the pixel x, y
+func maxEdgeFunction(a, b *Vec3, x, y int) float32 {
+	px, py := float32(x), float32(y)
+	if b.X-a.X > 0 {
+		py++
+	}
+	if b.Y-a.Y < 0 {
+		px++
+	}
+	return edgeFunction(a, b, px, py)
+}
+
+// Smallest value of edgeFunction in the pixel x, y
+func minEdgeFunction(a, b *Vec3, x, y int) float32 {
+	px, py := float32(x), float32(y)
+	if b.X-a.X < 0 {
+		py++
+	}
+	if b.Y-a.Y > 0 {
+		px++
+	}
+	return edgeFunction(a, b, px, py)
+}
+
+// Range of pixels covering min to max, clamped to [0, n-1]
+func pixelRange(min, max float32, n int) (int, int) {
+	return int(Max(Floor(min), 0)), int(Min(Floor(max), float32(n-1)))
+}
+
+// Rasterizes a world space triangle, both sides are drawn. Triangles that
+// cross the near plane are skipped, this only makes the buffer less occluding.
+func (ob *OcclusionBuffer) RasterizeTriangle(a, b, c *Vec3) {
+	ob.RasterizeTriangles([]Vec3{*a, *b, *c}, []uint32{0, 1, 2})
+}
+
+// Rasterizes an indexed triangle list, both sides of the triangles are drawn.
+// The triangles touching a pixel are split into surfaces connected by shared
+// edges, an edge is shared by two triangles on opposite sides of it. A surface
+// whose other edges don't cross the pixel covers it completely and bounds its
+// depth with the largest depth of its triangles in the pixel. The pixel gets
+// the smallest bound, so surfaces behind others, like terrain behind a hill,
+// don't push it back.
+func (ob *OcclusionBuffer) RasterizeTriangles(vertices []Vec3, indices []uint32) {
+	if cap(ob.projected) < len(vertices) {
+		ob.projected = make([]Vec3, len(vertices))
+		ob.visible = make([]bool, len(vertices))
+	}
+	projected, visible := ob.projected[:len(vertices)], ob.visible[:len(vertices)]
+	for i := range vertices {
+		projected[i], visible[i] = ob.project(&vertices[i])
+	}
+
+	// counter clockwise triangles in front of the eye and their directed
+	// edges, edges used twice in the same direction are never shared
+	triangles := ob.triangles[:0]
+	edges := make(map[uint64]int)
+	for i := 0; i+2 < len(indices); i += 3 {
+		a, b, c := indices[i], indices[i+1], indices[i+2]
+		if !visible[a] || !visible[b] || !visible[c] {
+			continue
+		}
+		area := edgeFunction(&projected[a], &projected[b], projected[c].X, projected[c].Y)
+		if area == 0 {
+			continue
+		}
+		if area < 0 {
+			b, c = c, b
+		}
+		t := len(triangles) / 3
+		triangles = append(triangles, a, b, c)
+		for _, key := range [3]uint64{uint64(a)<<32 | uint64(b), uint64(b)<<32 | uint64(c), uint64(c)<<32 | uint64(a)} {
+			if _, ok := edges[key]; ok {
+				edges[key] = -1
+			} else {
+				edges[key] = t
+			}
+		}
+	}
+	ob.triangles = triangles
+	if len(triangles) == 0 {
+		return
+	}
+	if cap(ob.neighbours) < len(triangles) {
+		ob.neighbours = make([]int, len(triangles))
+		ob.surface = make([]int, len(triangles)/3)
+	}
+	neighbours, surface := ob.neighbours[:len(triangles)], ob.surface[:len(triangles)/3]
+	for i := range neighbours {
+		a, b := triangles[i], triangles[i-i%3+(i+1)%3]
+		neighbours[i] = -1
+		if t, ok := edges[uint64(b)<<32|uint64(a)]; ok && t >= 0 && edges[uint64(a)<<32|uint64(b)] >= 0 {
+			neighbours[i] = t
+		}
+	}
+	for i := range surface {
+		surface[i] = -1
+	}
+
+	// lists of the triangles touching each pixel
+	if cap(ob.first) < len(ob.depth) {
+		ob.first = make([]int, len(ob.depth))
+	}
+	first, entries := ob.first[:len(ob.depth)], ob.entries[:0]
+	for i := range first {
+		first[i] = -1
+	}
+	for t := 0; t < len(triangles)/3; t++ {
+		pa, pb, pc := ob.triangle(t)
+		x0, x1 := pixelRange(Min(pa.X, Min(pb.X, pc.X)), Max(pa.X, Max(pb.X, pc.X)), ob.width)
+		y0, y1 := pixelRange(Min(pa.Y, Min(pb.Y, pc.Y)), Max(pa.Y, Max(pb.Y, pc.Y)), ob.height)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				if maxEdgeFunction(pb, pc, x, y) >= 0 && maxEdgeFunction(pc, pa, x, y) >= 0 && maxEdgeFunction(pa, pb, x, y) >= 0 {
+					k := y*ob.width + x
+					entries = append(entries, occlusionEntry{t, first[k]})
+					first[k] = len(entries) - 1
+				}
+			}
+		}
+	}
+	ob.entries = entries
+
+	stack := ob.stack[:0]
+	for k, e := range first {
+		if e < 0 {
+			continue
+		}
+		x, y := k%ob.width, k/ob.width
+		for ; e >= 0; e = entries[e].next {
+			surface[entries[e].triangle] = -2
+		}
+		for e = first[k]; e >= 0; e = entries[e].next {
+			if surface[entries[e].triangle] != -2 {
+				continue
+			}
+			// flood fill the surface over the triangles touching the pixel
+			s := entries[e].triangle
+			surface[s] = s
+			stack = append(stack[:0], s)
+			var corners [4]bool
+			cut, z := false, float32(-MathMax)
+			for len(stack) > 0 {
+				t := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				tri := [3]*Vec3{}
+				tri[0], tri[1], tri[2] = ob.triangle(t)
+				iarea := 1.0 / edgeFunction(tri[0], tri[1], tri[2].X, tri[2].Y)
+				for i, corner := range [4][2]float32{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+					px, py := float32(x)+corner[0], float32(y)+corner[1]
+					w0, w1, w2 := edgeFunction(tri[1], tri[2], px, py), edgeFunction(tri[2], tri[0], px, py), edgeFunction(tri[0], tri[1], px, py)
+					if w0 >= 0 && w1 >= 0 && w2 >= 0 {
+						corners[i] = true
+					}
+					// screen space depth is affine, its maximum is at a corner
+					z = Max(z, (w0*tri[0].Z+w1*tri[1].Z+w2*tri[2].Z)*iarea)
+				}
+				for j := 0; j < 3; j++ {
+					u := neighbours[3*t+j]
+					if u < 0 {
+						// edges along the border of a pixel don't cut it
+						a, b := tri[j], tri[(j+1)%3]
+						if minEdgeFunction(a, b, x, y) < 0 && maxEdgeFunction(a, b, x, y) > 0 &&
+							Min(a.X, b.X) < float32(x+1) && Max(a.X, b.X) > float32(x) &&
+							Min(a.Y, b.Y) < float32(y+1) && Max(a.Y, b.Y) > float32(y) {
+							cut = true
+						}
+					} else if surface[u] == -2 {
+						surface[u] = s
+						stack = append(stack, u)
+					}
+				}
+			}
+			if !cut && corners[0] && corners[1] && corners[2] && corners[3] && z >= 0 && z < ob.depth[k] {
+				ob.depth[k] = z
+			}
+		}
+		for e = first[k]; e >= 0; e = entries[e].next {
+			surface[entries[e].triangle] = -1
+		}
+	}
+	ob.stack = stack
+}
+
+// Screen space vertices of triangle t of the last RasterizeTriangles call
+func (ob *OcclusionBuffer) triangle(t int) (a, b, c *Vec3) {
+	return &ob.projected[ob.triangles[3*t]], &ob.projected[ob.triangles[3*t+1]], &ob.projected[ob.triangles[3*t+2]]
+}
+
+// Returns false if the box is completely hidden by the rasterized occluders.
+func (ob *OcclusionBuffer) TestBoundingBox(bbox *BoundingBox) bool {
+	minX, minY, minZ := float32(MathMax), float32(MathMax), float32(MathMax)
+	maxX, maxY := float32(-MathMax), float32(-MathMax)
+	for i := 0; i < 8; i++ {
+		v := bbox.Min
+		if i&1 != 0 {
+			v.X = bbox.Max.X
+		}
+		if i&2 != 0 {
+			v.Y = bbox.Max.Y
+		}
+		if i&4 != 0 {
+			v.Z = bbox.Max.Z
+		}
+		p, ok := ob.project(&v)
+		if !ok {
+			// box reaches behind the eye
+			return true
+		}
+		minX, maxX = Min(minX, p.X), Max(maxX, p.X)
+		minY, maxY = Min(minY, p.Y), Max(maxY, p.Y)
+		minZ = Min(minZ, p.Z)
+	}
+	if minZ < 0.0 {
+		return true
+	}
+
+	// every pixel the box touches
+	x0, x1 := pixelRange(minX, maxX, ob.width)
+	y0, y1 := pixelRange(minY, maxY, ob.height)
+	if x0 > x1 || y0 > y1 {
+		// off screen, the frustum test decides
+		return true
+	}
+	for y := y0; y <= y1; y++ {
+		row := ob.depth[y*ob.width : (y+1)*ob.width]
+		for x := x0; x <= x1; x++ {
+			if row[x] >= minZ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Volumes other than boxes are tested by their enclosing box.
+func (ob *OcclusionBuffer) TestBoundingVolume(bvol BoundingVolume) bool {
+	switch v := bvol.(type) {
+	case nil:
+		return true
+	case *BoundingBox:
+		return ob.TestBoundingBox(v)
+	}
+	bbox := bvol.CalculateBoundingBox()
+	return ob.TestBoundingBox(&bbox)
+}
+
+// Wraps traverseFunc so hidden elements (and their subtrees) are skipped.
+// Works with any spatial tree, e.g.
+//
+//	root.TraverseFrustum(frustum, ob.CullFunc(drawFunc))
+func (ob *OcclusionBuffer) CullFunc(traverseFunc TraverseFunc) TraverseFunc {
+	return func(element SpatElement, leaf bool) bool {
+		if bvol := element.GetBoundingVolume(); bvol != nil && !ob.TestBoundingVolume(bvol) {
+			return false
+		}
+		return traverseFunc(element, leaf)
+	}
+}
@@ -0,0 +1,115 @@
+package g3
+
+import (
+	"testing"
+)
+
+// 128x128 buffer, world x, y are pixels and the depth is -z / 10
+func makeTestOcclusionBuffer() *OcclusionBuffer {
+	ob := NewOcclusionBuffer(128, 128)
+	m := MakeOrthographicMatrix(0, 128, 0, 128, 0, 10)
+	ob.Clear(&m)
+	return ob
+}
+
+// Square from min to max in the xy plane as two triangles, z at min.X and max.X
+func testQuad(min, max Vec2, z0, z1 float32) ([]Vec3, []uint32) {
+	vertices := []Vec3{{min.X, min.Y, z0}, {max.X, min.Y, z1}, {min.X, max.Y, z0}, {max.X, max.Y, z1}}
+	return vertices, []uint32{0, 1, 2, 1, 3, 2}
+}
+
+func testBox(minX, minY, maxX, maxY, minZ, maxZ float32) *BoundingBox {
+	return &BoundingBox{Vec3{minX, minY, minZ}, Vec3{maxX, maxY, maxZ}}
+}
+
+func TestOcclusionBuffer(t *testing.T) {
+	ob := makeTestOcclusionBuffer()
+	vertices, indices := testQuad(Vec2{20, 20}, Vec2{60.6, 60}, -5, -5)
+	ob.RasterizeTriangles(vertices, indices)
+	if !ApproxEqual(ob.Depth(30, 30), 0.5) || ob.Depth(60, 30) != 1 || ob.Depth(19, 30) != 1 {
+		t.Errorf("depths %f %f %f", ob.Depth(30, 30), ob.Depth(60, 30), ob.Depth(19, 30))
+	}
+	// pixels on the diagonal are covered by both triangles together
+	for i := 20; i < 60; i++ {
+		if ob.Depth(i, 79-i) == 1 {
+			t.Fatalf("pixel %d,%d on the shared edge not covered", i, 79-i)
+		}
+	}
+
+	tests := []struct {
+		bbox    *BoundingBox
+		visible bool
+	}{
+		{testBox(30, 30, 50, 50, -8, -6), false},
+		{testBox(20, 20, 59.9, 59.9, -8, -6), false},
+		{testBox(30, 30, 50, 50, -4, -3), true},
+		// in front of the occluder at one end
+		{testBox(30, 30, 50, 50, -8, -4), true},
+		// a fraction of a pixel past the edge
+		{testBox(40, 30, 60.8, 50, -8, -6), true},
+		{testBox(19.8, 30, 40, 50, -8, -6), true},
+		// behind the eye
+		{testBox(30, 30, 50, 50, -8, 1), true},
+		// off screen, left to the frustum test
+		{testBox(140, 30, 160, 50, -8, -6), true},
+	}
+	for i, test := range tests {
+		if ob.TestBoundingBox(test.bbox) != test.visible {
+			t.Errorf("box %d: visible is %v", i, !test.visible)
+		}
+	}
+	sphere := BoundingSphere{Vec3{40, 40, -7}, 1}
+	if ob.TestBoundingVolume(&sphere) {
+		t.Error("sphere behind the occluder visible")
+	}
+}
+
+func TestConservativeOcclusion(t *testing.T) {
+	// depth rises by 0.015 per pixel, a pixel may be farther than at its center
+	ob := makeTestOcclusionBuffer()
+	vertices, indices := testQuad(Vec2{20, 20}, Vec2{60, 60}, -2, -8)
+	ob.RasterizeTriangles(vertices, indices)
+	if d := ob.Depth(40, 30); !ApproxEqual(d, 0.2+0.015*21) {
+		t.Errorf("depth %f, expected the largest depth of the pixel", d)
+	}
+	if !ob.TestBoundingBox(testBox(40.1, 30.1, 40.9, 30.9, -5.15, -5.1)) {
+		t.Error("box in front of a part of its pixel hidden")
+	}
+	if ob.TestBoundingBox(testBox(40.1, 30.1, 40.9, 30.9, -5.2, -5.16)) {
+		t.Error("box behind the whole pixel visible")
+	}
+
+	// separate triangles don't close their shared edge, only meshes do
+	ob.Clear(&ob.viewProjection)
+	vertices, _ = testQuad(Vec2{20, 20}, Vec2{60, 60}, -5, -5)
+	ob.RasterizeTriangle(&vertices[0], &vertices[1], &vertices[2])
+	ob.RasterizeTriangle(&vertices[1], &vertices[3], &vertices[2])
+	if ob.Depth(40, 39) != 1 || !ApproxEqual(ob.Depth(25, 30), 0.5) {
+		t.Errorf("depths %f %f", ob.Depth(40, 39), ob.Depth(25, 30))
+	}
+	if !ob.TestBoundingBox(testBox(30, 30, 50, 50, -8, -6)) {
+		t.Error("box behind the open edge hidden")
+	}
+}
+
+func TestCullFunc(t *testing.T) {
+	ob := makeTestOcclusionBuffer()
+	vertices, indices := testQuad(Vec2{0, 0}, Vec2{50, 128}, -5, -5)
+	ob.RasterizeTriangles(vertices, indices)
+	hidden := BoundingBox{Vec3{10, 10, -9}, Vec3{40, 90, -8}}
+	shown := BoundingBox{Vec3{60, 10, -9}, Vec3{90, 90, -8}}
+	root := &SpatNode{SpatElementData{BVolume: &BoundingBox{Vec3{10, 10, -9}, Vec3{90, 90, -8}}}, nil}
+	root.Children = []SpatElement{
+		&SpatLeaf{SpatElementData{BVolume: &hidden, Parent: root}},
+		&SpatLeaf{SpatElementData{BVolume: &shown, Parent: root}}}
+	var drawn []SpatElement
+	TraverseDepthFirst(root, ob.CullFunc(func(element SpatElement, leaf bool) bool {
+		if leaf {
+			drawn = append(drawn, element)
+		}
+		return true
+	}))
+	if len(drawn) != 1 || drawn[0] != root.Children[1] {
+		t.Errorf("%d leaves drawn", len(drawn))
+	}
+}
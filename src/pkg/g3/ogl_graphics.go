@@ -131,7 +131,7 @@ func (gd *openGLGraphicsDevice) SetShader(shader Shader) {
 func (gd *openGLGraphicsDevice) SetTexCoords(buffer VertexBuffer, index uint) {
 	glbuffer := buffer.(*openGLVertexBuffer)
 	gl.EnableClientState(gl.TEXTURE_COORD_ARRAY) // TODO: DisableClientState
-	gl.TexCoordPointer(2, 3*4, &glbuffer.vertices2[0].X)
+	gl.TexCoordPointer(2, 2*4, &glbuffer.vertices2[0].X)
 }
 
 func (gd *openGLGraphicsDevice) SetNormals(buffer VertexBuffer) {
@@ -175,6 +175,11 @@ func (p *openGLShader) SetVec3(location uint, v *Vec3) {
 	gl.UniformLocation(location).Uniform3f(v.X, v.Y, v.Z)
 }
 
+func (p *openGLShader) SetFloat(location uint, v float32) {
+	p.program.Use()
+	gl.UniformLocation(location).Uniform1f(v)
+}
+
 func (p *openGLShader) SetTexture(location uint, unit uint) {
 	p.program.Use();
 	gl.UniformLocation(location).Uniform1i(int(unit))
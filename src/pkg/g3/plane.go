@@ -14,3 +14,16 @@ func (p *Plane) Normalize() {
 func (p *Plane) DistanceToPoint(v *Vec3) float32 {
 	return p.Normal.Dot(*v) + p.Distance
 }
+
+// Point shared by three planes. Returns false if two of the planes are parallel.
+func IntersectPlanes(a, b, c *Plane) (Vec3, bool) {
+	bc := b.Normal.Cross(c.Normal)
+	denom := a.Normal.Dot(bc)
+	if ApproxZero(denom) {
+		return Vec3{}, false
+	}
+	ca := c.Normal.Cross(a.Normal)
+	ab := a.Normal.Cross(b.Normal)
+	p := bc.Scaled(-a.Distance).Add(ca.Scaled(-b.Distance)).Add(ab.Scaled(-c.Distance))
+	return p.Scaled(1.0 / denom), true
+}
@@ -0,0 +1,170 @@
+package g3
+
+import (
+	"fmt"
+)
+
+// Represents a rotation as a unit quaternion (X, Y, Z is the vector part)
+type Quaternion struct {
+	X, Y, Z, W float32
+}
+
+func MakeIdentityQuaternion() Quaternion {
+	return Quaternion{0.0, 0.0, 0.0, 1.0}
+}
+
+// Rotation of angle radians around axis (axis need not be normalized)
+func MakeQuaternionFromAxisAngle(axis Vec3, angle float32) Quaternion {
+	a := axis.Normalized()
+	s := Sin(angle / 2.0)
+	return Quaternion{a.X * s, a.Y * s, a.Z * s, Cos(angle / 2.0)}
+}
+
+// Same rotation as MakeZRotationMatrix(z) * MakeYRotationMatrix(y) * MakeXRotationMatrix(x),
+// i.e. rotate around x first, then y, then z.
+func MakeQuaternionFromEuler(x, y, z float32) Quaternion {
+	cx, sx := Cos(x/2.0), Sin(x/2.0)
+	cy, sy := Cos(y/2.0), Sin(y/2.0)
+	cz, sz := Cos(z/2.0), Sin(z/2.0)
+	return Quaternion{
+		sx*cy*cz - cx*sy*sz,
+		cx*sy*cz + sx*cy*sz,
+		cx*cy*sz - sx*sy*cz,
+		cx*cy*cz + sx*sy*sz}
+}
+
+// Extracts the rotation from the upper 3x3 part of m (must not contain scale)
+func MakeQuaternionFromMatrix(m *Matrix4x4) Quaternion {
+	var q Quaternion
+	trace := m.M11 + m.M22 + m.M33
+	switch {
+	case trace > 0.0:
+		s := 0.5 / Sqrt(trace+1.0)
+		q = Quaternion{(m.M32 - m.M23) * s, (m.M13 - m.M31) * s, (m.M21 - m.M12) * s, 0.25 / s}
+	case m.M11 > m.M22 && m.M11 > m.M33:
+		s := 2.0 * Sqrt(1.0+m.M11-m.M22-m.M33)
+		q = Quaternion{0.25 * s, (m.M12 + m.M21) / s, (m.M13 + m.M31) / s, (m.M32 - m.M23) / s}
+	case m.M22 > m.M33:
+		s := 2.0 * Sqrt(1.0+m.M22-m.M11-m.M33)
+		q = Quaternion{(m.M12 + m.M21) / s, 0.25 * s, (m.M23 + m.M32) / s, (m.M13 - m.M31) / s}
+	default:
+		s := 2.0 * Sqrt(1.0+m.M33-m.M11-m.M22)
+		q = Quaternion{(m.M13 + m.M31) / s, (m.M23 + m.M32) / s, 0.25 * s, (m.M21 - m.M12) / s}
+	}
+	q.Normalize()
+	return q
+}
+
+func MakeMatrixFromQuaternion(q Quaternion) Matrix4x4 {
+	xx, yy, zz := q.X*q.X, q.Y*q.Y, q.Z*q.Z
+	xy, xz, yz := q.X*q.Y, q.X*q.Z, q.Y*q.Z
+	wx, wy, wz := q.W*q.X, q.W*q.Y, q.W*q.Z
+	return Matrix4x4{
+		1.0 - 2.0*(yy+zz), 2.0 * (xy - wz), 2.0 * (xz + wy), 0.0,
+		2.0 * (xy + wz), 1.0 - 2.0*(xx+zz), 2.0 * (yz - wx), 0.0,
+		2.0 * (xz - wy), 2.0 * (yz + wx), 1.0 - 2.0*(xx+yy), 0.0,
+		0.0, 0.0, 0.0, 1.0}
+}
+
+// Hamilton product; the result rotates by r first, then by q.
+func (q Quaternion) Multiply(r Quaternion) Quaternion {
+	return Quaternion{
+		q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+		q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z}
+}
+
+func (q Quaternion) Dot(r Quaternion) float32 {
+	return q.X*r.X + q.Y*r.Y + q.Z*r.Z + q.W*r.W
+}
+
+func (q Quaternion) Conjugated() Quaternion {
+	return Quaternion{-q.X, -q.Y, -q.Z, q.W}
+}
+
+func (q Quaternion) Inverted() Quaternion {
+	l := 1.0 / q.LengthSq()
+	return Quaternion{-q.X * l, -q.Y * l, -q.Z * l, q.W * l}
+}
+
+func (q Quaternion) Normalized() Quaternion {
+	l := 1.0 / q.Length()
+	return Quaternion{q.X * l, q.Y * l, q.Z * l, q.W * l}
+}
+
+func (q *Quaternion) Normalize() {
+	l := 1.0 / q.Length()
+	q.X *= l
+	q.Y *= l
+	q.Z *= l
+	q.W *= l
+}
+
+func (q *Quaternion) LengthSq() float32 {
+	return q.X*q.X + q.Y*q.Y + q.Z*q.Z + q.W*q.W
+}
+
+func (q *Quaternion) Length() float32 {
+	return Sqrt(q.LengthSq())
+}
+
+// Returns the rotation axis and angle in radians
+func (q Quaternion) AxisAngle() (axis Vec3, angle float32) {
+	n := q.Normalized()
+	if n.W < 0.0 {
+		n = Quaternion{-n.X, -n.Y, -n.Z, -n.W}
+	}
+	s := Sqrt(1.0 - n.W*n.W)
+	if s < 1e-6 {
+		return Vec3{1.0, 0.0, 0.0}, 0.0
+	}
+	return Vec3{n.X / s, n.Y / s, n.Z / s}, 2.0 * Acos(Clamp(n.W, -1.0, 1.0))
+}
+
+// Rotates v by the (unit) quaternion q
+func (q Quaternion) Rotate(v Vec3) Vec3 {
+	u := Vec3{q.X, q.Y, q.Z}
+	t := u.Cross(v).Scaled(2.0)
+	return v.Add(t.Scaled(q.W)).Add(u.Cross(t))
+}
+
+// Normalized linear interpolation, takes the shortest path
+func Nlerp(a, b Quaternion, t float32) Quaternion {
+	if a.Dot(b) < 0.0 {
+		b = Quaternion{-b.X, -b.Y, -b.Z, -b.W}
+	}
+	q := Quaternion{
+		a.X + (b.X-a.X)*t,
+		a.Y + (b.Y-a.Y)*t,
+		a.Z + (b.Z-a.Z)*t,
+		a.W + (b.W-a.W)*t}
+	q.Normalize()
+	return q
+}
+
+// Spherical linear interpolation, takes the shortest path
+func Slerp(a, b Quaternion, t float32) Quaternion {
+	cosTheta := a.Dot(b)
+	if cosTheta < 0.0 {
+		b = Quaternion{-b.X, -b.Y, -b.Z, -b.W}
+		cosTheta = -cosTheta
+	}
+	// nearly parallel, sin(theta) gets too small
+	if cosTheta > 0.9995 {
+		return Nlerp(a, b, t)
+	}
+	theta := Acos(cosTheta)
+	sinTheta := Sin(theta)
+	wa := Sin((1.0-t)*theta) / sinTheta
+	wb := Sin(t*theta) / sinTheta
+	return Quaternion{
+		a.X*wa + b.X*wb,
+		a.Y*wa + b.Y*wb,
+		a.Z*wa + b.Z*wb,
+		a.W*wa + b.W*wb}
+}
+
+func (q *Quaternion) String() string {
+	return fmt.Sprintf("(%f %f %f | %f)", q.X, q.Y, q.Z, q.W)
+}
@@ -0,0 +1,183 @@
+package g3
+
+import (
+	"testing"
+)
+
+// q and -q are the same rotation
+func approxEqualRotation(q, r Quaternion) bool {
+	d := Abs(q.Dot(r))
+	return ApproxEqualEps(d, 1, 1e-5)
+}
+
+func approxEqualMatrix(a, b *Matrix4x4, eps float32) bool {
+	fa := [16]float32{a.M11, a.M12, a.M13, a.M14, a.M21, a.M22, a.M23, a.M24,
+		a.M31, a.M32, a.M33, a.M34, a.M41, a.M42, a.M43, a.M44}
+	fb := [16]float32{b.M11, b.M12, b.M13, b.M14, b.M21, b.M22, b.M23, b.M24,
+		b.M31, b.M32, b.M33, b.M34, b.M41, b.M42, b.M43, b.M44}
+	for i := range fa {
+		if !ApproxEqualEps(fa[i], fb[i], eps) {
+			return false
+		}
+	}
+	return true
+}
+
+var testRotations = []struct {
+	axis  Vec3
+	angle float32
+}{
+	{Vec3{1, 0, 0}, 0.3},
+	{Vec3{0, 2, 0}, -1.2},
+	{Vec3{0, 0, 1}, 2.5},
+	{Vec3{1, 1, 1}, 1},
+	{Vec3{-1, 2, 0.5}, 3},
+	// half turns, each takes a different branch of MakeQuaternionFromMatrix
+	{Vec3{1, 0, 0}, Pi},
+	{Vec3{0, 1, 0}, Pi},
+	{Vec3{0, 0, 1}, Pi},
+}
+
+func TestQuaternionAxisAngle(t *testing.T) {
+	for i, test := range testRotations {
+		q := MakeQuaternionFromAxisAngle(test.axis, test.angle)
+		if !ApproxEqualEps(q.Length(), 1, 1e-5) {
+			t.Errorf("%d: length %f", i, q.Length())
+		}
+		axis, angle := q.AxisAngle()
+		wantAxis, wantAngle := test.axis.Normalized(), test.angle
+		if wantAngle < 0 {
+			wantAxis, wantAngle = wantAxis.Inverted(), -wantAngle
+		}
+		// a half turn around -axis is the same rotation
+		if ApproxEqualEps(wantAngle, Pi, 1e-4) && axis.Dot(wantAxis) < 0 {
+			wantAxis = wantAxis.Inverted()
+		}
+		if !axis.ApproxEqualEps(wantAxis, 1e-4) || !ApproxEqualEps(angle, wantAngle, 1e-4) {
+			t.Errorf("%d: axis %v angle %f, want %v %f", i, axis, angle, wantAxis, wantAngle)
+		}
+
+		// the matrix rotates the same way and converts back
+		m := MakeMatrixFromQuaternion(q)
+		if r := MakeQuaternionFromMatrix(&m); !approxEqualRotation(r, q) {
+			t.Errorf("%d: from matrix %v, want %v", i, r.String(), q.String())
+		}
+		v := Vec3{0.5, -2, 3}
+		if r, want := q.Rotate(v), m.Transform(v); !r.ApproxEqualEps(want, 1e-5) {
+			t.Errorf("%d: rotated %v, want %v", i, r, want)
+		}
+		// the axis is left alone
+		if r := q.Rotate(test.axis); !r.ApproxEqualEps(test.axis, 1e-5) {
+			t.Errorf("%d: axis rotated to %v", i, r)
+		}
+	}
+
+	if axis, angle := MakeIdentityQuaternion().AxisAngle(); angle != 0 || !axis.ApproxEqual(Vec3{1, 0, 0}) {
+		t.Errorf("identity axis %v angle %f", axis, angle)
+	}
+}
+
+func TestQuaternionEuler(t *testing.T) {
+	tests := []struct{ x, y, z float32 }{
+		{0, 0, 0},
+		{0.5, 0, 0},
+		{0, -0.7, 0},
+		{0, 0, 2},
+		{0.3, 0.4, 0.5},
+		// gimbal lock in the matrix form, still a valid rotation
+		{1, Pi / 2, -0.5},
+	}
+	for i, test := range tests {
+		q := MakeQuaternionFromEuler(test.x, test.y, test.z)
+		mx, my, mz := MakeXRotationMatrix(test.x), MakeYRotationMatrix(test.y), MakeZRotationMatrix(test.z)
+		m := mz.Multiply(&my)
+		m = m.Multiply(&mx)
+		qm := MakeMatrixFromQuaternion(q)
+		if !approxEqualMatrix(&qm, &m, 1e-5) {
+			t.Errorf("%d: matrix\n%v\nwant\n%v", i, qm.String(), m.String())
+		}
+	}
+}
+
+func TestQuaternionAlgebra(t *testing.T) {
+	q := MakeQuaternionFromAxisAngle(Vec3{1, 2, 3}, 0.8)
+	r := MakeQuaternionFromAxisAngle(Vec3{0, -1, 1}, 2.1)
+	v := Vec3{1, -1, 2}
+
+	// r first, then q
+	if a, b := q.Multiply(r).Rotate(v), q.Rotate(r.Rotate(v)); !a.ApproxEqualEps(b, 1e-5) {
+		t.Errorf("composed %v, want %v", a, b)
+	}
+	mq, mr := MakeMatrixFromQuaternion(q), MakeMatrixFromQuaternion(r)
+	m := mq.Multiply(&mr)
+	qm := MakeMatrixFromQuaternion(q.Multiply(r))
+	if !approxEqualMatrix(&qm, &m, 1e-5) {
+		t.Errorf("product matrix\n%v\nwant\n%v", qm.String(), m.String())
+	}
+
+	identity := MakeIdentityQuaternion()
+	if p := q.Multiply(q.Conjugated()); !approxEqualRotation(p, identity) {
+		t.Errorf("q * conjugate = %v", p.String())
+	}
+	// the inverse also undoes non unit quaternions
+	s := Quaternion{q.X * 3, q.Y * 3, q.Z * 3, q.W * 3}
+	if p := s.Multiply(s.Inverted()); !ApproxEqualEps(p.W, 1, 1e-5) || !(Vec3{p.X, p.Y, p.Z}).ApproxEqualEps(Vec3{}, 1e-5) {
+		t.Errorf("q * inverse = %v", p.String())
+	}
+	if n := s.Normalized(); !ApproxEqualEps(n.Length(), 1, 1e-6) || !approxEqualRotation(n, q) {
+		t.Errorf("normalized %v", n.String())
+	}
+	if a := q.Rotate(q.Inverted().Rotate(v)); !a.ApproxEqualEps(v, 1e-5) {
+		t.Errorf("rotate back %v", a)
+	}
+}
+
+func TestSlerp(t *testing.T) {
+	a := MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, 0.2)
+	b := MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, 1.8)
+	negB := Quaternion{-b.X, -b.Y, -b.Z, -b.W}
+	near := MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, 0.201)
+	tests := []struct {
+		name  string
+		a, b  Quaternion
+		t     float32
+		angle float32
+	}{
+		{"start", a, b, 0, 0.2},
+		{"end", a, b, 1, 1.8},
+		{"half", a, b, 0.5, 1},
+		{"quarter", a, b, 0.25, 0.6},
+		// -b is the same rotation, the shorter arc is still taken
+		{"negated end", a, negB, 1, 1.8},
+		{"negated half", a, negB, 0.5, 1},
+		{"nearly parallel", a, near, 0.5, 0.2005},
+		{"same", b, b, 0.3, 1.8},
+	}
+	for _, test := range tests {
+		q := Slerp(test.a, test.b, test.t)
+		want := MakeQuaternionFromAxisAngle(Vec3{0, 0, 1}, test.angle)
+		if !ApproxEqualEps(q.Length(), 1, 1e-5) || !approxEqualRotation(q, want) {
+			t.Errorf("%s: %v, want %v", test.name, q.String(), want.String())
+		}
+	}
+
+	// the end points are exact up to sign for nlerp too
+	for _, end := range []float32{0, 1} {
+		q := Nlerp(a, negB, end)
+		want := a
+		if end == 1 {
+			want = b
+		}
+		if !approxEqualRotation(q, want) {
+			t.Errorf("nlerp %f: %v, want %v", end, q.String(), want.String())
+		}
+	}
+	// constant angular velocity, unlike nlerp
+	wide := MakeQuaternionFromAxisAngle(Vec3{1, 0, 0}, 3)
+	identity := MakeIdentityQuaternion()
+	for _, step := range []float32{0.1, 0.3, 0.7} {
+		if _, angle := Slerp(identity, wide, step).AxisAngle(); !ApproxEqualEps(angle, 3*step, 1e-4) {
+			t.Errorf("slerp %f: angle %f, want %f", step, angle, 3*step)
+		}
+	}
+}
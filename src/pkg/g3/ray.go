@@ -1,10 +1,234 @@
 package g3
 
+import (
+	"math"
+)
+
 type Ray3 struct {
 	Pos Vec3
 	Dir Vec3
 }
 
-func (ray *Ray3) NewPos(t float, d Vec3) Ray3 {
+// Result of a ray query. Distance is the ray parameter of the hit,
+// i.e. the world space distance if Dir is normalized.
+type RayHit struct {
+	Distance float32
+	Point    Vec3
+	Normal   Vec3
+}
+
+// Implemented by bounding volumes that can be tested against a ray
+type RayIntersector interface {
+	IntersectRay(ray *Ray3) (RayHit, bool)
+}
+
+// Exact test for the data stored in a leaf of a spatial tree
+type RayHitFunc func(element SpatElement, ray *Ray3) (RayHit, bool)
+
+type RayCastable interface {
+	CastRay(ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool)
+}
+
+func (ray *Ray3) NewPos(t float32, d Vec3) Ray3 {
 	return Ray3{Pos: ray.Pos.Add(ray.Dir.Mul(t)), Dir: d}
 }
+
+func (ray *Ray3) PointAt(t float32) Vec3 {
+	return ray.Pos.Add(ray.Dir.Mul(t))
+}
+
+// Hits the plane from either side, the normal is the plane normal.
+func (ray *Ray3) IntersectPlane(p *Plane) (RayHit, bool) {
+	denom := p.Normal.Dot(ray.Dir)
+	// exact, a nearly parallel ray still hits far away
+	if denom == 0.0 {
+		return RayHit{}, false
+	}
+	t := -p.DistanceToPoint(&ray.Pos) / denom
+	if t < 0.0 {
+		return RayHit{}, false
+	}
+	return RayHit{t, ray.PointAt(t), p.Normal}, true
+}
+
+// Slab test. If the ray starts inside the box the exit point is returned.
+func (ray *Ray3) IntersectBoundingBox(bbox *BoundingBox) (RayHit, bool) {
+	pos := [3]float32{ray.Pos.X, ray.Pos.Y, ray.Pos.Z}
+	dir := [3]float32{ray.Dir.X, ray.Dir.Y, ray.Dir.Z}
+	min := [3]float32{bbox.Min.X, bbox.Min.Y, bbox.Min.Z}
+	max := [3]float32{bbox.Max.X, bbox.Max.Y, bbox.Max.Z}
+
+	tnear, tfar := float32(math.Inf(-1)), float32(math.Inf(1))
+	nearAxis, farAxis := -1, -1
+	var nearSign, farSign float32
+	for i := 0; i < 3; i++ {
+		// Tiny components can overflow t to infinity, the axis is still
+		// recorded so the hit always has a face.
+		if dir[i] == 0.0 {
+			if pos[i] < min[i] || pos[i] > max[i] {
+				return RayHit{}, false
+			}
+			continue
+		}
+		t1 := (min[i] - pos[i]) / dir[i]
+		t2 := (max[i] - pos[i]) / dir[i]
+		// the entry face normal points against the ray
+		s := float32(-1.0)
+		if t1 > t2 {
+			t1, t2 = t2, t1
+			s = 1.0
+		}
+		if t1 > tnear || nearAxis < 0 {
+			tnear, nearAxis, nearSign = t1, i, s
+		}
+		if t2 < tfar || farAxis < 0 {
+			tfar, farAxis, farSign = t2, i, -s
+		}
+		if tnear > tfar || tfar < 0.0 {
+			return RayHit{}, false
+		}
+	}
+	if nearAxis < 0 && farAxis < 0 {
+		// degenerate direction
+		return RayHit{}, false
+	}
+
+	t, axis, sign := tnear, nearAxis, nearSign
+	if tnear < 0.0 {
+		t, axis, sign = tfar, farAxis, farSign
+	}
+	if t > MathMax {
+		// the face is beyond float range
+		t = MathMax
+	}
+	var n [3]float32
+	n[axis] = sign
+	return RayHit{t, ray.PointAt(t), Vec3{n[0], n[1], n[2]}}, true
+}
+
+// If the ray starts inside the sphere the exit point is returned.
+func (ray *Ray3) IntersectBoundingSphere(sphere *BoundingSphere) (RayHit, bool) {
+	m := ray.Pos.Sub(sphere.Position)
+	a := ray.Dir.Dot(ray.Dir)
+	b := m.Dot(ray.Dir)
+	c := m.Dot(m) - sphere.Radius*sphere.Radius
+	if a == 0.0 || (c > 0.0 && b > 0.0) {
+		return RayHit{}, false
+	}
+	disc := b*b - a*c
+	if disc < 0.0 {
+		return RayHit{}, false
+	}
+	sq := Sqrt(disc)
+	t := (-b - sq) / a
+	if t < 0.0 {
+		t = (-b + sq) / a
+	}
+	p := ray.PointAt(t)
+	n := p.Sub(sphere.Position)
+	if sphere.Radius > 0.0 {
+		n.Scale(1.0 / sphere.Radius)
+	}
+	return RayHit{t, p, n}, true
+}
+
+// Möller–Trumbore, hits both sides. The normal follows the
+// counter-clockwise winding of a, b, c.
+func (ray *Ray3) IntersectTriangle(a, b, c *Vec3) (RayHit, bool) {
+	e1 := b.Sub(*a)
+	e2 := c.Sub(*a)
+	p := ray.Dir.Cross(e2)
+	det := e1.Dot(p)
+	// det is the triple product of the direction and the edges, relative to
+	// their lengths the parallel and degenerate test doesn't depend on scale
+	if Abs(det) <= Epsilon*Sqrt(ray.Dir.LengthSq()*e1.LengthSq()*e2.LengthSq()) {
+		return RayHit{}, false
+	}
+	idet := 1.0 / det
+	s := ray.Pos.Sub(*a)
+	u := s.Dot(p) * idet
+	if u < 0.0 || u > 1.0 {
+		return RayHit{}, false
+	}
+	q := s.Cross(e1)
+	v := ray.Dir.Dot(q) * idet
+	if v < 0.0 || u+v > 1.0 {
+		return RayHit{}, false
+	}
+	t := e2.Dot(q) * idet
+	if t < 0.0 {
+		return RayHit{}, false
+	}
+	return RayHit{t, ray.PointAt(t), e1.Cross(e2).Normalized()}, true
+}
+
+// distance at which the ray enters bvol, volumes that can't be tested are always entered
+func rayEntryDistance(ray *Ray3, bvol BoundingVolume) (float32, bool) {
+	if bvol == nil {
+		return 0.0, true
+	}
+	ri, ok := bvol.(RayIntersector)
+	if !ok || bvol.ClassifyPoint(&ray.Pos) {
+		return 0.0, true
+	}
+	hit, ok := ri.IntersectRay(ray)
+	return hit.Distance, ok
+}
+
+type rayCastCandidate struct {
+	element SpatElement
+	entry   float32
+}
+
+func rayCastRec(element SpatElement, ray *Ray3, hitFunc RayHitFunc, best *RayHit, bestElement *SpatElement) {
+	children := element.GetChildren()
+	if len(children) == 0 {
+		var hit RayHit
+		var ok bool
+		if hitFunc != nil {
+			hit, ok = hitFunc(element, ray)
+		} else if ri, isRi := element.GetBoundingVolume().(RayIntersector); isRi {
+			hit, ok = ri.IntersectRay(ray)
+		}
+		if ok && hit.Distance < best.Distance {
+			*best = hit
+			*bestElement = element
+		}
+		return
+	}
+
+	// visit children front to back, so far away subtrees can be skipped
+	candidates := make([]rayCastCandidate, 0, len(children))
+	for _, child := range children {
+		entry, ok := rayEntryDistance(ray, child.GetBoundingVolume())
+		if !ok {
+			continue
+		}
+		i := len(candidates)
+		candidates = append(candidates, rayCastCandidate{child, entry})
+		for ; i > 0 && candidates[i-1].entry > entry; i-- {
+			candidates[i], candidates[i-1] = candidates[i-1], candidates[i]
+		}
+	}
+	for _, c := range candidates {
+		if c.entry > best.Distance {
+			break
+		}
+		rayCastRec(c.element, ray, hitFunc, best, bestElement)
+	}
+}
+
+// Finds the nearest hit in the tree below root. hitFunc does the exact
+// test for leaves, if it is nil the leaf bounding volumes are used.
+func RayCast(root SpatElement, ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool) {
+	if _, ok := rayEntryDistance(ray, root.GetBoundingVolume()); !ok {
+		return nil, RayHit{}, false
+	}
+	best := RayHit{Distance: MathMax}
+	var bestElement SpatElement
+	rayCastRec(root, ray, hitFunc, &best, &bestElement)
+	if bestElement == nil {
+		return nil, RayHit{}, false
+	}
+	return bestElement, best, true
+}
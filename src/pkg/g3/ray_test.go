@@ -0,0 +1,195 @@
+package g3
+
+import (
+	"testing"
+)
+
+type rayTest struct {
+	name   string
+	ray    Ray3
+	hit    bool
+	t      float32
+	normal Vec3
+}
+
+func checkRayHit(t *testing.T, test rayTest, hit RayHit, ok bool) {
+	if ok != test.hit {
+		t.Errorf("%s: hit %v, want %v", test.name, ok, test.hit)
+		return
+	}
+	if !ok {
+		return
+	}
+	if !ApproxEqual(hit.Distance, test.t) || !hit.Normal.ApproxEqual(test.normal) {
+		t.Errorf("%s: distance %f normal %v, want %f %v", test.name, hit.Distance, hit.Normal, test.t, test.normal)
+	}
+	if p := test.ray.PointAt(hit.Distance); !hit.Point.ApproxEqual(p) {
+		t.Errorf("%s: point %v, want %v", test.name, hit.Point, p)
+	}
+}
+
+func TestIntersectPlane(t *testing.T) {
+	plane := Plane{Vec3{0, 0, 1}, -2}
+	tests := []rayTest{
+		{"down", Ray3{Vec3{0, 0, 5}, Vec3{0, 0, -1}}, true, 3, Vec3{0, 0, 1}},
+		{"from below", Ray3{Vec3{1, 1, 0}, Vec3{0, 0, 2}}, true, 1, Vec3{0, 0, 1}},
+		{"away", Ray3{Vec3{0, 0, 5}, Vec3{0, 0, 1}}, false, 0, Vec3{}},
+		{"parallel", Ray3{Vec3{0, 0, 5}, Vec3{1, 0, 0}}, false, 0, Vec3{}},
+		{"tiny direction", Ray3{Vec3{0, 0, 5}, Vec3{0, 0, -1e-7}}, true, 3e7, Vec3{0, 0, 1}},
+		{"grazing", Ray3{Vec3{0, 0, 3}, Vec3{1, 0, -1e-7}}, true, 1e7, Vec3{0, 0, 1}},
+	}
+	for _, test := range tests {
+		hit, ok := test.ray.IntersectPlane(&plane)
+		checkRayHit(t, test, hit, ok)
+	}
+}
+
+func TestIntersectBoundingBox(t *testing.T) {
+	bbox := BoundingBox{Vec3{-1, -1, -1}, Vec3{1, 1, 1}}
+	small := BoundingBox{Vec3{-1e-7, -1e-7, -1e-7}, Vec3{1e-7, 1e-7, 1e-7}}
+	huge := BoundingBox{Vec3{-1e10, -1, -1}, Vec3{1e10, 1, 1}}
+	tests := []struct {
+		rayTest
+		bbox *BoundingBox
+	}{
+		{rayTest{"+x", Ray3{Vec3{-5, 0, 0}, Vec3{1, 0, 0}}, true, 4, Vec3{-1, 0, 0}}, &bbox},
+		{rayTest{"-z", Ray3{Vec3{0.5, 0.5, 3}, Vec3{0, 0, -2}}, true, 1, Vec3{0, 0, 1}}, &bbox},
+		{rayTest{"diagonal", Ray3{Vec3{-3, -2, 0}, Vec3{1, 1, 0}}, true, 2, Vec3{-1, 0, 0}}, &bbox},
+		{rayTest{"inside exits", Ray3{Vec3{0, 0, 0}, Vec3{0, 1, 0}}, true, 1, Vec3{0, 1, 0}}, &bbox},
+		{rayTest{"behind", Ray3{Vec3{-5, 0, 0}, Vec3{-1, 0, 0}}, false, 0, Vec3{}}, &bbox},
+		{rayTest{"parallel outside", Ray3{Vec3{-5, 2, 0}, Vec3{1, 0, 0}}, false, 0, Vec3{}}, &bbox},
+		{rayTest{"miss", Ray3{Vec3{-5, 0, 0}, Vec3{1, 2, 0}}, false, 0, Vec3{}}, &bbox},
+		{rayTest{"zero direction", Ray3{Vec3{0, 0, 0}, Vec3{}}, false, 0, Vec3{}}, &bbox},
+		// small components are a direction, not a degenerate ray
+		{rayTest{"tiny direction", Ray3{Vec3{0, 0, 5}, Vec3{0, 0, -1e-7}}, true, 4e7, Vec3{0, 0, 1}}, &bbox},
+		{rayTest{"tiny box", Ray3{Vec3{-1e-6, 0, 0}, Vec3{1e-7, 1e-9, 0}}, true, 9, Vec3{-1, 0, 0}}, &small},
+		// the exit parameter overflows, the hit is clamped to the largest float
+		{rayTest{"overflowing exit", Ray3{Vec3{-1e10 + 1e8, 0, 0}, Vec3{1e-29, 0, 0}}, true, MathMax, Vec3{1, 0, 0}}, &huge},
+		{rayTest{"denormal direction inside", Ray3{Vec3{0, 0, 0}, Vec3{1e-40, 0, 0}}, true, MathMax, Vec3{1, 0, 0}}, &bbox},
+	}
+	for _, test := range tests {
+		hit, ok := test.ray.IntersectBoundingBox(test.bbox)
+		checkRayHit(t, test.rayTest, hit, ok)
+		if hit2, ok2 := test.bbox.IntersectRay(&test.ray); ok2 != ok || hit2 != hit {
+			t.Errorf("%s: IntersectRay differs", test.name)
+		}
+	}
+}
+
+func TestIntersectBoundingSphere(t *testing.T) {
+	sphere := BoundingSphere{Vec3{0, 0, 10}, 2}
+	tests := []rayTest{
+		{"front", Ray3{Vec3{}, Vec3{0, 0, 1}}, true, 8, Vec3{0, 0, -1}},
+		{"scaled direction", Ray3{Vec3{}, Vec3{0, 0, 4}}, true, 2, Vec3{0, 0, -1}},
+		{"inside exits", Ray3{Vec3{0, 0, 10}, Vec3{1, 0, 0}}, true, 2, Vec3{1, 0, 0}},
+		{"tangent", Ray3{Vec3{2, -5, 10}, Vec3{0, 1, 0}}, true, 5, Vec3{1, 0, 0}},
+		{"miss", Ray3{Vec3{3, 0, 0}, Vec3{0, 0, 1}}, false, 0, Vec3{}},
+		{"behind", Ray3{Vec3{}, Vec3{0, 0, -1}}, false, 0, Vec3{}},
+		{"zero direction", Ray3{Vec3{}, Vec3{}}, false, 0, Vec3{}},
+		{"tiny direction", Ray3{Vec3{}, Vec3{0, 0, 1e-4}}, true, 8e4, Vec3{0, 0, -1}},
+	}
+	for _, test := range tests {
+		hit, ok := test.ray.IntersectBoundingSphere(&sphere)
+		checkRayHit(t, test, hit, ok)
+	}
+}
+
+func TestIntersectTriangle(t *testing.T) {
+	tests := []struct {
+		rayTest
+		scale float32
+	}{
+		{rayTest{"center", Ray3{Vec3{0.25, 0.25, 1}, Vec3{0, 0, -1}}, true, 1, Vec3{0, 0, 1}}, 1},
+		{rayTest{"back side", Ray3{Vec3{0.25, 0.25, -1}, Vec3{0, 0, 1}}, true, 1, Vec3{0, 0, 1}}, 1},
+		{rayTest{"vertex", Ray3{Vec3{1, 0, 1}, Vec3{0, 0, -1}}, true, 1, Vec3{0, 0, 1}}, 1},
+		{rayTest{"outside", Ray3{Vec3{0.75, 0.75, 1}, Vec3{0, 0, -1}}, false, 0, Vec3{}}, 1},
+		{rayTest{"behind", Ray3{Vec3{0.25, 0.25, 1}, Vec3{0, 0, 1}}, false, 0, Vec3{}}, 1},
+		{rayTest{"parallel", Ray3{Vec3{-1, 0.25, 0}, Vec3{1, 0, 0}}, false, 0, Vec3{}}, 1},
+		// the same hits at scales where an absolute det tolerance fails
+		{rayTest{"small", Ray3{Vec3{0.25, 0.25, 1}, Vec3{0, 0, -1}}, true, 1, Vec3{0, 0, 1}}, 1e-3},
+		{rayTest{"large", Ray3{Vec3{0.25, 0.25, 1}, Vec3{0, 0, -1}}, true, 1, Vec3{0, 0, 1}}, 1e4},
+		{rayTest{"large parallel", Ray3{Vec3{-1, 0.25, 1e-6}, Vec3{1, 0, 0}}, false, 0, Vec3{}}, 1e4},
+	}
+	for _, test := range tests {
+		s := test.scale
+		a, b, c := Vec3{0, 0, 0}, Vec3{s, 0, 0}, Vec3{0, s, 0}
+		ray := Ray3{test.ray.Pos.Mul(s), test.ray.Dir.Mul(s)}
+		hit, ok := ray.IntersectTriangle(&a, &b, &c)
+		test.ray = ray
+		checkRayHit(t, test.rayTest, hit, ok)
+	}
+
+	// zero area triangles are never hit
+	a, b, c := Vec3{0, 0, 0}, Vec3{1, 1, 0}, Vec3{2, 2, 0}
+	ray := Ray3{Vec3{1, 1, 1}, Vec3{0, 0, -1}}
+	if hit, ok := ray.IntersectTriangle(&a, &b, &c); ok {
+		t.Errorf("hit degenerate triangle at %f", hit.Distance)
+	}
+}
+
+// row of unit boxes along x at z = 0, two per node
+func buildRayCastRow(n int) SpatElement {
+	root := &SpatNode{}
+	for i := 0; i < n; i += 2 {
+		node := &SpatNode{SpatElementData{Parent: root}, nil}
+		boxes := []BoundingBox{}
+		for j := i; j < i+2 && j < n; j++ {
+			bbox := BoundingBox{Vec3{float32(j) * 2, 0, 0}, Vec3{float32(j)*2 + 1, 1, 1}}
+			boxes = append(boxes, bbox)
+			node.Children = append(node.Children, &SpatLeaf{SpatElementData{BVolume: &bbox, Parent: node, Data: j}})
+		}
+		bbox := MakeBoundingBoxFromBoxes(boxes)
+		node.BVolume = &bbox
+		root.Children = append(root.Children, node)
+	}
+	boxes := make([]BoundingBox, len(root.Children))
+	for i, child := range root.Children {
+		boxes[i] = *child.GetBoundingVolume().(*BoundingBox)
+	}
+	bbox := MakeBoundingBoxFromBoxes(boxes)
+	root.BVolume = &bbox
+	return root
+}
+
+func TestRayCast(t *testing.T) {
+	root := buildRayCastRow(7)
+	tests := []struct {
+		name string
+		ray  Ray3
+		leaf int
+		t    float32
+	}{
+		{"+x", Ray3{Vec3{-3, 0.5, 0.5}, Vec3{1, 0, 0}}, 0, 3},
+		{"-x", Ray3{Vec3{20, 0.5, 0.5}, Vec3{-1, 0, 0}}, 6, 7},
+		{"down", Ray3{Vec3{8.5, 0.5, 5}, Vec3{0, 0, -1}}, 4, 4},
+		{"gap", Ray3{Vec3{7.5, 0.5, 5}, Vec3{0, 0, -1}}, -1, 0},
+		{"above", Ray3{Vec3{-3, 0.5, 2}, Vec3{1, 0, 0}}, -1, 0},
+	}
+	for _, test := range tests {
+		element, hit, ok := RayCast(root, &test.ray, nil)
+		if test.leaf < 0 {
+			if ok {
+				t.Errorf("%s: hit leaf %v", test.name, element.GetData())
+			}
+			continue
+		}
+		if !ok || element.GetData().(int) != test.leaf || !ApproxEqual(hit.Distance, test.t) {
+			t.Errorf("%s: hit %v at %f, want leaf %d at %f", test.name, ok, hit.Distance, test.leaf, test.t)
+		}
+	}
+
+	// hitFunc replaces the leaf volumes, the nearest accepted hit wins
+	ray := Ray3{Vec3{-3, 0.5, 0.5}, Vec3{1, 0, 0}}
+	element, hit, ok := RayCast(root, &ray, func(element SpatElement, ray *Ray3) (RayHit, bool) {
+		if element.GetData().(int) < 3 {
+			return RayHit{}, false
+		}
+		return ray.IntersectBoundingBox(element.GetBoundingVolume().(*BoundingBox))
+	})
+	if !ok || element.GetData().(int) != 3 || !ApproxEqual(hit.Distance, 9) {
+		t.Errorf("hitFunc: hit %v at %f", ok, hit.Distance)
+	}
+	if _, _, ok := root.(*SpatNode).CastRay(&Ray3{Vec3{0, 5, 0}, Vec3{0, 1, 0}}, nil); ok {
+		t.Error("hit with a ray missing the root")
+	}
+}
@@ -0,0 +1,88 @@
+package scene
+
+import (
+	"g3"
+)
+
+// Data attached to a node.
+type Component interface {
+	// Bounds in the local space of the node, ok is false if the component has no extent
+	LocalBounds() (bbox g3.BoundingBox, ok bool)
+}
+
+// Components that draw themselves. The matrices are set up by the scene.
+type Renderable interface {
+	Component
+	Render(dev g3.GraphicsDevice)
+}
+
+type Mesh struct {
+	Vertices  g3.VertexBuffer
+	Normals   g3.VertexBuffer
+	TexCoords g3.VertexBuffer // optional
+	Indices   g3.IndexBuffer
+	Texture   g3.Texture2D // optional
+	Shader    g3.Shader    // optional
+	Bounds    g3.BoundingBox
+}
+
+// Creates the buffers of a triangle mesh on dev.
+func NewMesh(dev g3.GraphicsDevice, vertices, normals []g3.Vec3, indices []uint32) *Mesh {
+	return &Mesh{
+		Vertices: dev.NewVertexBufferVec3(vertices),
+		Normals:  dev.NewVertexBufferVec3(normals),
+		Indices:  dev.NewIndexBuffer(indices),
+		Bounds:   g3.MakeBoundingBoxFromPoints(vertices)}
+}
+
+func (m *Mesh) LocalBounds() (g3.BoundingBox, bool) {
+	return m.Bounds, true
+}
+
+func (m *Mesh) Render(dev g3.GraphicsDevice) {
+	if m.Shader != nil {
+		dev.SetShader(m.Shader)
+	}
+	if m.Texture != nil {
+		dev.SetTexture2D(m.Texture, 0)
+	}
+	if m.TexCoords != nil {
+		dev.SetTexCoords(m.TexCoords, 0)
+	}
+	dev.SetVertices(m.Vertices)
+	dev.SetNormals(m.Normals)
+	dev.DrawIndexed(m.Indices)
+}
+
+func (m *Mesh) Release() {
+	m.Vertices.Release()
+	m.Normals.Release()
+	m.Indices.Release()
+	if m.TexCoords != nil {
+		m.TexCoords.Release()
+	}
+}
+
+// Point light at the position of its node. Lights with a range are culled
+// like meshes, lights without one are always active.
+type Light struct {
+	Color g3.Vec3
+	Range float32
+}
+
+func (l *Light) LocalBounds() (g3.BoundingBox, bool) {
+	if l.Range <= 0 {
+		return g3.BoundingBox{}, false
+	}
+	r := g3.Vec3{l.Range, l.Range, l.Range}
+	return g3.BoundingBox{r.Inverted(), r}, true
+}
+
+// Looks along the negative z axis of its node.
+type Camera struct {
+	Projection g3.Matrix4x4
+}
+
+func (c *Camera) LocalBounds() (g3.BoundingBox, bool) {
+	return g3.BoundingBox{}, false
+}
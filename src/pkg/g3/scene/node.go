@@ -0,0 +1,268 @@
+package scene
+
+import (
+	"g3"
+)
+
+// A node of the scene graph. The local transformation is made of
+// translation, rotation and scale (applied in reverse order), the world
+// matrix is cached and recalculated when the node or one of its ancestors
+// changed.
+type Node struct {
+	Name        string
+	scene       *Scene
+	parent      *Node
+	children    []*Node
+	components  []Component
+	translation g3.Vec3
+	rotation    g3.Quaternion
+	scale       g3.Vec3
+	local       g3.Matrix4x4
+	world       g3.Matrix4x4
+	localDirty  bool
+	worldDirty  bool
+	bounds      g3.BoundingBox
+	hasBounds   bool
+	queued      bool
+	item        *g3.BVHItem
+}
+
+func NewNode(name string) *Node {
+	n := &Node{Name: name}
+	n.rotation = g3.MakeIdentityQuaternion()
+	n.scale = g3.Vec3{1, 1, 1}
+	n.local = g3.MakeIdentityMatrix()
+	n.world = g3.MakeIdentityMatrix()
+	return n
+}
+
+func (n *Node) Scene() *Scene {
+	return n.scene
+}
+
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+func (n *Node) Children() []*Node {
+	return n.children
+}
+
+// Removes child from its old parent first.
+func (n *Node) AddChild(child *Node) {
+	for p := n; p != nil; p = p.parent {
+		if p == child {
+			panic("scene: node can't be its own descendant")
+		}
+	}
+	child.Detach()
+	child.parent = n
+	n.children = append(n.children, child)
+	child.setScene(n.scene)
+	child.invalidateWorld()
+}
+
+// Returns false if child isn't a child of the node.
+func (n *Node) RemoveChild(child *Node) bool {
+	for i, c := range n.children {
+		if c == child {
+			copy(n.children[i:], n.children[i+1:])
+			n.children[len(n.children)-1] = nil
+			n.children = n.children[:len(n.children)-1]
+			child.parent = nil
+			child.setScene(nil)
+			child.invalidateWorld()
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) Detach() {
+	if n.parent != nil {
+		n.parent.RemoveChild(n)
+	}
+}
+
+// Adds or removes the subtree to the spatial index of the scene.
+func (n *Node) setScene(scene *Scene) {
+	if n.scene == scene {
+		return
+	}
+	if n.scene != nil && n.item != nil {
+		n.scene.index.Remove(n.item)
+		n.item = nil
+	}
+	n.scene = scene
+	n.queued = false
+	if scene != nil {
+		scene.queue(n)
+	}
+	for _, child := range n.children {
+		child.setScene(scene)
+	}
+}
+
+// Marks the world matrices of the subtree as dirty and queues nodes with
+// bounds for an index update. A dirty node has only dirty descendants.
+func (n *Node) invalidateWorld() {
+	if n.worldDirty {
+		return
+	}
+	n.worldDirty = true
+	if n.scene != nil && len(n.components) > 0 {
+		n.scene.queue(n)
+	}
+	for _, child := range n.children {
+		child.invalidateWorld()
+	}
+}
+
+func (n *Node) Translation() g3.Vec3 {
+	return n.translation
+}
+
+func (n *Node) SetTranslation(translation g3.Vec3) {
+	n.translation = translation
+	n.localDirty = true
+	n.invalidateWorld()
+}
+
+func (n *Node) Rotation() g3.Quaternion {
+	return n.rotation
+}
+
+func (n *Node) SetRotation(rotation g3.Quaternion) {
+	n.rotation = rotation
+	n.localDirty = true
+	n.invalidateWorld()
+}
+
+func (n *Node) Scale() g3.Vec3 {
+	return n.scale
+}
+
+func (n *Node) SetScale(scale g3.Vec3) {
+	n.scale = scale
+	n.localDirty = true
+	n.invalidateWorld()
+}
+
+// Decomposes m into translation, rotation and scale, m must not contain shear.
+func (n *Node) SetLocalMatrix(m *g3.Matrix4x4) {
+	n.translation, n.rotation, n.scale = m.Decompose()
+	n.localDirty = true
+	n.invalidateWorld()
+}
+
+func (n *Node) LocalMatrix() *g3.Matrix4x4 {
+	if n.localDirty {
+		t := g3.MakeTranslationMatrix(n.translation.X, n.translation.Y, n.translation.Z)
+		r := g3.MakeMatrixFromQuaternion(n.rotation)
+		s := g3.MakeScaleMatrix(n.scale.X, n.scale.Y, n.scale.Z)
+		rs := r.Multiply(&s)
+		n.local = t.Multiply(&rs)
+		n.localDirty = false
+	}
+	return &n.local
+}
+
+func (n *Node) WorldMatrix() *g3.Matrix4x4 {
+	if n.worldDirty {
+		if n.parent != nil {
+			n.world = n.parent.WorldMatrix().Multiply(n.LocalMatrix())
+		} else {
+			n.world = *n.LocalMatrix()
+		}
+		n.worldDirty = false
+	}
+	return &n.world
+}
+
+func (n *Node) WorldPosition() g3.Vec3 {
+	m := n.WorldMatrix()
+	return g3.Vec3{m.M14, m.M24, m.M34}
+}
+
+func (n *Node) Components() []Component {
+	return n.components
+}
+
+func (n *Node) AddComponent(c Component) {
+	n.components = append(n.components, c)
+	if n.scene != nil {
+		n.scene.queue(n)
+	}
+}
+
+func (n *Node) RemoveComponent(c Component) bool {
+	for i, o := range n.components {
+		if o == c {
+			copy(n.components[i:], n.components[i+1:])
+			n.components[len(n.components)-1] = nil
+			n.components = n.components[:len(n.components)-1]
+			if n.scene != nil {
+				n.scene.queue(n)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// First mesh component of the node or nil
+func (n *Node) Mesh() *Mesh {
+	for _, c := range n.components {
+		if mesh, ok := c.(*Mesh); ok {
+			return mesh
+		}
+	}
+	return nil
+}
+
+// First light component of the node or nil
+func (n *Node) Light() *Light {
+	for _, c := range n.components {
+		if light, ok := c.(*Light); ok {
+			return light
+		}
+	}
+	return nil
+}
+
+// First camera component of the node or nil
+func (n *Node) Camera() *Camera {
+	for _, c := range n.components {
+		if camera, ok := c.(*Camera); ok {
+			return camera
+		}
+	}
+	return nil
+}
+
+// World bounds of all components, valid after Scene.Update.
+func (n *Node) GetBoundingVolume() g3.BoundingVolume {
+	return &n.bounds
+}
+
+func (n *Node) updateBounds() {
+	n.bounds = g3.MakeUndefinedBoundingBox()
+	n.hasBounds = false
+	for _, c := range n.components {
+		if local, ok := c.LocalBounds(); ok {
+			world := local.Transform(n.WorldMatrix())
+			n.bounds.Extend(&world)
+			n.hasBounds = true
+		}
+	}
+}
+
+// Calls visitFunc for the node and its descendants, children are skipped if
+// visitFunc returns false.
+func (n *Node) Walk(visitFunc func(node *Node) bool) {
+	if visitFunc(n) {
+		for _, child := range n.children {
+			child.Walk(visitFunc)
+		}
+	}
+}
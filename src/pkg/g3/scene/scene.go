@@ -0,0 +1,129 @@
+package scene
+
+import (
+	"g3"
+)
+
+// Scene graph with a spatial index over the world bounds of its nodes.
+type Scene struct {
+	root  *Node
+	index *g3.DynamicBVH
+	dirty []*Node
+}
+
+// indexMargin enlarges the bounds of nodes in the spatial index, nodes that
+// move less don't change the index.
+func NewScene(indexMargin float32) *Scene {
+	s := &Scene{nil, g3.NewDynamicBVH(indexMargin), nil}
+	s.root = NewNode("root")
+	s.root.scene = s
+	return s
+}
+
+func (s *Scene) Root() *Node {
+	return s.root
+}
+
+func (s *Scene) queue(n *Node) {
+	if !n.queued {
+		n.queued = true
+		s.dirty = append(s.dirty, n)
+	}
+}
+
+// Updates world bounds and the spatial index for all nodes that moved or
+// changed their components since the last update.
+func (s *Scene) Update() {
+	for i, n := range s.dirty {
+		s.dirty[i] = nil
+		n.queued = false
+		if n.scene != s {
+			continue
+		}
+		n.updateBounds()
+		if !n.hasBounds {
+			if n.item != nil {
+				s.index.Remove(n.item)
+				n.item = nil
+			}
+		} else if n.item == nil {
+			n.item = s.index.Insert(n)
+		} else {
+			s.index.Update(n.item)
+		}
+	}
+	s.dirty = s.dirty[:0]
+}
+
+// Nodes with bounds in the frustum. Update has to be called first.
+func (s *Scene) VisibleNodes(frustum *g3.Frustum, result []*Node) []*Node {
+	s.index.TraverseFrustum(frustum, func(element g3.SpatElement, leaf bool) bool {
+		if leaf {
+			// leaf boxes are enlarged, test the exact bounds
+			n := element.GetData().(*Node)
+			if frustum.ClipBoundingVolume(&n.bounds) {
+				result = append(result, n)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// All nodes with a light component.
+func (s *Scene) Lights(result []*Node) []*Node {
+	s.root.Walk(func(n *Node) bool {
+		if n.Light() != nil {
+			result = append(result, n)
+		}
+		return true
+	})
+	return result
+}
+
+// Nearest node whose bounds are hit by the ray. Update has to be called first.
+func (s *Scene) CastRay(ray *g3.Ray3) (*Node, g3.RayHit, bool) {
+	element, hit, ok := s.index.CastRay(ray, nil)
+	if !ok {
+		return nil, hit, false
+	}
+	return element.GetData().(*Node), hit, true
+}
+
+// Updates the scene and renders all visible renderable components.
+func (s *Scene) RenderView(dev g3.GraphicsDevice, projection, view *g3.Matrix4x4) {
+	s.Update()
+	dev.SetMatrix(g3.MatrixProjection, projection)
+	frustum := g3.MakeFrustumFromCamera(projection, view)
+	s.index.TraverseFrustum(frustum, func(element g3.SpatElement, leaf bool) bool {
+		if !leaf {
+			return true
+		}
+		n := element.GetData().(*Node)
+		if !frustum.ClipBoundingVolume(&n.bounds) {
+			return true
+		}
+		modelView := view.Multiply(n.WorldMatrix())
+		dev.SetMatrix(g3.MatrixModelView, &modelView)
+		for _, c := range n.components {
+			if r, ok := c.(Renderable); ok {
+				r.Render(dev)
+			}
+		}
+		return true
+	})
+}
+
+// Renders the scene seen by camera, a node with a camera component. Nothing
+// is drawn if the node has no camera or its transformation is singular.
+func (s *Scene) Render(dev g3.GraphicsDevice, camera *Node) {
+	c := camera.Camera()
+	if c == nil {
+		return
+	}
+	view, ok := camera.WorldMatrix().InvertedAffine()
+	if !ok {
+		return
+	}
+	s.RenderView(dev, &c.Projection, &view)
+}
@@ -0,0 +1,101 @@
+package scene
+
+import (
+	"g3"
+	"testing"
+)
+
+// counts draw calls, everything else is ignored
+type countingDevice struct {
+	g3.GraphicsDevice
+	draws int
+}
+
+func (dev *countingDevice) SetMatrix(mtype int, m *g3.Matrix4x4) {}
+func (dev *countingDevice) SetVertices(buffer g3.VertexBuffer)   {}
+func (dev *countingDevice) SetNormals(buffer g3.VertexBuffer)    {}
+func (dev *countingDevice) DrawIndexed(buffer g3.IndexBuffer)    { dev.draws++ }
+
+func unitBox() *Mesh {
+	return &Mesh{Bounds: g3.BoundingBox{g3.Vec3{-1, -1, -1}, g3.Vec3{1, 1, 1}}}
+}
+
+func TestTransforms(t *testing.T) {
+	s := NewScene(0.5)
+	parent, child := NewNode("parent"), NewNode("child")
+	s.Root().AddChild(parent)
+	parent.AddChild(child)
+	parent.SetTranslation(g3.Vec3{10, 0, 0})
+	parent.SetRotation(g3.MakeQuaternionFromAxisAngle(g3.Vec3{0, 0, 1}, g3.Pi/2))
+	child.SetTranslation(g3.Vec3{1, 0, 0})
+	child.SetScale(g3.Vec3{2, 2, 2})
+
+	if p := child.WorldPosition(); !p.ApproxEqualEps(g3.Vec3{10, 1, 0}, 1e-5) {
+		t.Errorf("child at %v", p)
+	}
+	child.AddComponent(unitBox())
+	s.Update()
+	expected := g3.BoundingBox{g3.Vec3{8, -1, -2}, g3.Vec3{12, 3, 2}}
+	if !child.bounds.Min.ApproxEqualEps(expected.Min, 1e-5) || !child.bounds.Max.ApproxEqualEps(expected.Max, 1e-5) {
+		t.Errorf("child bounds %v, expected %v", child.bounds, expected)
+	}
+
+	// moving the parent moves the child
+	parent.SetTranslation(g3.Vec3{0, 0, 5})
+	if !child.worldDirty {
+		t.Error("child not dirty after parent moved")
+	}
+	if p := child.WorldPosition(); !p.ApproxEqualEps(g3.Vec3{0, 1, 5}, 1e-5) {
+		t.Errorf("child at %v after parent moved", p)
+	}
+
+	// reparenting keeps the local transformation
+	s.Root().AddChild(child)
+	if p := child.WorldPosition(); !p.ApproxEqualEps(g3.Vec3{1, 0, 0}, 1e-5) || len(parent.Children()) != 0 {
+		t.Errorf("child at %v after reparenting", p)
+	}
+}
+
+func TestCulling(t *testing.T) {
+	s := NewScene(0.5)
+	nodes := make([]*Node, 0)
+	for i := 0; i < 10; i++ {
+		n := NewNode("box")
+		n.SetTranslation(g3.Vec3{0, 0, -float32(i) * 10})
+		n.AddComponent(unitBox())
+		s.Root().AddChild(n)
+		nodes = append(nodes, n)
+	}
+	camera := NewNode("camera")
+	camera.AddComponent(&Camera{g3.MakePerspectiveMatrix(g3.Deg2Rad(60), 1, 1, 45)})
+	camera.SetTranslation(g3.Vec3{0, 0, 5})
+	s.Root().AddChild(camera)
+
+	dev := &countingDevice{}
+	s.Render(dev, camera)
+	if dev.draws != 5 {
+		t.Errorf("%d meshes drawn, expected 5", dev.draws)
+	}
+
+	// removed subtrees leave the index
+	nodes[0].Detach()
+	nodes[1].RemoveComponent(nodes[1].Mesh())
+	nodes[9].SetTranslation(g3.Vec3{0, 0, -20})
+	dev.draws = 0
+	s.Render(dev, camera)
+	if dev.draws != 4 || s.index.Len() != 8 {
+		t.Errorf("%d meshes drawn, %d indexed, expected 4 and 8", dev.draws, s.index.Len())
+	}
+
+	// a node without a camera sees nothing
+	dev.draws = 0
+	s.Render(dev, nodes[2])
+	if dev.draws != 0 {
+		t.Errorf("%d meshes drawn without a camera", dev.draws)
+	}
+
+	ray := g3.Ray3{g3.Vec3{0, 0, 5}, g3.Vec3{0, 0, -1}}
+	if n, _, ok := s.CastRay(&ray); !ok || n != nodes[2] {
+		t.Errorf("ray hit %v", n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"runtime"
 	"sdl"
+	"time"
 )
 
 const (
@@ -16,6 +17,7 @@ const (
 
 	KeyF1 = uint32(sdl.K_F1)
 	KeyF2 = uint32(sdl.K_F2)
+	KeyF3 = uint32(sdl.K_F3)
 
 	KeyUp    = uint32(sdl.K_UP)
 	KeyDown  = uint32(sdl.K_DOWN)
@@ -84,6 +86,7 @@ func (engine *SDLEngine) SwapBuffers() {
 
 func (engine *SDLEngine) sdlRenderLoop() {
 	runtime.LockOSThread()
+	last := time.Nanoseconds()
 	for {
 		var event sdl.Event
 		for event.Poll() {
@@ -99,7 +102,9 @@ func (engine *SDLEngine) sdlRenderLoop() {
 				return
 			}
 		}
-		engine.frameEventChan <- FrameEvent{0.0}
+		now := time.Nanoseconds()
+		engine.frameEventChan <- FrameEvent{float32(now-last) / 1e9}
+		last = now
 	}
 	runtime.UnlockOSThread()
 }
@@ -0,0 +1,233 @@
+package g3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Binary files are made of chunks: magic, version, body length, crc32 of
+// the body and the body. All numbers are little endian.
+
+const SpatTreeVersion = 1
+
+var SpatTreeMagic = [4]byte{'G', '3', 'S', 'T'}
+
+var (
+	ErrChunkMagic    = os.NewError("g3: unexpected chunk magic")
+	ErrChunkChecksum = os.NewError("g3: chunk checksum mismatch")
+	ErrChunkVersion  = os.NewError("g3: unsupported chunk version")
+	ErrSpatTreeData  = os.NewError("g3: invalid spatial tree data")
+)
+
+// Size of the chunk header in bytes
+const ChunkHeaderSize = 16
+
+type chunkHeader struct {
+	Magic    [4]byte
+	Version  uint32
+	Length   uint32
+	Checksum uint32
+}
+
+func WriteChunk(w io.Writer, magic [4]byte, version uint32, body []byte) os.Error {
+	header := chunkHeader{magic, version, uint32(len(body)), crc32.ChecksumIEEE(body)}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// Reads the next chunk and verifies its magic and checksum. Chunks newer
+// than maxVersion are rejected.
+func ReadChunk(r io.Reader, magic [4]byte, maxVersion uint32) (version uint32, body []byte, err os.Error) {
+	var header chunkHeader
+	if err = binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return
+	}
+	if header.Magic != magic {
+		return 0, nil, ErrChunkMagic
+	}
+	if header.Version > maxVersion {
+		return 0, nil, ErrChunkVersion
+	}
+	// the buffer grows with the data read, a corrupted length can't make
+	// it allocate more than the stream holds
+	buffer := new(bytes.Buffer)
+	n, err := buffer.ReadFrom(io.LimitReader(r, int64(header.Length)))
+	if err != nil {
+		return 0, nil, err
+	}
+	if n < int64(header.Length) {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	body = buffer.Bytes()
+	if crc32.ChecksumIEEE(body) != header.Checksum {
+		return 0, nil, ErrChunkChecksum
+	}
+	return header.Version, body, nil
+}
+
+// Writes and reads the data of spatial elements.
+type PayloadCodec interface {
+	EncodePayload(w io.Writer, data interface{}) os.Error
+	DecodePayload(r io.Reader) (interface{}, os.Error)
+}
+
+const (
+	volumeNone = iota
+	volumeBox
+	volumeSphere
+	volumeOrientedBox
+)
+
+func writeBoundingVolume(w io.Writer, bvol BoundingVolume) os.Error {
+	var kind uint8
+	var data interface{}
+	switch v := bvol.(type) {
+	case nil:
+		kind = volumeNone
+	case *BoundingBox:
+		kind, data = volumeBox, v
+	case *BoundingSphere:
+		kind, data = volumeSphere, v
+	case *OrientedBoundingBox:
+		kind, data = volumeOrientedBox, v
+	default:
+		return ErrSpatTreeData
+	}
+	if err := binary.Write(w, binary.LittleEndian, kind); err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+func readBoundingVolume(r io.Reader) (BoundingVolume, os.Error) {
+	var kind uint8
+	if err := binary.Read(r, binary.LittleEndian, &kind); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case volumeNone:
+		return nil, nil
+	case volumeBox:
+		bbox := new(BoundingBox)
+		return bbox, binary.Read(r, binary.LittleEndian, bbox)
+	case volumeSphere:
+		sphere := new(BoundingSphere)
+		return sphere, binary.Read(r, binary.LittleEndian, sphere)
+	case volumeOrientedBox:
+		obb := new(OrientedBoundingBox)
+		return obb, binary.Read(r, binary.LittleEndian, obb)
+	}
+	return nil, ErrSpatTreeData
+}
+
+// element: child count (0 for leaves), bounding volume, payload flag and payload
+func writeSpatElement(w io.Writer, element SpatElement, codec PayloadCodec) os.Error {
+	children := element.GetChildren()
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(children))); err != nil {
+		return err
+	}
+	if err := writeBoundingVolume(w, element.GetBoundingVolume()); err != nil {
+		return err
+	}
+	data := element.GetData()
+	hasPayload := uint8(0)
+	if data != nil && codec != nil {
+		hasPayload = 1
+	}
+	if err := binary.Write(w, binary.LittleEndian, hasPayload); err != nil {
+		return err
+	}
+	if hasPayload != 0 {
+		if err := codec.EncodePayload(w, data); err != nil {
+			return err
+		}
+	}
+	for _, child := range children {
+		if err := writeSpatElement(w, child, codec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Smallest encoded element: child count, volume kind and payload flag
+const minSpatElementSize = 4 + 1 + 1
+
+func readSpatElement(r *bytes.Buffer, codec PayloadCodec, parent SpatElement) (SpatElement, os.Error) {
+	var numChildren uint32
+	if err := binary.Read(r, binary.LittleEndian, &numChildren); err != nil {
+		return nil, err
+	}
+	// the count is checked before allocating the children
+	if uint64(numChildren)*minSpatElementSize > uint64(r.Len()) {
+		return nil, ErrSpatTreeData
+	}
+	bvol, err := readBoundingVolume(r)
+	if err != nil {
+		return nil, err
+	}
+	var hasPayload uint8
+	if err := binary.Read(r, binary.LittleEndian, &hasPayload); err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if hasPayload != 0 {
+		if codec == nil {
+			return nil, ErrSpatTreeData
+		}
+		if data, err = codec.DecodePayload(r); err != nil {
+			return nil, err
+		}
+	}
+	if numChildren == 0 {
+		return &SpatLeaf{SpatElementData{BVolume: bvol, Parent: parent, Data: data}}, nil
+	}
+	node := &SpatNode{SpatElementData{BVolume: bvol, Parent: parent, Data: data}, make([]SpatElement, numChildren)}
+	for i := range node.Children {
+		if node.Children[i], err = readSpatElement(r, codec, node); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// Writes the tree below root as one chunk. Elements without children are
+// stored as leaves, element data is written by codec. If codec is nil only
+// the structure and the bounding volumes are written.
+func WriteSpatTree(w io.Writer, root SpatElement, codec PayloadCodec) os.Error {
+	body := new(bytes.Buffer)
+	if err := writeSpatElement(body, root, codec); err != nil {
+		return err
+	}
+	return WriteChunk(w, SpatTreeMagic, SpatTreeVersion, body.Bytes())
+}
+
+// Reads a tree written by WriteSpatTree and rebuilds it from SpatNodes and
+// SpatLeafs.
+func ReadSpatTree(r io.Reader, codec PayloadCodec) (SpatElement, os.Error) {
+	_, body, err := ReadChunk(r, SpatTreeMagic, SpatTreeVersion)
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBuffer(body)
+	root, err := readSpatElement(buffer, codec, nil)
+	if err != nil {
+		if err == os.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrSpatTreeData
+		}
+		return nil, err
+	}
+	if buffer.Len() != 0 {
+		return nil, ErrSpatTreeData
+	}
+	return root, nil
+}
@@ -0,0 +1,102 @@
+package g3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+)
+
+// stores the data of leaves as a single uint32
+type indexCodec struct{}
+
+func (c indexCodec) EncodePayload(w io.Writer, data interface{}) os.Error {
+	return binary.Write(w, binary.LittleEndian, data.(uint32))
+}
+
+func (c indexCodec) DecodePayload(r io.Reader) (interface{}, os.Error) {
+	var index uint32
+	err := binary.Read(r, binary.LittleEndian, &index)
+	return index, err
+}
+
+func equalSpatTrees(a, b SpatElement) bool {
+	ca, cb := a.GetChildren(), b.GetChildren()
+	if len(ca) != len(cb) || a.GetData() != b.GetData() {
+		return false
+	}
+	ba, bb := a.GetBoundingVolume(), b.GetBoundingVolume()
+	if (ba == nil) != (bb == nil) {
+		return false
+	}
+	if ba != nil && MakeBoundingBoxFromVolume(ba) != MakeBoundingBoxFromVolume(bb) {
+		return false
+	}
+	for i := range ca {
+		if cb[i].GetParent() != b || !equalSpatTrees(ca[i], cb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpatTreeFile(t *testing.T) {
+	root := buildTerrainQuadTree(3, 0, 0, 1024, nil)
+	index := uint32(0)
+	TraverseDepthFirst(root, func(element SpatElement, leaf bool) bool {
+		if leaf {
+			element.(*SpatLeaf).Data = index
+			index++
+		}
+		return true
+	})
+	root.(*SpatNode).Children[1].(*SpatNode).BVolume = &BoundingSphere{Vec3{1, 2, 3}, 4}
+
+	buffer := new(bytes.Buffer)
+	if err := WriteSpatTree(buffer, root, indexCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	loaded, err := ReadSpatTree(bytes.NewBuffer(data), indexCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalSpatTrees(root, loaded) {
+		t.Error("loaded tree differs")
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)-10] ^= 1
+	if _, err := ReadSpatTree(bytes.NewBuffer(corrupted), indexCodec{}); err != ErrChunkChecksum {
+		t.Errorf("corrupted data: got error %v", err)
+	}
+
+	newer := append([]byte(nil), data...)
+	newer[4] = SpatTreeVersion + 1
+	if _, err := ReadSpatTree(bytes.NewBuffer(newer), indexCodec{}); err != ErrChunkVersion {
+		t.Errorf("newer version: got error %v", err)
+	}
+
+	// a huge length fails at the end of the data
+	long := append([]byte(nil), data...)
+	long[11] = 0x7f
+	if _, err := ReadSpatTree(bytes.NewBuffer(long), indexCodec{}); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated chunk: got error %v", err)
+	}
+
+	if _, err := ReadSpatTree(bytes.NewBuffer(data), nil); err != ErrSpatTreeData {
+		t.Errorf("missing codec: got error %v", err)
+	}
+
+	// a corrupted child count must not allocate the children
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, uint32(0xffffffff))
+	binary.Write(body, binary.LittleEndian, [2]uint8{volumeNone, 0})
+	chunk := new(bytes.Buffer)
+	WriteChunk(chunk, SpatTreeMagic, SpatTreeVersion, body.Bytes())
+	if _, err := ReadSpatTree(chunk, indexCodec{}); err != ErrSpatTreeData {
+		t.Errorf("huge child count: got error %v", err)
+	}
+}
@@ -8,6 +8,12 @@ type TraverseFunc func(element SpatElement, leaf bool) bool
 
 type FrustumTraversable interface {
 	TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc)
+	// Only the planes in planeMask are tested, subtrees that are completely
+	// inside the frustum are passed to traverseFunc without further tests.
+	// coherency (may be nil) is owned by the caller, the tree itself is never
+	// written. Passing the same one each frame tests the plane that culled a
+	// node the last time first.
+	TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc)
 }
 
 type SpatElement interface {
@@ -45,12 +51,26 @@ func (node *SpatNode) GetChildren() []SpatElement {
 	return node.Children
 }
 
+func (node *SpatNode) CastRay(ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool) {
+	return RayCast(node, ray, hitFunc)
+}
+
 func (node *SpatNode) TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc) {
-	if frustum.ClipBoundingVolume(node.BVolume) {
-		if traverseFunc(node, false) {
-			for _, child := range node.Children {
-				child.TraverseFrustum(frustum, traverseFunc)
-			}
+	var coherency FrustumCoherency
+	node.TraverseFrustumMasked(frustum, FrustumPlanesAll, &coherency, traverseFunc)
+}
+
+func (node *SpatNode) TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc) {
+	if planeMask != FrustumPlaneNone {
+		result, mask := coherency.classify(frustum, node, node.BVolume, planeMask)
+		if result == ClassifyOutside {
+			return
+		}
+		planeMask = mask
+	}
+	if traverseFunc(node, false) {
+		for _, child := range node.Children {
+			child.TraverseFrustumMasked(frustum, planeMask, coherency, traverseFunc)
 		}
 	}
 }
@@ -63,8 +83,20 @@ func (leaf *SpatLeaf) GetChildren() []SpatElement {
 	return nil
 }
 
+func (leaf *SpatLeaf) CastRay(ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool) {
+	return RayCast(leaf, ray, hitFunc)
+}
+
 func (leaf *SpatLeaf) TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc) {
-	if frustum.ClipBoundingVolume(leaf.BVolume) {
-		traverseFunc(leaf, true)
+	leaf.TraverseFrustumMasked(frustum, FrustumPlanesAll, nil, traverseFunc)
+}
+
+func (leaf *SpatLeaf) TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc) {
+	if planeMask != FrustumPlaneNone {
+		result, _ := coherency.classify(frustum, leaf, leaf.BVolume, planeMask)
+		if result == ClassifyOutside {
+			return
+		}
 	}
+	traverseFunc(leaf, true)
 }
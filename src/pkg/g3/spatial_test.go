@@ -0,0 +1,262 @@
+package g3
+
+import (
+	"testing"
+)
+
+// terrain like quadtree with 4^depth leaves, heights vary smoothly
+func buildTerrainQuadTree(depth uint, x, y, size float32, parent SpatElement) SpatElement {
+	if depth == 0 {
+		h := 20.0 * (Sin(x*0.01) + Cos(y*0.013))
+		bbox := BoundingBox{Vec3{x, y, h - 4}, Vec3{x + size, y + size, h + 4}}
+		return &SpatLeaf{SpatElementData{BVolume: &bbox, Parent: parent}}
+	}
+	node := &SpatNode{SpatElementData{Parent: parent}, nil}
+	half := size / 2
+	node.Children = []SpatElement{
+		buildTerrainQuadTree(depth-1, x, y, half, node),
+		buildTerrainQuadTree(depth-1, x+half, y, half, node),
+		buildTerrainQuadTree(depth-1, x, y+half, half, node),
+		buildTerrainQuadTree(depth-1, x+half, y+half, half, node)}
+	boxes := make([]BoundingBox, len(node.Children))
+	for i, child := range node.Children {
+		boxes[i] = *child.GetBoundingVolume().(*BoundingBox)
+	}
+	bbox := MakeBoundingBoxFromBoxes(boxes)
+	node.BVolume = &bbox
+	return node
+}
+
+func makeTerrainFrustum() *Frustum {
+	eye, center, up := Vec3{512, -64, 80}, Vec3{512, 512, 0}, Vec3{0, 0, 1}
+	projection := MakePerspectiveMatrix(Deg2Rad(60), 4.0/3.0, 1.0, 2000.0)
+	lookAt := MakeLookAtMatrix(&eye, &center, &up)
+	m := projection.Multiply(&lookAt)
+	return MakeFrustumFromMatrix(&m)
+}
+
+// the box test used before p/n-vertices, all 8 corners are evaluated
+func classifyPlaneAllCorners(bbox *BoundingBox, p *Plane) int {
+	inside := 0
+	for i := 0; i < 8; i++ {
+		v := bbox.Min
+		if i&1 != 0 {
+			v.X = bbox.Max.X
+		}
+		if i&2 != 0 {
+			v.Y = bbox.Max.Y
+		}
+		if i&4 != 0 {
+			v.Z = bbox.Max.Z
+		}
+		if p.DistanceToPoint(&v) >= 0.0 {
+			inside++
+		}
+	}
+	if inside == 8 {
+		return ClassifyInside
+	} else if inside == 0 {
+		return ClassifyOutside
+	}
+	return ClassifyIntersecting
+}
+
+// the traversal used before plane masks, every node is tested against all planes
+func traverseFrustumAllPlanes(element SpatElement, frustum *Frustum, traverseFunc TraverseFunc) {
+	bbox := element.GetBoundingVolume().(*BoundingBox)
+	for i := 0; i < 6; i++ {
+		if classifyPlaneAllCorners(bbox, frustum.plane(i)) == ClassifyOutside {
+			return
+		}
+	}
+	children := element.GetChildren()
+	if traverseFunc(element, len(children) == 0) {
+		for _, child := range children {
+			traverseFrustumAllPlanes(child, frustum, traverseFunc)
+		}
+	}
+}
+
+func TestClassifyPlanePNVertex(t *testing.T) {
+	bbox := BoundingBox{Vec3{-1, -2, -3}, Vec3{1, 2, 3}}
+	normals := []Vec3{{1, 0, 0}, {-1, 1, 0}, {0.3, -0.2, 0.9}, {-1, -1, -1}}
+	for _, n := range normals {
+		for d := float32(-5.0); d <= 5.0; d += 0.25 {
+			p := Plane{n.Normalized(), d}
+			if r, e := bbox.ClassifyPlane(&p), classifyPlaneAllCorners(&bbox, &p); r != e {
+				t.Errorf("normal %v distance %f: got %d, expected %d", n, d, r, e)
+			}
+		}
+	}
+}
+
+func countVisibleLeaves(root SpatElement, frustum *Frustum, coherency *FrustumCoherency) int {
+	visible := 0
+	root.TraverseFrustumMasked(frustum, FrustumPlanesAll, coherency, func(element SpatElement, leaf bool) bool {
+		if leaf {
+			visible++
+		}
+		return true
+	})
+	return visible
+}
+
+func TestTraverseFrustumMasked(t *testing.T) {
+	root := buildTerrainQuadTree(5, 0, 0, 1024, nil)
+	frustum := makeTerrainFrustum()
+
+	expected := 0
+	traverseFrustumAllPlanes(root, frustum, func(element SpatElement, leaf bool) bool {
+		if leaf {
+			expected++
+		}
+		return true
+	})
+	if visible := countVisibleLeaves(root, frustum, nil); visible != expected || visible == 0 {
+		t.Errorf("without coherency: %d visible leaves, expected %d", visible, expected)
+	}
+	// the hint only changes the test order, whatever plane it starts at
+	for plane := 0; plane < 6; plane++ {
+		coherency := NewFrustumCoherency()
+		coherency.last = plane
+		// twice, the second run starts with the planes kept from the first
+		for run := 0; run < 2; run++ {
+			if visible := countVisibleLeaves(root, frustum, coherency); visible != expected {
+				t.Errorf("plane %d run %d: %d visible leaves, expected %d", plane, run, visible, expected)
+			}
+		}
+	}
+}
+
+// Counts the plane tests of the wrapped volume
+type countingVolume struct {
+	BoundingVolume
+	tests *int
+}
+
+func (v *countingVolume) ClassifyPlane(p *Plane) int {
+	*v.tests++
+	return v.BoundingVolume.ClassifyPlane(p)
+}
+
+func TestFrustumCoherencyFrames(t *testing.T) {
+	root := buildTerrainQuadTree(5, 0, 0, 1024, nil)
+	tests := 0
+	TraverseDepthFirst(root, func(element SpatElement, leaf bool) bool {
+		switch e := element.(type) {
+		case *SpatNode:
+			e.BVolume = &countingVolume{e.BVolume, &tests}
+		case *SpatLeaf:
+			e.BVolume = &countingVolume{e.BVolume, &tests}
+		}
+		return true
+	})
+	frustum := makeTerrainFrustum()
+	expected := countVisibleLeaves(root, frustum, nil)
+
+	// without per node state every frame does the same tests
+	var frames [2]int
+	for i := range frames {
+		tests = 0
+		if visible := countVisibleLeaves(root, frustum, &FrustumCoherency{}); visible != expected {
+			t.Errorf("frame %d: %d visible leaves, expected %d", i, visible, expected)
+		}
+		frames[i] = tests
+	}
+	if frames[0] != frames[1] {
+		t.Errorf("%d and %d plane tests without per node state", frames[0], frames[1])
+	}
+
+	// the second frame starts each culled node with the plane that culled it
+	coherency := NewFrustumCoherency()
+	for i := range frames {
+		tests = 0
+		if visible := countVisibleLeaves(root, frustum, coherency); visible != expected {
+			t.Errorf("coherent frame %d: %d visible leaves, expected %d", i, visible, expected)
+		}
+		frames[i] = tests
+	}
+	if frames[1] >= frames[0] {
+		t.Errorf("%d plane tests in the second frame, %d in the first", frames[1], frames[0])
+	}
+
+	coherency.Reset()
+	tests = 0
+	countVisibleLeaves(root, frustum, coherency)
+	if tests != frames[0] {
+		t.Errorf("%d plane tests after reset, %d in the first frame", tests, frames[0])
+	}
+}
+
+// The tree is shared, each traversal keeps its own coherency
+func TestTraverseFrustumConcurrent(t *testing.T) {
+	root := buildTerrainQuadTree(6, 0, 0, 1024, nil)
+	frustums := []*Frustum{makeTerrainFrustum()}
+	for _, x := range []float32{200, 500, 800} {
+		projection := MakePerspectiveMatrix(Deg2Rad(60), 1, 1, 400)
+		eye, center, up := Vec3{x, -50, 60}, Vec3{x + 100, 500, 0}, Vec3{0, 0, 1}
+		view := MakeLookAtMatrix(&eye, &center, &up)
+		frustums = append(frustums, MakeFrustumFromCamera(&projection, &view))
+	}
+	expected := make([]int, len(frustums))
+	for i, frustum := range frustums {
+		expected[i] = countVisibleLeaves(root, frustum, nil)
+		if expected[i] == 0 {
+			t.Fatalf("frustum %d sees no leaves", i)
+		}
+	}
+
+	const runs = 20
+	done := make(chan bool)
+	for i := range frustums {
+		go func(i int) {
+			ok := true
+			for run := 0; run < runs; run++ {
+				visible := 0
+				root.TraverseFrustum(frustums[i], func(element SpatElement, leaf bool) bool {
+					if leaf {
+						visible++
+					}
+					return true
+				})
+				ok = ok && visible == expected[i]
+			}
+			done <- ok
+		}(i)
+	}
+	for _ = range frustums {
+		if !<-done {
+			t.Error("concurrent traversal returned different leaves")
+		}
+	}
+}
+
+var benchTerrain SpatElement
+
+func benchmarkTerrain(b *testing.B) (SpatElement, *Frustum) {
+	b.StopTimer()
+	if benchTerrain == nil {
+		benchTerrain = buildTerrainQuadTree(8, 0, 0, 1024, nil)
+	}
+	frustum := makeTerrainFrustum()
+	b.StartTimer()
+	return benchTerrain, frustum
+}
+
+func BenchmarkTraverseFrustumAllPlanes(b *testing.B) {
+	root, frustum := benchmarkTerrain(b)
+	for i := 0; i < b.N; i++ {
+		traverseFrustumAllPlanes(root, frustum, func(element SpatElement, leaf bool) bool {
+			return true
+		})
+	}
+}
+
+func BenchmarkTraverseFrustumMasked(b *testing.B) {
+	root, frustum := benchmarkTerrain(b)
+	for i := 0; i < b.N; i++ {
+		root.TraverseFrustum(frustum, func(element SpatElement, leaf bool) bool {
+			return true
+		})
+	}
+}
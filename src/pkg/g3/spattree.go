@@ -0,0 +1,465 @@
+package g3
+
+import (
+	"container/heap"
+)
+
+// Dynamic quadtrees and octrees. Objects are stored in the deepest node
+// whose (loose) bounds contain them. Leaves split when they hold too many
+// objects, subtrees merge back when they hold only a few.
+
+// Anything with a bounding volume can be stored in a SpatTree
+type SpatObject interface {
+	HasBoundingVolume
+}
+
+// Exact ray test for an object in a SpatTree
+type SpatObjectRayHitFunc func(object SpatObject, ray *Ray3) (RayHit, bool)
+
+type SpatTreeSettings struct {
+	MaxDepth uint
+	// a leaf is split when it holds more objects
+	SplitThreshold int
+	// children are merged into their parent when the whole subtree holds fewer objects
+	MergeThreshold int
+	// node bounds are scaled by this factor; 1 gives a regular tree, loose trees use 2
+	Looseness float32
+}
+
+// Handle of an object stored in a SpatTree, needed to update or remove it
+type SpatTreeItem struct {
+	Object SpatObject
+	bbox   BoundingBox
+	node   *spatTreeNode
+}
+
+type SpatTree struct {
+	settings SpatTreeSettings
+	// 2 for quadtrees (x and y are split), 3 for octrees
+	splitAxes uint
+	root      *spatTreeNode
+}
+
+type spatTreeNode struct {
+	tree     *SpatTree
+	parent   *spatTreeNode
+	depth    uint
+	cell     BoundingBox
+	bounds   BoundingBox
+	children []*spatTreeNode
+	elements []SpatElement
+	items    []*SpatTreeItem
+	count    int
+}
+
+// Quadtree that splits along x and y, z is not subdivided
+func NewQuadTree(bounds BoundingBox, settings *SpatTreeSettings) *SpatTree {
+	return newSpatTree(bounds, settings, 2)
+}
+
+func NewOctree(bounds BoundingBox, settings *SpatTreeSettings) *SpatTree {
+	return newSpatTree(bounds, settings, 3)
+}
+
+func newSpatTree(bounds BoundingBox, settings *SpatTreeSettings, splitAxes uint) *SpatTree {
+	tree := &SpatTree{*settings, splitAxes, nil}
+	if tree.settings.Looseness < 1.0 {
+		tree.settings.Looseness = 1.0
+	}
+	tree.root = tree.newNode(nil, 0, bounds)
+	return tree
+}
+
+func (tree *SpatTree) newNode(parent *spatTreeNode, depth uint, cell BoundingBox) *spatTreeNode {
+	center := cell.CalculateCenter()
+	half := cell.Max.Sub(center).Scaled(tree.settings.Looseness)
+	return &spatTreeNode{tree: tree, parent: parent, depth: depth, cell: cell,
+		bounds: BoundingBox{center.Sub(half), center.Add(half)}}
+}
+
+// Root of the tree, the nodes can be used with all functions working on spatial trees
+func (tree *SpatTree) GetRoot() SpatElement {
+	return tree.root
+}
+
+// Number of stored objects
+func (tree *SpatTree) Len() int {
+	return tree.root.count
+}
+
+func (tree *SpatTree) TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc) {
+	tree.root.TraverseFrustum(frustum, traverseFunc)
+}
+
+func (tree *SpatTree) TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc) {
+	tree.root.TraverseFrustumMasked(frustum, planeMask, coherency, traverseFunc)
+}
+
+func (tree *SpatTree) Insert(object SpatObject) *SpatTreeItem {
+	item := &SpatTreeItem{object, MakeBoundingBoxFromVolume(object.GetBoundingVolume()), nil}
+	tree.insertItem(item)
+	return item
+}
+
+func (tree *SpatTree) insertItem(item *SpatTreeItem) {
+	node := tree.root
+	if !node.bounds.ContainsBox(&item.bbox) {
+		// objects outside of the tree stay in the root, which grows to contain them
+		node.bounds.Extend(&item.bbox)
+	}
+	for {
+		node.count++
+		if node.children == nil {
+			break
+		}
+		child := node.childFor(&item.bbox)
+		if child == nil {
+			break
+		}
+		node = child
+	}
+	node.items = append(node.items, item)
+	item.node = node
+	if node.children == nil && len(node.items) > tree.settings.SplitThreshold && node.depth < tree.settings.MaxDepth {
+		node.split()
+	}
+}
+
+func (tree *SpatTree) Remove(item *SpatTreeItem) {
+	node := item.node
+	if node == nil {
+		return
+	}
+	for i, it := range node.items {
+		if it == item {
+			last := len(node.items) - 1
+			node.items[i] = node.items[last]
+			node.items[last] = nil
+			node.items = node.items[:last]
+			break
+		}
+	}
+	item.node = nil
+
+	// merge the highest ancestor that holds few enough objects
+	var merge *spatTreeNode
+	for n := node; n != nil; n = n.parent {
+		n.count--
+		if n.children != nil && n.count <= tree.settings.MergeThreshold {
+			merge = n
+		}
+	}
+	if merge != nil {
+		merge.merge()
+	}
+}
+
+// Has to be called after the bounding volume of the object changed.
+func (tree *SpatTree) Update(item *SpatTreeItem) {
+	bbox := MakeBoundingBoxFromVolume(item.Object.GetBoundingVolume())
+	if item.node != nil && item.node.children == nil && item.node.bounds.ContainsBox(&bbox) {
+		item.bbox = bbox
+		return
+	}
+	tree.Remove(item)
+	item.bbox = bbox
+	tree.insertItem(item)
+}
+
+// Child whose bounds contain bbox, nil if bbox has to stay in node.
+func (node *spatTreeNode) childFor(bbox *BoundingBox) *spatTreeNode {
+	// the child that contains the center is the only candidate
+	c := bbox.CalculateCenter()
+	center := node.cell.CalculateCenter()
+	i := 0
+	if c.X >= center.X {
+		i |= 1
+	}
+	if c.Y >= center.Y {
+		i |= 2
+	}
+	if node.tree.splitAxes == 3 && c.Z >= center.Z {
+		i |= 4
+	}
+	child := node.children[i]
+	if !child.bounds.ContainsBox(bbox) {
+		return nil
+	}
+	return child
+}
+
+func (node *spatTreeNode) split() {
+	tree := node.tree
+	center := node.cell.CalculateCenter()
+	num := 1 << tree.splitAxes
+	node.children = make([]*spatTreeNode, num)
+	node.elements = make([]SpatElement, num)
+	for i := 0; i < num; i++ {
+		cell := node.cell
+		if i&1 == 0 {
+			cell.Max.X = center.X
+		} else {
+			cell.Min.X = center.X
+		}
+		if i&2 == 0 {
+			cell.Max.Y = center.Y
+		} else {
+			cell.Min.Y = center.Y
+		}
+		if tree.splitAxes == 3 {
+			if i&4 == 0 {
+				cell.Max.Z = center.Z
+			} else {
+				cell.Min.Z = center.Z
+			}
+		}
+		node.children[i] = tree.newNode(node, node.depth+1, cell)
+		node.elements[i] = node.children[i]
+	}
+
+	items := node.items
+	node.items = nil
+	for _, item := range items {
+		child := node.childFor(&item.bbox)
+		if child == nil {
+			node.items = append(node.items, item)
+			continue
+		}
+		child.items = append(child.items, item)
+		child.count++
+		item.node = child
+	}
+	for _, child := range node.children {
+		if len(child.items) > tree.settings.SplitThreshold && child.depth < tree.settings.MaxDepth {
+			child.split()
+		}
+	}
+}
+
+func (node *spatTreeNode) collectItems(items []*SpatTreeItem) []*SpatTreeItem {
+	items = append(items, node.items...)
+	for _, child := range node.children {
+		items = child.collectItems(items)
+	}
+	return items
+}
+
+func (node *spatTreeNode) merge() {
+	items := make([]*SpatTreeItem, 0, node.count)
+	node.items = node.collectItems(items)
+	for _, item := range node.items {
+		item.node = node
+	}
+	node.children = nil
+	node.elements = nil
+}
+
+// SpatElement
+
+func (node *spatTreeNode) GetBoundingVolume() BoundingVolume {
+	return &node.bounds
+}
+
+func (node *spatTreeNode) GetParent() SpatElement {
+	if node.parent == nil {
+		return nil
+	}
+	return node.parent
+}
+
+func (node *spatTreeNode) GetChildren() []SpatElement {
+	return node.elements
+}
+
+// Returns the objects stored in this node as []SpatObject
+func (node *spatTreeNode) GetData() interface{} {
+	objects := make([]SpatObject, len(node.items))
+	for i, item := range node.items {
+		objects[i] = item.Object
+	}
+	return objects
+}
+
+func (node *spatTreeNode) TraverseFrustum(frustum *Frustum, traverseFunc TraverseFunc) {
+	var coherency FrustumCoherency
+	node.TraverseFrustumMasked(frustum, FrustumPlanesAll, &coherency, traverseFunc)
+}
+
+func (node *spatTreeNode) TraverseFrustumMasked(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, traverseFunc TraverseFunc) {
+	if planeMask != FrustumPlaneNone {
+		result, mask := coherency.classify(frustum, node, &node.bounds, planeMask)
+		if result == ClassifyOutside {
+			return
+		}
+		planeMask = mask
+	}
+	if traverseFunc(node, node.children == nil) {
+		for _, child := range node.children {
+			child.TraverseFrustumMasked(frustum, planeMask, coherency, traverseFunc)
+		}
+	}
+}
+
+func (node *spatTreeNode) CastRay(ray *Ray3, hitFunc RayHitFunc) (SpatElement, RayHit, bool) {
+	return RayCast(node, ray, hitFunc)
+}
+
+// Queries
+
+// Appends all objects that are at least partially inside the frustum to result.
+func (tree *SpatTree) QueryFrustum(frustum *Frustum, result []SpatObject) []SpatObject {
+	var coherency FrustumCoherency
+	return tree.root.queryFrustum(frustum, FrustumPlanesAll, &coherency, result)
+}
+
+func (node *spatTreeNode) queryFrustum(frustum *Frustum, planeMask uint, coherency *FrustumCoherency, result []SpatObject) []SpatObject {
+	if planeMask != FrustumPlaneNone {
+		r, mask := coherency.classify(frustum, node, &node.bounds, planeMask)
+		if r == ClassifyOutside {
+			return result
+		}
+		planeMask = mask
+	}
+	for _, item := range node.items {
+		if planeMask != FrustumPlaneNone {
+			if r, _ := coherency.classify(frustum, item, item.Object.GetBoundingVolume(), planeMask); r == ClassifyOutside {
+				continue
+			}
+		}
+		result = append(result, item.Object)
+	}
+	for _, child := range node.children {
+		result = child.queryFrustum(frustum, planeMask, coherency, result)
+	}
+	return result
+}
+
+// Appends all objects whose enclosing boxes intersect bbox to result.
+func (tree *SpatTree) QueryBox(bbox *BoundingBox, result []SpatObject) []SpatObject {
+	return tree.root.queryBox(bbox, result)
+}
+
+func (node *spatTreeNode) queryBox(bbox *BoundingBox, result []SpatObject) []SpatObject {
+	if !node.bounds.IntersectBox(bbox) {
+		return result
+	}
+	for _, item := range node.items {
+		if item.bbox.IntersectBox(bbox) {
+			result = append(result, item.Object)
+		}
+	}
+	for _, child := range node.children {
+		result = child.queryBox(bbox, result)
+	}
+	return result
+}
+
+// Appends all objects whose enclosing boxes intersect the sphere to result.
+func (tree *SpatTree) QuerySphere(sphere *BoundingSphere, result []SpatObject) []SpatObject {
+	return tree.root.querySphere(sphere, result)
+}
+
+func (node *spatTreeNode) querySphere(sphere *BoundingSphere, result []SpatObject) []SpatObject {
+	if !node.bounds.IntersectSphere(sphere) {
+		return result
+	}
+	for _, item := range node.items {
+		if item.bbox.IntersectSphere(sphere) {
+			result = append(result, item.Object)
+		}
+	}
+	for _, child := range node.children {
+		result = child.querySphere(sphere, result)
+	}
+	return result
+}
+
+// Nearest object hit by the ray. hitFunc does the exact test, if it is nil
+// the bounding volumes of the objects are used.
+func (tree *SpatTree) QueryRay(ray *Ray3, hitFunc SpatObjectRayHitFunc) (SpatObject, RayHit, bool) {
+	best := RayHit{Distance: MathMax}
+	var bestItem *SpatTreeItem
+	tree.root.queryRay(ray, hitFunc, &best, &bestItem)
+	if bestItem == nil {
+		return nil, RayHit{}, false
+	}
+	return bestItem.Object, best, true
+}
+
+func (node *spatTreeNode) queryRay(ray *Ray3, hitFunc SpatObjectRayHitFunc, best *RayHit, bestItem **SpatTreeItem) {
+	entry, ok := rayEntryDistance(ray, &node.bounds)
+	if !ok || entry > best.Distance {
+		return
+	}
+	for _, item := range node.items {
+		if entry, ok := rayEntryDistance(ray, &item.bbox); !ok || entry > best.Distance {
+			continue
+		}
+		var hit RayHit
+		if hitFunc != nil {
+			hit, ok = hitFunc(item.Object, ray)
+		} else if ri, isRi := item.Object.GetBoundingVolume().(RayIntersector); isRi {
+			hit, ok = ri.IntersectRay(ray)
+		} else {
+			hit, ok = ray.IntersectBoundingBox(&item.bbox)
+		}
+		if ok && hit.Distance < best.Distance {
+			*best = hit
+			*bestItem = item
+		}
+	}
+	for _, child := range node.children {
+		child.queryRay(ray, hitFunc, best, bestItem)
+	}
+}
+
+// entry of the best first search, either a node or an item
+type nearestEntry struct {
+	distSq float32
+	node   *spatTreeNode
+	item   *SpatTreeItem
+}
+
+type nearestQueue []nearestEntry
+
+func (q nearestQueue) Len() int           { return len(q) }
+func (q nearestQueue) Less(i, j int) bool { return q[i].distSq < q[j].distSq }
+func (q nearestQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *nearestQueue) Push(x interface{}) {
+	*q = append(*q, x.(nearestEntry))
+}
+
+func (q *nearestQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+func boxDistanceSq(bbox *BoundingBox, p *Vec3) float32 {
+	return bbox.ClosestPoint(p).DistanceSq(*p)
+}
+
+// Appends the k objects whose enclosing boxes are closest to p to result, nearest first.
+func (tree *SpatTree) QueryNearest(p Vec3, k int, result []SpatObject) []SpatObject {
+	queue := &nearestQueue{}
+	heap.Push(queue, nearestEntry{boxDistanceSq(&tree.root.bounds, &p), tree.root, nil})
+	for found := 0; found < k && queue.Len() > 0; {
+		e := heap.Pop(queue).(nearestEntry)
+		if e.item != nil {
+			result = append(result, e.item.Object)
+			found++
+			continue
+		}
+		for _, item := range e.node.items {
+			heap.Push(queue, nearestEntry{boxDistanceSq(&item.bbox, &p), nil, item})
+		}
+		for _, child := range e.node.children {
+			if child.count > 0 {
+				heap.Push(queue, nearestEntry{boxDistanceSq(&child.bounds, &p), child, nil})
+			}
+		}
+	}
+	return result
+}
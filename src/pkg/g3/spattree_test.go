@@ -0,0 +1,195 @@
+package g3
+
+import (
+	"rand"
+	"testing"
+)
+
+type testObject struct {
+	sphere BoundingSphere
+}
+
+func (o *testObject) GetBoundingVolume() BoundingVolume {
+	return &o.sphere
+}
+
+func randomTestObjects(r *rand.Rand, n int) []*testObject {
+	objects := make([]*testObject, n)
+	for i := range objects {
+		p := Vec3{r.Float32() * 100, r.Float32() * 100, r.Float32() * 100}
+		objects[i] = &testObject{BoundingSphere{p, r.Float32() * 5}}
+	}
+	return objects
+}
+
+func sameObjects(a []SpatObject, b []*testObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	found := make(map[SpatObject]bool)
+	for _, o := range a {
+		found[o] = true
+	}
+	for _, o := range b {
+		if !found[o] {
+			return false
+		}
+	}
+	return true
+}
+
+func checkSpatTreeQueries(t *testing.T, name string, tree *SpatTree, objects []*testObject) {
+	if tree.Len() != len(objects) {
+		t.Errorf("%s: %d objects in tree, expected %d", name, tree.Len(), len(objects))
+	}
+
+	box := BoundingBox{Vec3{20, 30, 10}, Vec3{60, 50, 90}}
+	expected := make([]*testObject, 0)
+	for _, o := range objects {
+		b := MakeBoundingBoxFromSphere(&o.sphere)
+		if box.IntersectBox(&b) {
+			expected = append(expected, o)
+		}
+	}
+	if !sameObjects(tree.QueryBox(&box, nil), expected) {
+		t.Errorf("%s: QueryBox", name)
+	}
+
+	sphere := BoundingSphere{Vec3{40, 60, 50}, 20}
+	expected = expected[:0]
+	for _, o := range objects {
+		b := MakeBoundingBoxFromSphere(&o.sphere)
+		if b.IntersectSphere(&sphere) {
+			expected = append(expected, o)
+		}
+	}
+	if !sameObjects(tree.QuerySphere(&sphere, nil), expected) {
+		t.Errorf("%s: QuerySphere", name)
+	}
+
+	eye, center, up := Vec3{-10, -10, 50}, Vec3{50, 50, 50}, Vec3{0, 0, 1}
+	projection := MakePerspectiveMatrix(Deg2Rad(30), 1.0, 1.0, 80.0)
+	view := MakeLookAtMatrix(&eye, &center, &up)
+	frustum := MakeFrustumFromCamera(&projection, &view)
+	expected = expected[:0]
+	for _, o := range objects {
+		if frustum.ClipSphere(&o.sphere) {
+			expected = append(expected, o)
+		}
+	}
+	if !sameObjects(tree.QueryFrustum(frustum, nil), expected) {
+		t.Errorf("%s: QueryFrustum", name)
+	}
+
+	ray := Ray3{Vec3{-10, 50, 50}, Vec3{1, 0, 0}}
+	var nearest *testObject
+	nearestDist := float32(MathMax)
+	for _, o := range objects {
+		if hit, ok := ray.IntersectBoundingSphere(&o.sphere); ok && hit.Distance < nearestDist {
+			nearest, nearestDist = o, hit.Distance
+		}
+	}
+	if obj, _, ok := tree.QueryRay(&ray, nil); ok != (nearest != nil) || (ok && obj != SpatObject(nearest)) {
+		t.Errorf("%s: QueryRay", name)
+	}
+
+	p := Vec3{50, 50, 50}
+	result := tree.QueryNearest(p, 5, nil)
+	for i := 1; i < len(result); i++ {
+		a := MakeBoundingBoxFromVolume(result[i-1].GetBoundingVolume())
+		b := MakeBoundingBoxFromVolume(result[i].GetBoundingVolume())
+		if boxDistanceSq(&a, &p) > boxDistanceSq(&b, &p) {
+			t.Errorf("%s: QueryNearest not sorted", name)
+		}
+	}
+	if len(result) > 0 {
+		last := MakeBoundingBoxFromVolume(result[len(result)-1].GetBoundingVolume())
+		closer := 0
+		for _, o := range objects {
+			b := MakeBoundingBoxFromVolume(&o.sphere)
+			if boxDistanceSq(&b, &p) < boxDistanceSq(&last, &p) {
+				closer++
+			}
+		}
+		if closer > 4 {
+			t.Errorf("%s: QueryNearest missed %d closer objects", name, closer-4)
+		}
+	}
+}
+
+func TestSpatTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bounds := BoundingBox{Vec3{0, 0, 0}, Vec3{100, 100, 100}}
+	settings := &SpatTreeSettings{MaxDepth: 6, SplitThreshold: 8, MergeThreshold: 4, Looseness: 1}
+	loose := &SpatTreeSettings{MaxDepth: 6, SplitThreshold: 8, MergeThreshold: 4, Looseness: 2}
+	trees := map[string]*SpatTree{
+		"quadtree":     NewQuadTree(bounds, settings),
+		"octree":       NewOctree(bounds, settings),
+		"loose octree": NewOctree(bounds, loose),
+	}
+	for name, tree := range trees {
+		objects := randomTestObjects(r, 500)
+		items := make([]*SpatTreeItem, len(objects))
+		for i, o := range objects {
+			items[i] = tree.Insert(o)
+		}
+		checkSpatTreeQueries(t, name, tree, objects)
+
+		// move some, remove half
+		for i := 0; i < len(objects); i += 3 {
+			objects[i].sphere.Position = Vec3{r.Float32() * 100, r.Float32() * 100, r.Float32() * 100}
+			tree.Update(items[i])
+		}
+		for i := 0; i < len(objects)/2; i++ {
+			tree.Remove(items[i])
+		}
+		checkSpatTreeQueries(t, name, tree, objects[len(objects)/2:])
+
+		for i := len(objects) / 2; i < len(objects); i++ {
+			tree.Remove(items[i])
+		}
+		if tree.Len() != 0 || tree.root.children != nil {
+			t.Errorf("%s: tree not empty after removing all objects", name)
+		}
+	}
+}
+
+// volume type unknown to the package, known volumes are found by type switches
+type customVolume struct {
+	BoundingSphere
+}
+
+type customObject struct {
+	volume customVolume
+}
+
+func (o *customObject) GetBoundingVolume() BoundingVolume {
+	return &o.volume
+}
+
+func TestCustomVolumes(t *testing.T) {
+	o := &customObject{customVolume{BoundingSphere{Vec3{10, 20, 30}, 2}}}
+	box := BoundingBox{Vec3{0, 0, 0}, Vec3{20, 20, 29}}
+
+	tree := NewOctree(BoundingBox{Vec3{0, 0, 0}, Vec3{100, 100, 100}}, &SpatTreeSettings{MaxDepth: 4, SplitThreshold: 8, MergeThreshold: 4})
+	tree.Insert(o)
+	if found := tree.QueryBox(&box, nil); len(found) != 1 || found[0] != o {
+		t.Errorf("tree found %v", found)
+	}
+	if found := tree.QueryNearest(Vec3{50, 50, 50}, 1, nil); len(found) != 1 || found[0] != o {
+		t.Errorf("nearest %v", found)
+	}
+
+	bvh := NewDynamicBVH(1.0)
+	bvh.Insert(o)
+	found := 0
+	TraverseVolume(bvh.GetRoot(), BoxPredicate(&box), func(element SpatElement, leaf bool) bool {
+		if leaf {
+			found++
+		}
+		return true
+	})
+	if found != 1 {
+		t.Errorf("%d leaves in the box", found)
+	}
+}
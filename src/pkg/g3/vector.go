@@ -91,3 +91,323 @@ func (v *Vec3) TransformToLocal(x, y, z *Vec3) Vec3 {
 		Y: y.X*v.X + y.Y*v.Y + y.Z*v.Z,
 		Z: z.X*v.X + z.Y*v.Y + z.Z*v.Z}
 }
+
+func (self Vec3) Lerp(a Vec3, t float32) Vec3 {
+	return Vec3{X: self.X + (a.X-self.X)*t, Y: self.Y + (a.Y-self.Y)*t, Z: self.Z + (a.Z-self.Z)*t}
+}
+
+// Component-wise minimum
+func (self Vec3) Min(a Vec3) Vec3 {
+	return Vec3{X: Min(self.X, a.X), Y: Min(self.Y, a.Y), Z: Min(self.Z, a.Z)}
+}
+
+// Component-wise maximum
+func (self Vec3) Max(a Vec3) Vec3 {
+	return Vec3{X: Max(self.X, a.X), Y: Max(self.Y, a.Y), Z: Max(self.Z, a.Z)}
+}
+
+// Component-wise product
+func (self Vec3) MulComponents(a Vec3) Vec3 {
+	return Vec3{X: self.X * a.X, Y: self.Y * a.Y, Z: self.Z * a.Z}
+}
+
+func (self Vec3) DistanceSq(a Vec3) float32 {
+	d := self.Sub(a)
+	return d.LengthSq()
+}
+
+func (self Vec3) Distance(a Vec3) float32 {
+	return Sqrt(self.DistanceSq(a))
+}
+
+// Reflects self at the plane with the (normalized) normal n
+func (self Vec3) Reflect(n Vec3) Vec3 {
+	return self.Sub(n.Scaled(2.0 * self.Dot(n)))
+}
+
+// Projects self onto a
+func (self Vec3) Project(a Vec3) Vec3 {
+	return a.Scaled(self.Dot(a) / a.Dot(a))
+}
+
+// Angle between self and a in radians
+func (self Vec3) Angle(a Vec3) float32 {
+	return Acos(Clamp(self.Dot(a)/Sqrt(self.LengthSq()*a.LengthSq()), -1.0, 1.0))
+}
+
+func (self Vec3) ApproxEqualEps(a Vec3, eps float32) bool {
+	return ApproxEqualEps(self.X, a.X, eps) && ApproxEqualEps(self.Y, a.Y, eps) && ApproxEqualEps(self.Z, a.Z, eps)
+}
+
+func (self Vec3) ApproxEqual(a Vec3) bool {
+	return ApproxEqual(self.X, a.X) && ApproxEqual(self.Y, a.Y) && ApproxEqual(self.Z, a.Z)
+}
+
+func (self Vec3) Vec2() Vec2 {
+	return Vec2{X: self.X, Y: self.Y}
+}
+
+func (self Vec3) Vec4(w float32) Vec4 {
+	return Vec4{X: self.X, Y: self.Y, Z: self.Z, W: w}
+}
+
+// Vec2
+
+func (self Vec2) Add(a Vec2) Vec2 {
+	return Vec2{X: self.X + a.X, Y: self.Y + a.Y}
+}
+
+func (self Vec2) Sub(a Vec2) Vec2 {
+	return Vec2{X: self.X - a.X, Y: self.Y - a.Y}
+}
+
+func (self Vec2) Mul(a float32) Vec2 {
+	return Vec2{X: self.X * a, Y: self.Y * a}
+}
+
+func (self Vec2) Dot(a Vec2) float32 {
+	return self.X*a.X + self.Y*a.Y
+}
+
+// z component of the 3d cross product
+func (self Vec2) Cross(a Vec2) float32 {
+	return self.X*a.Y - self.Y*a.X
+}
+
+// Rotated by 90 degrees counter-clockwise
+func (self Vec2) Perpendicular() Vec2 {
+	return Vec2{X: -self.Y, Y: self.X}
+}
+
+func (self Vec2) Inverted() Vec2 {
+	return Vec2{X: -self.X, Y: -self.Y}
+}
+
+func (self Vec2) Scaled(s float32) Vec2 {
+	return Vec2{X: self.X * s, Y: self.Y * s}
+}
+
+func (self Vec2) Normalized() Vec2 {
+	l := 1.0 / self.Length()
+	return Vec2{X: self.X * l, Y: self.Y * l}
+}
+
+func (self Vec2) Lerp(a Vec2, t float32) Vec2 {
+	return Vec2{X: self.X + (a.X-self.X)*t, Y: self.Y + (a.Y-self.Y)*t}
+}
+
+// Component-wise minimum
+func (self Vec2) Min(a Vec2) Vec2 {
+	return Vec2{X: Min(self.X, a.X), Y: Min(self.Y, a.Y)}
+}
+
+// Component-wise maximum
+func (self Vec2) Max(a Vec2) Vec2 {
+	return Vec2{X: Max(self.X, a.X), Y: Max(self.Y, a.Y)}
+}
+
+// Component-wise product
+func (self Vec2) MulComponents(a Vec2) Vec2 {
+	return Vec2{X: self.X * a.X, Y: self.Y * a.Y}
+}
+
+func (self Vec2) DistanceSq(a Vec2) float32 {
+	d := self.Sub(a)
+	return d.LengthSq()
+}
+
+func (self Vec2) Distance(a Vec2) float32 {
+	return Sqrt(self.DistanceSq(a))
+}
+
+// Reflects self at the line with the (normalized) normal n
+func (self Vec2) Reflect(n Vec2) Vec2 {
+	return self.Sub(n.Scaled(2.0 * self.Dot(n)))
+}
+
+// Projects self onto a
+func (self Vec2) Project(a Vec2) Vec2 {
+	return a.Scaled(self.Dot(a) / a.Dot(a))
+}
+
+// Angle between self and a in radians
+func (self Vec2) Angle(a Vec2) float32 {
+	return Acos(Clamp(self.Dot(a)/Sqrt(self.LengthSq()*a.LengthSq()), -1.0, 1.0))
+}
+
+func (self Vec2) ApproxEqualEps(a Vec2, eps float32) bool {
+	return ApproxEqualEps(self.X, a.X, eps) && ApproxEqualEps(self.Y, a.Y, eps)
+}
+
+func (self Vec2) ApproxEqual(a Vec2) bool {
+	return ApproxEqual(self.X, a.X) && ApproxEqual(self.Y, a.Y)
+}
+
+func (self Vec2) Vec3(z float32) Vec3 {
+	return Vec3{X: self.X, Y: self.Y, Z: z}
+}
+
+func (v *Vec2) Set(x, y float32) {
+	v.X = x
+	v.Y = y
+}
+
+func (self *Vec2) Accumulate(a Vec2) {
+	self.X += a.X
+	self.Y += a.Y
+}
+
+func (self *Vec2) Scale(a float32) {
+	self.X *= a
+	self.Y *= a
+}
+
+func (v *Vec2) Normalize() {
+	l := 1.0 / v.Length()
+	v.X *= l
+	v.Y *= l
+}
+
+func (v *Vec2) LengthSq() float32 {
+	return v.X*v.X + v.Y*v.Y
+}
+
+func (v *Vec2) Length() float32 {
+	return Sqrt(v.LengthSq())
+}
+
+// Vec4
+
+func (self Vec4) Add(a Vec4) Vec4 {
+	return Vec4{X: self.X + a.X, Y: self.Y + a.Y, Z: self.Z + a.Z, W: self.W + a.W}
+}
+
+func (self Vec4) Sub(a Vec4) Vec4 {
+	return Vec4{X: self.X - a.X, Y: self.Y - a.Y, Z: self.Z - a.Z, W: self.W - a.W}
+}
+
+func (self Vec4) Mul(a float32) Vec4 {
+	return Vec4{X: self.X * a, Y: self.Y * a, Z: self.Z * a, W: self.W * a}
+}
+
+func (self Vec4) Dot(a Vec4) float32 {
+	return self.X*a.X + self.Y*a.Y + self.Z*a.Z + self.W*a.W
+}
+
+func (self Vec4) Inverted() Vec4 {
+	return Vec4{X: -self.X, Y: -self.Y, Z: -self.Z, W: -self.W}
+}
+
+func (self Vec4) Scaled(s float32) Vec4 {
+	return Vec4{X: self.X * s, Y: self.Y * s, Z: self.Z * s, W: self.W * s}
+}
+
+func (self Vec4) Normalized() Vec4 {
+	l := 1.0 / self.Length()
+	return Vec4{X: self.X * l, Y: self.Y * l, Z: self.Z * l, W: self.W * l}
+}
+
+func (self Vec4) Lerp(a Vec4, t float32) Vec4 {
+	return Vec4{
+		X: self.X + (a.X-self.X)*t,
+		Y: self.Y + (a.Y-self.Y)*t,
+		Z: self.Z + (a.Z-self.Z)*t,
+		W: self.W + (a.W-self.W)*t}
+}
+
+// Component-wise minimum
+func (self Vec4) Min(a Vec4) Vec4 {
+	return Vec4{X: Min(self.X, a.X), Y: Min(self.Y, a.Y), Z: Min(self.Z, a.Z), W: Min(self.W, a.W)}
+}
+
+// Component-wise maximum
+func (self Vec4) Max(a Vec4) Vec4 {
+	return Vec4{X: Max(self.X, a.X), Y: Max(self.Y, a.Y), Z: Max(self.Z, a.Z), W: Max(self.W, a.W)}
+}
+
+// Component-wise product
+func (self Vec4) MulComponents(a Vec4) Vec4 {
+	return Vec4{X: self.X * a.X, Y: self.Y * a.Y, Z: self.Z * a.Z, W: self.W * a.W}
+}
+
+func (self Vec4) DistanceSq(a Vec4) float32 {
+	d := self.Sub(a)
+	return d.LengthSq()
+}
+
+func (self Vec4) Distance(a Vec4) float32 {
+	return Sqrt(self.DistanceSq(a))
+}
+
+// Reflects self at the hyperplane with the (normalized) normal n
+func (self Vec4) Reflect(n Vec4) Vec4 {
+	return self.Sub(n.Scaled(2.0 * self.Dot(n)))
+}
+
+// Projects self onto a
+func (self Vec4) Project(a Vec4) Vec4 {
+	return a.Scaled(self.Dot(a) / a.Dot(a))
+}
+
+// Angle between self and a in radians
+func (self Vec4) Angle(a Vec4) float32 {
+	return Acos(Clamp(self.Dot(a)/Sqrt(self.LengthSq()*a.LengthSq()), -1.0, 1.0))
+}
+
+func (self Vec4) ApproxEqualEps(a Vec4, eps float32) bool {
+	return ApproxEqualEps(self.X, a.X, eps) && ApproxEqualEps(self.Y, a.Y, eps) &&
+		ApproxEqualEps(self.Z, a.Z, eps) && ApproxEqualEps(self.W, a.W, eps)
+}
+
+func (self Vec4) ApproxEqual(a Vec4) bool {
+	return ApproxEqual(self.X, a.X) && ApproxEqual(self.Y, a.Y) &&
+		ApproxEqual(self.Z, a.Z) && ApproxEqual(self.W, a.W)
+}
+
+// Drops the w component
+func (self Vec4) Vec3() Vec3 {
+	return Vec3{X: self.X, Y: self.Y, Z: self.Z}
+}
+
+// Divides x, y and z by w
+func (self Vec4) Homogenized() Vec3 {
+	w := 1.0 / self.W
+	return Vec3{X: self.X * w, Y: self.Y * w, Z: self.Z * w}
+}
+
+func (v *Vec4) Set(x, y, z, w float32) {
+	v.X = x
+	v.Y = y
+	v.Z = z
+	v.W = w
+}
+
+func (self *Vec4) Accumulate(a Vec4) {
+	self.X += a.X
+	self.Y += a.Y
+	self.Z += a.Z
+	self.W += a.W
+}
+
+func (self *Vec4) Scale(a float32) {
+	self.X *= a
+	self.Y *= a
+	self.Z *= a
+	self.W *= a
+}
+
+func (v *Vec4) Normalize() {
+	l := 1.0 / v.Length()
+	v.X *= l
+	v.Y *= l
+	v.Z *= l
+	v.W *= l
+}
+
+func (v *Vec4) LengthSq() float32 {
+	return v.X*v.X + v.Y*v.Y + v.Z*v.Z + v.W*v.W
+}
+
+func (v *Vec4) Length() float32 {
+	return Sqrt(v.LengthSq())
+}
@@ -0,0 +1,129 @@
+package g3
+
+import (
+	"testing"
+)
+
+func TestVec3(t *testing.T) {
+	a, b := Vec3{1, 2, 3}, Vec3{-2, 0.5, 4}
+	tests := []struct {
+		name      string
+		got, want Vec3
+	}{
+		{"Add", a.Add(b), Vec3{-1, 2.5, 7}},
+		{"Sub", a.Sub(b), Vec3{3, 1.5, -1}},
+		{"Mul", a.Mul(2), Vec3{2, 4, 6}},
+		{"Cross", Vec3{1, 0, 0}.Cross(Vec3{0, 1, 0}), Vec3{0, 0, 1}},
+		{"Cross anticommutative", b.Cross(a), a.Cross(b).Inverted()},
+		{"Normalized", Vec3{3, 0, 4}.Normalized(), Vec3{0.6, 0, 0.8}},
+		{"Lerp 0", a.Lerp(b, 0), a},
+		{"Lerp 1", a.Lerp(b, 1), b},
+		{"Lerp half", a.Lerp(b, 0.5), Vec3{-0.5, 1.25, 3.5}},
+		{"Min", a.Min(b), Vec3{-2, 0.5, 3}},
+		{"Max", a.Max(b), Vec3{1, 2, 4}},
+		{"MulComponents", a.MulComponents(b), Vec3{-2, 1, 12}},
+		{"Reflect", Vec3{1, -1, 0}.Reflect(Vec3{0, 1, 0}), Vec3{1, 1, 0}},
+		{"Project", a.Project(Vec3{0, 0, 2}), Vec3{0, 0, 3}},
+	}
+	for _, test := range tests {
+		if !test.got.ApproxEqual(test.want) {
+			t.Errorf("%s: %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	if d := a.Dot(b); !ApproxEqual(d, 11) {
+		t.Errorf("Dot %f", d)
+	}
+	if d := a.Cross(b).Dot(a); !ApproxZero(d) {
+		t.Errorf("cross product not perpendicular, dot %f", d)
+	}
+	if d := (Vec3{1, 1, 1}).Distance(Vec3{1, 4, 5}); !ApproxEqual(d, 5) {
+		t.Errorf("Distance %f", d)
+	}
+	if angle := (Vec3{1, 0, 0}).Angle(Vec3{1, 1, 0}); !ApproxEqual(angle, Pi/4) {
+		t.Errorf("Angle %f", angle)
+	}
+	// rounding can push the cosine of parallel vectors past one
+	if angle := (Vec3{0.1, 0.2, 0.3}).Angle(Vec3{0.3, 0.6, 0.9}); angle != angle || angle > 1e-3 {
+		t.Errorf("Angle of parallel vectors %f", angle)
+	}
+}
+
+func TestVec3ApproxEqual(t *testing.T) {
+	tests := []struct {
+		a, b  Vec3
+		equal bool
+	}{
+		{Vec3{1, 2, 3}, Vec3{1, 2, 3}, true},
+		{Vec3{1, 2, 3}, Vec3{1, 2, 3 + 1e-7}, true},
+		{Vec3{1, 2, 3}, Vec3{1, 2.001, 3}, false},
+		{Vec3{1e5, 0, 0}, Vec3{1e5 + 0.05, 0, 0}, true},
+		// relative per component, a large component does not widen the others
+		{Vec3{1e5, 0, 0}, Vec3{1e5, 0.05, 0}, false},
+	}
+	for i, test := range tests {
+		if test.a.ApproxEqual(test.b) != test.equal {
+			t.Errorf("%d: %v ApproxEqual %v != %v", i, test.a, test.b, test.equal)
+		}
+	}
+	if !(Vec3{1, 2, 3}).ApproxEqualEps(Vec3{1.5, 2, 3}, 0.5) || (Vec3{1, 2, 3}).ApproxEqualEps(Vec3{1, 2, 4}, 0.5) {
+		t.Error("ApproxEqualEps")
+	}
+}
+
+func TestVec2(t *testing.T) {
+	a, b := Vec2{1, 2}, Vec2{-3, 0.5}
+	tests := []struct {
+		name      string
+		got, want Vec2
+	}{
+		{"Add", a.Add(b), Vec2{-2, 2.5}},
+		{"Sub", a.Sub(b), Vec2{4, 1.5}},
+		{"Perpendicular", a.Perpendicular(), Vec2{-2, 1}},
+		{"Normalized", Vec2{3, 4}.Normalized(), Vec2{0.6, 0.8}},
+		{"Lerp half", a.Lerp(b, 0.5), Vec2{-1, 1.25}},
+		{"Min", a.Min(b), Vec2{-3, 0.5}},
+		{"Max", a.Max(b), Vec2{1, 2}},
+		{"Reflect", Vec2{1, -1}.Reflect(Vec2{0, 1}), Vec2{1, 1}},
+		{"Project", a.Project(Vec2{2, 0}), Vec2{1, 0}},
+	}
+	for _, test := range tests {
+		if !test.got.ApproxEqual(test.want) {
+			t.Errorf("%s: %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	if c := a.Cross(b); !ApproxEqual(c, a.Vec3(0).Cross(b.Vec3(0)).Z) {
+		t.Errorf("Cross %f", c)
+	}
+	if angle := (Vec2{1, 0}).Angle(Vec2{0, -2}); !ApproxEqual(angle, Pi/2) {
+		t.Errorf("Angle %f", angle)
+	}
+}
+
+func TestVec4(t *testing.T) {
+	a, b := Vec4{1, 2, 3, 4}, Vec4{4, 3, 2, 1}
+	tests := []struct {
+		name      string
+		got, want Vec4
+	}{
+		{"Add", a.Add(b), Vec4{5, 5, 5, 5}},
+		{"Sub", a.Sub(b), Vec4{-3, -1, 1, 3}},
+		{"Scaled", a.Scaled(0.5), Vec4{0.5, 1, 1.5, 2}},
+		{"Normalized", Vec4{2, 0, 0, 0}.Normalized(), Vec4{1, 0, 0, 0}},
+		{"Lerp 1", a.Lerp(b, 1), b},
+		{"Lerp quarter", a.Lerp(b, 0.25), Vec4{1.75, 2.25, 2.75, 3.25}},
+	}
+	for _, test := range tests {
+		if !test.got.ApproxEqual(test.want) {
+			t.Errorf("%s: %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	if d := a.Dot(b); !ApproxEqual(d, 20) {
+		t.Errorf("Dot %f", d)
+	}
+	if h := (Vec4{2, 4, 6, 2}).Homogenized(); !h.ApproxEqual(Vec3{1, 2, 3}) {
+		t.Errorf("Homogenized %v", h)
+	}
+	if (Vec4{1, 2, 3, 4}).ApproxEqual(Vec4{1, 2, 3, 4.001}) {
+		t.Error("ApproxEqual ignores w")
+	}
+}
@@ -0,0 +1,190 @@
+package g3
+
+import (
+	"container/heap"
+)
+
+// Generic walks over any tree of SpatElements. An element is passed to
+// traverseFunc as leaf if it has no children. If traverseFunc returns false
+// the children of the element are skipped.
+
+// Decides if an element with the given bounding volume is visited
+type VolumePredicate func(bvol BoundingVolume) bool
+
+func TraverseDepthFirst(root SpatElement, traverseFunc TraverseFunc) {
+	children := root.GetChildren()
+	if traverseFunc(root, len(children) == 0) {
+		for _, child := range children {
+			TraverseDepthFirst(child, traverseFunc)
+		}
+	}
+}
+
+func TraverseBreadthFirst(root SpatElement, traverseFunc TraverseFunc) {
+	queue := []SpatElement{root}
+	for len(queue) > 0 {
+		element := queue[0]
+		queue = queue[1:]
+		children := element.GetChildren()
+		if traverseFunc(element, len(children) == 0) {
+			queue = append(queue, children...)
+		}
+	}
+}
+
+// Only elements whose bounding volumes satisfy predicate are passed on to traverseFunc.
+func VolumeFilter(predicate VolumePredicate, traverseFunc TraverseFunc) TraverseFunc {
+	return func(element SpatElement, leaf bool) bool {
+		if !predicate(element.GetBoundingVolume()) {
+			return false
+		}
+		return traverseFunc(element, leaf)
+	}
+}
+
+// Depth first walk that skips subtrees whose bounding volumes don't satisfy predicate.
+func TraverseVolume(root SpatElement, predicate VolumePredicate, traverseFunc TraverseFunc) {
+	TraverseDepthFirst(root, VolumeFilter(predicate, traverseFunc))
+}
+
+// Unlike Frustum.ClassifyBoundingVolumeMasked no coherency state is written,
+// so the predicate can be used in parallel traversals.
+func FrustumPredicate(frustum *Frustum) VolumePredicate {
+	return func(bvol BoundingVolume) bool {
+		return bvol == nil || frustum.ClipBoundingVolume(bvol)
+	}
+}
+
+func BoxPredicate(bbox *BoundingBox) VolumePredicate {
+	return func(bvol BoundingVolume) bool {
+		if bvol == nil {
+			return true
+		}
+		b := MakeBoundingBoxFromVolume(bvol)
+		return b.IntersectBox(bbox)
+	}
+}
+
+func SpherePredicate(sphere *BoundingSphere) VolumePredicate {
+	return func(bvol BoundingVolume) bool {
+		switch v := bvol.(type) {
+		case nil:
+			return true
+		case *BoundingSphere:
+			return v.IntersectSphere(sphere)
+		case *OrientedBoundingBox:
+			return v.IntersectSphere(sphere)
+		}
+		b := MakeBoundingBoxFromVolume(bvol)
+		return b.IntersectSphere(sphere)
+	}
+}
+
+// Squared distance from p to the closest point of bvol, 0 if p is inside.
+func volumeDistanceSq(bvol BoundingVolume, p *Vec3) float32 {
+	switch v := bvol.(type) {
+	case nil:
+		return 0.0
+	case *BoundingBox:
+		return v.ClosestPoint(p).DistanceSq(*p)
+	case *OrientedBoundingBox:
+		return v.ClosestPoint(p).DistanceSq(*p)
+	case *BoundingSphere:
+		d := Max(v.Position.Distance(*p)-v.Radius, 0.0)
+		return d * d
+	}
+	bbox := bvol.CalculateBoundingBox()
+	return bbox.ClosestPoint(p).DistanceSq(*p)
+}
+
+type elementQueueEntry struct {
+	distSq  float32
+	element SpatElement
+}
+
+type elementQueue []elementQueueEntry
+
+func (q elementQueue) Len() int           { return len(q) }
+func (q elementQueue) Less(i, j int) bool { return q[i].distSq < q[j].distSq }
+func (q elementQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *elementQueue) Push(x interface{}) {
+	*q = append(*q, x.(elementQueueEntry))
+}
+
+func (q *elementQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Visits elements ordered by the distance of their bounding volumes to
+// point, nearest first, e.g. to render for early-z or to fill an occlusion
+// buffer. The order is global: leaves of different subtrees are interleaved.
+func TraverseFrontToBack(root SpatElement, point Vec3, traverseFunc TraverseFunc) {
+	queue := &elementQueue{}
+	heap.Push(queue, elementQueueEntry{volumeDistanceSq(root.GetBoundingVolume(), &point), root})
+	for queue.Len() > 0 {
+		element := heap.Pop(queue).(elementQueueEntry).element
+		children := element.GetChildren()
+		if !traverseFunc(element, len(children) == 0) {
+			continue
+		}
+		for _, child := range children {
+			heap.Push(queue, elementQueueEntry{volumeDistanceSq(child.GetBoundingVolume(), &point), child})
+		}
+	}
+}
+
+// Walks the tree with up to workers goroutines. The top of the tree is
+// walked breadth first until there are enough subtrees to keep all workers
+// busy, then the subtrees are walked depth first in parallel. traverseFunc
+// must be safe for concurrent use and there is no order between subtrees.
+func TraverseParallel(root SpatElement, workers int, traverseFunc TraverseFunc) {
+	if workers < 2 {
+		TraverseDepthFirst(root, traverseFunc)
+		return
+	}
+
+	// several subtrees per worker, they are rarely balanced
+	frontier := []SpatElement{root}
+	for len(frontier) > 0 && len(frontier) < workers*4 {
+		next := make([]SpatElement, 0, len(frontier)*4)
+		expanded := false
+		for _, element := range frontier {
+			children := element.GetChildren()
+			if len(children) == 0 {
+				next = append(next, element)
+				continue
+			}
+			if traverseFunc(element, false) {
+				next = append(next, children...)
+			}
+			expanded = true
+		}
+		frontier = next
+		if !expanded {
+			break
+		}
+	}
+
+	subtrees := make(chan SpatElement, len(frontier))
+	for _, element := range frontier {
+		subtrees <- element
+	}
+	close(subtrees)
+
+	done := make(chan bool)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for element := range subtrees {
+				TraverseDepthFirst(element, traverseFunc)
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-done
+	}
+}
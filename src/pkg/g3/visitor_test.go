@@ -0,0 +1,93 @@
+package g3
+
+import (
+	"testing"
+)
+
+func TestTraverseOrders(t *testing.T) {
+	// 1 + 4 + 16 + 64 + 256 elements
+	root := buildTerrainQuadTree(4, 0, 0, 1024, nil)
+	count := func(walk func(TraverseFunc)) (elements, leaves int) {
+		walk(func(element SpatElement, leaf bool) bool {
+			elements++
+			if leaf {
+				leaves++
+			}
+			return true
+		})
+		return
+	}
+	walks := map[string]func(TraverseFunc){
+		"depth first":   func(f TraverseFunc) { TraverseDepthFirst(root, f) },
+		"breadth first": func(f TraverseFunc) { TraverseBreadthFirst(root, f) },
+		"front to back": func(f TraverseFunc) { TraverseFrontToBack(root, Vec3{512, 512, 0}, f) },
+	}
+	for name, walk := range walks {
+		if elements, leaves := count(walk); elements != 341 || leaves != 256 {
+			t.Errorf("%s: %d elements, %d leaves", name, elements, leaves)
+		}
+	}
+
+	p := Vec3{100, 700, 50}
+	last := float32(0)
+	TraverseFrontToBack(root, p, func(element SpatElement, leaf bool) bool {
+		if leaf {
+			d := volumeDistanceSq(element.GetBoundingVolume(), &p)
+			if d < last {
+				t.Errorf("front to back: leaf at %f after %f", d, last)
+			}
+			last = d
+		}
+		return true
+	})
+}
+
+func TestTraverseVolume(t *testing.T) {
+	root := buildTerrainQuadTree(5, 0, 0, 1024, nil)
+	frustum := makeTerrainFrustum()
+
+	expected := 0
+	traverseFrustumAllPlanes(root, frustum, func(element SpatElement, leaf bool) bool {
+		if leaf {
+			expected++
+		}
+		return true
+	})
+
+	visible := 0
+	TraverseVolume(root, FrustumPredicate(frustum), func(element SpatElement, leaf bool) bool {
+		if leaf {
+			visible++
+		}
+		return true
+	})
+	if visible != expected || visible == 0 {
+		t.Errorf("%d visible leaves, expected %d", visible, expected)
+	}
+
+	for _, workers := range []int{1, 2, 7} {
+		leaves := make(chan bool, 1024)
+		TraverseParallel(root, workers, VolumeFilter(FrustumPredicate(frustum), func(element SpatElement, leaf bool) bool {
+			if leaf {
+				leaves <- true
+			}
+			return true
+		}))
+		if len(leaves) != expected {
+			t.Errorf("%d workers: %d visible leaves, expected %d", workers, len(leaves), expected)
+		}
+	}
+
+	box := BoundingBox{Vec3{100, 100, -100}, Vec3{300, 200, 100}}
+	inside := 0
+	TraverseVolume(root, BoxPredicate(&box), func(element SpatElement, leaf bool) bool {
+		if leaf {
+			inside++
+		}
+		return true
+	})
+	// 32x32 leaves of size 32, the box covers columns 3-9 and rows 3-6
+	if inside != 7*4 {
+		t.Errorf("%d leaves in box, expected %d", inside, 7*4)
+	}
+}